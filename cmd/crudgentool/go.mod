@@ -4,12 +4,12 @@ go 1.18
 
 require (
 	github.com/LSDXXX/libs v0.0.0
-	gorm.io/gorm v1.23.2
+	gorm.io/gorm v1.24.2
 )
 
 require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
-	github.com/jinzhu/now v1.1.4 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/spf13/cast v1.4.1 // indirect
 	golang.org/x/mod v0.7.0 // indirect
@@ -11,12 +11,14 @@ var (
 	fileName    string
 	outputPath  string
 	packageName string
+	openAPIPath string
 )
 
 func init() {
 	flag.StringVar(&fileName, "f", "", "input file")
 	flag.StringVar(&outputPath, "op", "", "output path")
 	flag.StringVar(&packageName, "pkg", "", "package name")
+	flag.StringVar(&openAPIPath, "openapi", "", "openapi document to merge the operations into")
 }
 
 func main() {
@@ -31,6 +33,7 @@ func main() {
 		Package:       packageName,
 		HelperPackage: "github.com/LSDXXX/libs/pkg/handlergen/helper",
 		OutputPath:    outputPath,
+		OpenAPIPath:   openAPIPath,
 	})
 	if err != nil {
 		panic(err)
@@ -21,6 +21,8 @@ import (
 	"github.com/LSDXXX/libs/pkg/util"
 	"github.com/LSDXXX/libs/pkg/wsmanager"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats/view"
@@ -225,7 +227,54 @@ func Init(srv string) error {
 	var conf *config.Config
 	util.PanicWhenError(container.Resolve(&conf))
 
-	container.Singleton(wsmanager.New)
+	// built now, the kafka broker must be registered before the app starts
+	wsOpts, err := websocketOptions(conf.WebSocket)
+	if err != nil {
+		return err
+	}
+	container.Singleton(func() *wsmanager.WSManager {
+		return wsmanager.New(wsOpts...)
+	})
 
 	return nil
 }
+
+// websocketOptions broker and presence of the websocket manager, the
+// presence is shared through redis whenever redis is configured
+//
+//	@param conf
+//	@return []wsmanager.Option
+//	@return error
+func websocketOptions(conf config.WebSocketConfig) ([]wsmanager.Option, error) {
+	if len(conf.NodeId) == 0 {
+		conf.NodeId = uuid.NewString()
+	}
+	if len(conf.Topic) == 0 {
+		conf.Topic = "websocket"
+	}
+	opts := []wsmanager.Option{wsmanager.WithConfig(conf)}
+	var client redis.Cmdable
+	hasRedis := container.Resolve(&client) == nil && client != nil
+	if hasRedis {
+		opts = append(opts, wsmanager.WithPresence(wsmanager.NewRedisPresence(client)))
+	}
+	switch conf.Broker {
+	case "", config.WebSocketBrokerMemory:
+	case config.WebSocketBrokerRedis:
+		if !hasRedis {
+			return nil, errors.New("websocket redis broker needs redis")
+		}
+		opts = append(opts, wsmanager.WithBroker(wsmanager.NewRedisBroker(client, conf.Topic)))
+	case config.WebSocketBrokerKafka:
+		var producer infra.Producer
+		if err := container.Resolve(&producer); err != nil {
+			return nil, errors.Wrap(err, "websocket kafka broker needs a kafka producer")
+		}
+		broker := wsmanager.NewKafkaBroker(producer, conf.Topic, conf.NodeId)
+		RegisterSteamMessageHandler(broker)
+		opts = append(opts, wsmanager.WithBroker(broker))
+	default:
+		return nil, errors.Errorf("unknown websocket broker %s", conf.Broker)
+	}
+	return opts, nil
+}
@@ -24,6 +24,7 @@ type Config struct {
 	HttpServerPort int                `yaml:"server_port"`
 	GrpcServerPort int                `yaml:"grpc_server_port"`
 	ServerName     string             `yaml:"server_name"`
+	WebSocket      WebSocketConfig    `yaml:"websocket"`
 
 	PrometheusBindURL string `yaml:"prometheus_bind_url"`
 	Cron              string `yaml:"cron"`
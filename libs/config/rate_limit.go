@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// RateLimitConfig per user limits of chat requests, zero disables a limit
+type RateLimitConfig struct {
+	// RequestsPerMinute asks a user may send within one minute
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	// ConcurrentStreams answers a user may receive at the same time
+	ConcurrentStreams int `yaml:"concurrent_streams"`
+	// DailyQuota characters of prompts and answers a user may use per day
+	DailyQuota int64 `yaml:"daily_quota"`
+	// StreamTTL a stream slot that is never released, e.g. by a crashed
+	// instance, is freed once no stream of the user started or ended for
+	// this long, must be positive
+	StreamTTL time.Duration `yaml:"stream_ttl" default:"10m"`
+}
@@ -0,0 +1,58 @@
+package config
+
+import "time"
+
+// WebSocket policies for a client whose send queue is full
+const (
+	// WebSocketDrop drop the message, the client keeps the connection and
+	// does not learn it missed one, only for clients which can live with it
+	WebSocketDrop = "drop"
+	// WebSocketDisconnect close the connection of the client
+	WebSocketDisconnect = "disconnect"
+)
+
+// WebSocket brokers fanning sends out to every instance
+const (
+	// WebSocketBrokerMemory single instance
+	WebSocketBrokerMemory = "memory"
+	// WebSocketBrokerRedis redis pub/sub, needs redis
+	WebSocketBrokerRedis = "redis"
+	// WebSocketBrokerKafka kafka topic consumed by every instance, needs kafka
+	WebSocketBrokerKafka = "kafka"
+)
+
+// WebSocketConfig heartbeat and backpressure of websocket clients
+type WebSocketConfig struct {
+	// PingInterval the server pings every client this often
+	PingInterval time.Duration `yaml:"ping_interval" default:"30s"`
+	// PongTimeout a client sending nothing, not even a pong, for this long
+	// is disconnected, it must be longer than PingInterval
+	PongTimeout time.Duration `yaml:"pong_timeout" default:"60s"`
+	// WriteTimeout a single write to a client must finish within it, a
+	// send waits at most this long for the queue of the manager before
+	// its clients are disconnected
+	WriteTimeout time.Duration `yaml:"write_timeout" default:"10s"`
+	// QueueSize messages waiting to be written to a client
+	QueueSize int `yaml:"queue_size" default:"256"`
+	// SlowPolicy what to do when the queue of a client is full, disconnect
+	// or drop
+	SlowPolicy string `yaml:"slow_policy" default:"disconnect"`
+	// MaxMessageSize largest message a client may send, a larger one closes
+	// the connection
+	MaxMessageSize int64 `yaml:"max_message_size" default:"65536"`
+	// AllowedOrigins browser origins allowed to connect besides the same
+	// origin, like https://chat.example.com, *.example.com or *
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// Subprotocols supported besides the ones of the handler, in order of
+	// preference
+	Subprotocols []string `yaml:"subprotocols"`
+	// Compression negotiate permessage-deflate with the clients
+	Compression bool `yaml:"compression"`
+	// Broker delivers sends to the clients connected to other instances,
+	// memory, redis or kafka
+	Broker string `yaml:"broker" default:"memory"`
+	// Topic redis channel or kafka topic of the broker
+	Topic string `yaml:"topic" default:"websocket"`
+	// NodeId name of this instance, random when empty
+	NodeId string `yaml:"node_id"`
+}
@@ -0,0 +1,177 @@
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+
+package infra
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/repo"
+)
+
+func init() {
+	AppendInitFunc(func() {
+		_ = container.Singleton(NewApiKeyMapper)
+	})
+}
+
+type ApiKeyMapperImp struct {
+	db    *gorm.DB `container:"type"`
+	table string
+}
+
+func NewApiKeyMapper() repo.ApiKeyMapper {
+	out := &ApiKeyMapperImp{
+		table: "api_key",
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (d *ApiKeyMapperImp) DB() *gorm.DB {
+	return d.db
+}
+
+func (d *ApiKeyMapperImp) Table() string {
+	return d.table
+}
+
+func (d *ApiKeyMapperImp) WithTable() *gorm.DB {
+	return d.db.Table(d.table)
+}
+
+func (d *ApiKeyMapperImp) WithDB(db *gorm.DB) repo.ApiKeyMapper {
+	return &ApiKeyMapperImp{
+		db:    db,
+		table: d.table,
+	}
+}
+
+func (d *ApiKeyMapperImp) Page(page, pageSize int, order string, conds ...model.ApiKey) (result []model.ApiKey, count int64, err error) {
+
+	db := d.db.Table(d.table)
+	err = db.Count(&count).Error
+	if err != nil {
+		return
+	}
+
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	db = db.Limit(pageSize).Offset((page - 1) * pageSize)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	err = db.Find(&result).Error
+	return
+}
+
+func (d *ApiKeyMapperImp) Find(conds model.ApiKey) (result []model.ApiKey, err error) {
+	err = d.db.Table(d.table).Where(conds).Find(&result).Error
+	return
+}
+
+func (d *ApiKeyMapperImp) Take(order string, conds ...model.ApiKey) (result model.ApiKey, err error) {
+	db := d.db.Table(d.table).Where(conds)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Take(&result).Error
+	return
+}
+
+func (d *ApiKeyMapperImp) Count(conds ...model.ApiKey) (count int64, err error) {
+	db := d.db.Table(d.table)
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Count(&count).Error
+	return
+}
+
+func (d *ApiKeyMapperImp) Insert(items ...*model.ApiKey) error {
+	return d.db.Table(d.table).Create(&items).Error
+}
+
+func (d *ApiKeyMapperImp) InsertInBatches(items []*model.ApiKey, size int) error {
+	return d.db.Table(d.table).CreateInBatches(&items, size).Error
+}
+
+func (d *ApiKeyMapperImp) UpdateOrCreate(update *model.ApiKey, conds model.ApiKey) error {
+	return d.DB().Table(d.table).
+		Where(conds).
+		Assign(*update).
+		FirstOrCreate(update).Error
+}
+
+func (d *ApiKeyMapperImp) Updates(updates *model.ApiKey, conds model.ApiKey) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Updates(updates)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ApiKeyMapperImp) FirstOrCreate(insert *model.ApiKey, conds model.ApiKey) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).
+		Where(conds).
+		Attrs(*insert).
+		FirstOrCreate(insert)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ApiKeyMapperImp) Delete(conds model.ApiKey) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Delete(&model.ApiKey{})
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ApiKeyMapperImp) GetByHash(keyHash string) (res model.ApiKey, err error) {
+	params := map[string]interface{}{
+		"keyHash": keyHash,
+	}
+	var generateSQL string
+	generateSQL += "select * from api_key where key_hash = @keyHash"
+
+	executeSQL := d.DB().Raw(generateSQL, params).Take(&res)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ApiKeyMapperImp) ListByUserId(userId int) (res []model.ApiKey, err error) {
+	params := map[string]interface{}{
+		"userId": userId,
+	}
+	var generateSQL string
+	generateSQL += "select * from api_key where user_id = @userId order by id "
+
+	executeSQL := d.DB().Raw(generateSQL, params).Find(&res)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ApiKeyMapperImp) UpdateLastUsed(id int, lastUsed time.Time) (err error) {
+	params := map[string]interface{}{
+		"lastUsed": lastUsed,
+		"id":       id,
+	}
+	var generateSQL string
+	generateSQL += "update api_key set last_used_time = @lastUsed where id = @id"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
@@ -0,0 +1,150 @@
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+
+package infra
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/repo"
+)
+
+func init() {
+	AppendInitFunc(func() {
+		_ = container.Singleton(NewAuthTokenMapper)
+	})
+}
+
+type AuthTokenMapperImp struct {
+	db    *gorm.DB `container:"type"`
+	table string
+}
+
+func NewAuthTokenMapper() repo.AuthTokenMapper {
+	out := &AuthTokenMapperImp{
+		table: "auth_token",
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (d *AuthTokenMapperImp) DB() *gorm.DB {
+	return d.db
+}
+
+func (d *AuthTokenMapperImp) Table() string {
+	return d.table
+}
+
+func (d *AuthTokenMapperImp) WithTable() *gorm.DB {
+	return d.db.Table(d.table)
+}
+
+func (d *AuthTokenMapperImp) WithDB(db *gorm.DB) repo.AuthTokenMapper {
+	return &AuthTokenMapperImp{
+		db:    db,
+		table: d.table,
+	}
+}
+
+func (d *AuthTokenMapperImp) Page(page, pageSize int, order string, conds ...model.AuthToken) (result []model.AuthToken, count int64, err error) {
+
+	db := d.db.Table(d.table)
+	err = db.Count(&count).Error
+	if err != nil {
+		return
+	}
+
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	db = db.Limit(pageSize).Offset((page - 1) * pageSize)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	err = db.Find(&result).Error
+	return
+}
+
+func (d *AuthTokenMapperImp) Find(conds model.AuthToken) (result []model.AuthToken, err error) {
+	err = d.db.Table(d.table).Where(conds).Find(&result).Error
+	return
+}
+
+func (d *AuthTokenMapperImp) Take(order string, conds ...model.AuthToken) (result model.AuthToken, err error) {
+	db := d.db.Table(d.table).Where(conds)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Take(&result).Error
+	return
+}
+
+func (d *AuthTokenMapperImp) Count(conds ...model.AuthToken) (count int64, err error) {
+	db := d.db.Table(d.table)
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Count(&count).Error
+	return
+}
+
+func (d *AuthTokenMapperImp) Insert(items ...*model.AuthToken) error {
+	return d.db.Table(d.table).Create(&items).Error
+}
+
+func (d *AuthTokenMapperImp) InsertInBatches(items []*model.AuthToken, size int) error {
+	return d.db.Table(d.table).CreateInBatches(&items, size).Error
+}
+
+func (d *AuthTokenMapperImp) UpdateOrCreate(update *model.AuthToken, conds model.AuthToken) error {
+	return d.DB().Table(d.table).
+		Where(conds).
+		Assign(*update).
+		FirstOrCreate(update).Error
+}
+
+func (d *AuthTokenMapperImp) Updates(updates *model.AuthToken, conds model.AuthToken) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Updates(updates)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *AuthTokenMapperImp) FirstOrCreate(insert *model.AuthToken, conds model.AuthToken) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).
+		Where(conds).
+		Attrs(*insert).
+		FirstOrCreate(insert)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *AuthTokenMapperImp) Delete(conds model.AuthToken) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Delete(&model.AuthToken{})
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *AuthTokenMapperImp) GetByAccount(account string) (res model.AuthToken, err error) {
+	params := map[string]interface{}{
+		"account": account,
+	}
+	var generateSQL string
+	generateSQL += "select * from auth_token where account = @account"
+
+	executeSQL := d.DB().Raw(generateSQL, params).Take(&res)
+	err = executeSQL.Error
+	return
+}
@@ -0,0 +1,147 @@
+package infra
+
+import (
+	"context"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ConversationContainerDBImp container keeping the whole message history in the database
+type ConversationContainerDBImp struct {
+	conversationMapper repo.ConversationMapper        `container:"type"`
+	messageMapper      repo.ConversationMessageMapper `container:"type"`
+}
+
+func NewConversationContainerDBImp() repo.ConversationContainer {
+	out := &ConversationContainerDBImp{}
+	util.PanicWhenError(container.Fill(out))
+	return out
+}
+
+func (c *ConversationContainerDBImp) WithContext(ctx context.Context) repo.ConversationContainer {
+	return &ConversationContainerDBImp{
+		conversationMapper: c.conversationMapper.WithDB(c.conversationMapper.DB().WithContext(ctx)),
+		messageMapper:      c.messageMapper.WithDB(c.messageMapper.DB().WithContext(ctx)),
+	}
+}
+
+func (c *ConversationContainerDBImp) CreateConversation(conv *model.Conversation) error {
+	err := c.conversationMapper.Insert(conv)
+	if err != nil {
+		return errors.Wrap(err, "create conversation")
+	}
+	return nil
+}
+
+func (c *ConversationContainerDBImp) AddMessages(userId int, convId string, messages ...model.ConversationMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return c.conversationMapper.DB().Transaction(func(tx *gorm.DB) error {
+		conv := model.Conversation{
+			ConversationId: convId,
+			UserId:         userId,
+			Title:          conversationTitle(messages),
+		}
+		_, err := c.conversationMapper.WithDB(tx).FirstOrCreate(&conv,
+			model.Conversation{ConversationId: convId})
+		if err != nil {
+			return errors.Wrap(err, "create conversation")
+		}
+		if len(conv.Title) == 0 {
+			err = c.conversationMapper.WithDB(tx).UpdateTitle(convId, conversationTitle(messages))
+			if err != nil {
+				return errors.Wrap(err, "update title")
+			}
+		}
+		items := make([]*model.ConversationMessage, 0, len(messages))
+		for i := range messages {
+			m := messages[i]
+			m.ConversationId = convId
+			items = append(items, &m)
+		}
+		err = c.messageMapper.WithDB(tx).Insert(items...)
+		if err != nil {
+			return errors.Wrap(err, "insert messages")
+		}
+		err = c.conversationMapper.WithDB(tx).UpdateCurrentNode(convId, items[len(items)-1].MessageId)
+		if err != nil {
+			return errors.Wrap(err, "update current node")
+		}
+		return nil
+	})
+}
+
+func (c *ConversationContainerDBImp) ListConversations(userId int, archived bool) ([]model.Conversation, error) {
+	out, err := c.conversationMapper.ListByUserId(userId, archived)
+	if err != nil {
+		return nil, errors.Wrap(err, "list conversations")
+	}
+	return out, nil
+}
+
+func (c *ConversationContainerDBImp) GetConversation(convId string) (model.Conversation, error) {
+	conv, err := c.conversationMapper.GetByConversationId(convId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return conv, errorcode.ErrNotFound
+	}
+	if err != nil {
+		return conv, errors.Wrap(err, "get conversation")
+	}
+	return conv, nil
+}
+
+func (c *ConversationContainerDBImp) GetMessages(convId string) ([]model.ConversationMessage, error) {
+	out, err := c.messageMapper.ListByConversationId(convId)
+	if err != nil {
+		return nil, errors.Wrap(err, "list messages")
+	}
+	return out, nil
+}
+
+func (c *ConversationContainerDBImp) GetMessage(convId string, messageId string) (model.ConversationMessage, error) {
+	msg, err := c.messageMapper.GetByMessageId(convId, messageId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return msg, errorcode.ErrNotFound
+	}
+	if err != nil {
+		return msg, errors.Wrap(err, "get message")
+	}
+	return msg, nil
+}
+
+func (c *ConversationContainerDBImp) UpdateCurrentNode(convId string, node string) error {
+	return errors.Wrap(c.conversationMapper.UpdateCurrentNode(convId, node), "update current node")
+}
+
+func (c *ConversationContainerDBImp) UpdateTitle(convId string, title string) error {
+	return errors.Wrap(c.conversationMapper.UpdateTitle(convId, title), "update title")
+}
+
+func (c *ConversationContainerDBImp) UpdateArchived(convId string, archived bool) error {
+	return errors.Wrap(c.conversationMapper.UpdateArchived(convId, archived), "update archived")
+}
+
+func (c *ConversationContainerDBImp) UpdateUpstreamId(convId string, upstreamId string) error {
+	return errors.Wrap(c.conversationMapper.UpdateUpstreamId(convId, upstreamId), "update upstream id")
+}
+
+func (c *ConversationContainerDBImp) DeleteConversation(convId string) error {
+	return c.conversationMapper.DB().Transaction(func(tx *gorm.DB) error {
+		_, err := c.messageMapper.WithDB(tx).Delete(model.ConversationMessage{ConversationId: convId})
+		if err != nil {
+			return errors.Wrap(err, "delete messages")
+		}
+		_, err = c.conversationMapper.WithDB(tx).Delete(model.Conversation{ConversationId: convId})
+		if err != nil {
+			return errors.Wrap(err, "delete conversation")
+		}
+		return nil
+	})
+}
@@ -1,36 +1,196 @@
 package infra
 
 import (
+	"context"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/LSDXXX/libs/model"
 	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
 	"github.com/LSDXXX/libs/repo"
-	"github.com/spf13/cast"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
 )
 
+const maxTitleLength = 50
+
 func init() {
 	AppendInitFunc(func() {
+		var db *gorm.DB
+		if container.Resolve(&db) == nil && db != nil {
+			_ = container.Singleton(NewConversationContainerDBImp)
+			return
+		}
 		_ = container.Singleton(NewConversationHandlerImp)
 	})
 }
 
+// conversationTitle title of a new conversation, the beginning of the first user message
+func conversationTitle(messages []model.ConversationMessage) string {
+	for _, m := range messages {
+		if m.Role != "user" {
+			continue
+		}
+		title := []rune(m.Content)
+		if len(title) > maxTitleLength {
+			title = title[:maxTitleLength]
+		}
+		return string(title)
+	}
+	return ""
+}
+
+// ConversationContainerImp in memory container, used when no database is configured
 type ConversationContainerImp struct {
-	conversations sync.Map
+	mu            sync.RWMutex
+	conversations map[string]*model.Conversation
+	messages      map[string][]model.ConversationMessage
 }
 
 func NewConversationHandlerImp() repo.ConversationContainer {
-	return &ConversationContainerImp{}
+	return &ConversationContainerImp{
+		conversations: make(map[string]*model.Conversation),
+		messages:      make(map[string][]model.ConversationMessage),
+	}
 }
 
-func (c *ConversationContainerImp) SetParentId(id, parent string) {
-	c.conversations.Store(id, parent)
+// WithContext the memory store has no io to bound, ctx is not needed
+func (c *ConversationContainerImp) WithContext(context.Context) repo.ConversationContainer {
+	return c
 }
 
 func (c *ConversationContainerImp) Del(id string) {
-	c.conversations.Delete(id)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conversations, id)
+	delete(c.messages, id)
+}
+
+func (c *ConversationContainerImp) CreateConversation(conv *model.Conversation) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.conversations[conv.ConversationId]; ok {
+		return errors.Errorf("conversation %s already exists", conv.ConversationId)
+	}
+	now := time.Now()
+	conv.CreateTime = now
+	conv.UpdateTime = now
+	tmp := *conv
+	c.conversations[conv.ConversationId] = &tmp
+	return nil
+}
+
+func (c *ConversationContainerImp) AddMessages(userId int, convId string, messages ...model.ConversationMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	conv, ok := c.conversations[convId]
+	if !ok {
+		conv = &model.Conversation{ConversationId: convId, CreateTime: now}
+		c.conversations[convId] = conv
+	}
+	if conv.UserId == 0 {
+		conv.UserId = userId
+	}
+	if len(conv.Title) == 0 {
+		conv.Title = conversationTitle(messages)
+	}
+	for _, m := range messages {
+		m.ConversationId = convId
+		m.CreateTime = now
+		c.messages[convId] = append(c.messages[convId], m)
+	}
+	conv.CurrentNode = messages[len(messages)-1].MessageId
+	conv.UpdateTime = now
+	return nil
+}
+
+func (c *ConversationContainerImp) ListConversations(userId int, archived bool) ([]model.Conversation, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out []model.Conversation
+	for _, conv := range c.conversations {
+		if conv.UserId == userId && conv.Archived == archived {
+			out = append(out, *conv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].UpdateTime.After(out[j].UpdateTime)
+	})
+	return out, nil
+}
+
+func (c *ConversationContainerImp) GetConversation(convId string) (model.Conversation, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	conv, ok := c.conversations[convId]
+	if !ok {
+		return model.Conversation{}, errorcode.ErrNotFound
+	}
+	return *conv, nil
+}
+
+func (c *ConversationContainerImp) GetMessages(convId string) ([]model.ConversationMessage, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]model.ConversationMessage(nil), c.messages[convId]...), nil
+}
+
+func (c *ConversationContainerImp) GetMessage(convId string, messageId string) (model.ConversationMessage, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, m := range c.messages[convId] {
+		if m.MessageId == messageId {
+			return m, nil
+		}
+	}
+	return model.ConversationMessage{}, errorcode.ErrNotFound
+}
+
+func (c *ConversationContainerImp) update(convId string, f func(conv *model.Conversation)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conv, ok := c.conversations[convId]
+	if !ok {
+		return errorcode.ErrNotFound
+	}
+	f(conv)
+	return nil
+}
+
+func (c *ConversationContainerImp) UpdateTitle(convId string, title string) error {
+	return c.update(convId, func(conv *model.Conversation) {
+		conv.Title = title
+		conv.UpdateTime = time.Now()
+	})
+}
+
+func (c *ConversationContainerImp) UpdateCurrentNode(convId string, node string) error {
+	return c.update(convId, func(conv *model.Conversation) {
+		conv.CurrentNode = node
+		conv.UpdateTime = time.Now()
+	})
+}
+
+func (c *ConversationContainerImp) UpdateArchived(convId string, archived bool) error {
+	return c.update(convId, func(conv *model.Conversation) {
+		conv.Archived = archived
+		conv.UpdateTime = time.Now()
+	})
+}
+
+func (c *ConversationContainerImp) UpdateUpstreamId(convId string, upstreamId string) error {
+	return c.update(convId, func(conv *model.Conversation) {
+		conv.UpstreamId = upstreamId
+	})
 }
 
-func (c *ConversationContainerImp) GetParentId(id string) (string, bool) {
-	v, ok := c.conversations.Load(id)
-	return cast.ToString(v), ok
+func (c *ConversationContainerImp) DeleteConversation(convId string) error {
+	c.Del(convId)
+	return nil
 }
@@ -0,0 +1,215 @@
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+
+package infra
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/repo"
+)
+
+func init() {
+	AppendInitFunc(func() {
+		_ = container.Singleton(NewConversationMapper)
+	})
+}
+
+type ConversationMapperImp struct {
+	db    *gorm.DB `container:"type"`
+	table string
+}
+
+func NewConversationMapper() repo.ConversationMapper {
+	out := &ConversationMapperImp{
+		table: "conversation",
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (d *ConversationMapperImp) DB() *gorm.DB {
+	return d.db
+}
+
+func (d *ConversationMapperImp) Table() string {
+	return d.table
+}
+
+func (d *ConversationMapperImp) WithTable() *gorm.DB {
+	return d.db.Table(d.table)
+}
+
+func (d *ConversationMapperImp) WithDB(db *gorm.DB) repo.ConversationMapper {
+	return &ConversationMapperImp{
+		db:    db,
+		table: d.table,
+	}
+}
+
+func (d *ConversationMapperImp) Page(page, pageSize int, order string, conds ...model.Conversation) (result []model.Conversation, count int64, err error) {
+
+	db := d.db.Table(d.table)
+	err = db.Count(&count).Error
+	if err != nil {
+		return
+	}
+
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	db = db.Limit(pageSize).Offset((page - 1) * pageSize)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	err = db.Find(&result).Error
+	return
+}
+
+func (d *ConversationMapperImp) Find(conds model.Conversation) (result []model.Conversation, err error) {
+	err = d.db.Table(d.table).Where(conds).Find(&result).Error
+	return
+}
+
+func (d *ConversationMapperImp) Take(order string, conds ...model.Conversation) (result model.Conversation, err error) {
+	db := d.db.Table(d.table).Where(conds)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Take(&result).Error
+	return
+}
+
+func (d *ConversationMapperImp) Count(conds ...model.Conversation) (count int64, err error) {
+	db := d.db.Table(d.table)
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Count(&count).Error
+	return
+}
+
+func (d *ConversationMapperImp) Insert(items ...*model.Conversation) error {
+	return d.db.Table(d.table).Create(&items).Error
+}
+
+func (d *ConversationMapperImp) InsertInBatches(items []*model.Conversation, size int) error {
+	return d.db.Table(d.table).CreateInBatches(&items, size).Error
+}
+
+func (d *ConversationMapperImp) UpdateOrCreate(update *model.Conversation, conds model.Conversation) error {
+	return d.DB().Table(d.table).
+		Where(conds).
+		Assign(*update).
+		FirstOrCreate(update).Error
+}
+
+func (d *ConversationMapperImp) Updates(updates *model.Conversation, conds model.Conversation) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Updates(updates)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ConversationMapperImp) FirstOrCreate(insert *model.Conversation, conds model.Conversation) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).
+		Where(conds).
+		Attrs(*insert).
+		FirstOrCreate(insert)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ConversationMapperImp) Delete(conds model.Conversation) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Delete(&model.Conversation{})
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ConversationMapperImp) GetByConversationId(convId string) (res model.Conversation, err error) {
+	params := map[string]interface{}{
+		"convId": convId,
+	}
+	var generateSQL string
+	generateSQL += "select * from conversation where conversation_id = @convId"
+
+	executeSQL := d.DB().Raw(generateSQL, params).Take(&res)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ConversationMapperImp) ListByUserId(userId int, archived bool) (res []model.Conversation, err error) {
+	params := map[string]interface{}{
+		"userId":   userId,
+		"archived": archived,
+	}
+	var generateSQL string
+	generateSQL += "select * from conversation where user_id = @userId and archived = @archived order by update_time desc "
+
+	executeSQL := d.DB().Raw(generateSQL, params).Find(&res)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ConversationMapperImp) UpdateCurrentNode(convId string, node string) (err error) {
+	params := map[string]interface{}{
+		"node":   node,
+		"convId": convId,
+	}
+	var generateSQL string
+	generateSQL += "update conversation set current_node = @node, update_time = now() where conversation_id = @convId"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ConversationMapperImp) UpdateTitle(convId string, title string) (err error) {
+	params := map[string]interface{}{
+		"title":  title,
+		"convId": convId,
+	}
+	var generateSQL string
+	generateSQL += "update conversation set title = @title, update_time = now() where conversation_id = @convId"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ConversationMapperImp) UpdateArchived(convId string, archived bool) (err error) {
+	params := map[string]interface{}{
+		"archived": archived,
+		"convId":   convId,
+	}
+	var generateSQL string
+	generateSQL += "update conversation set archived = @archived, update_time = now() where conversation_id = @convId"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ConversationMapperImp) UpdateUpstreamId(convId string, upstreamId string) (err error) {
+	params := map[string]interface{}{
+		"upstreamId": upstreamId,
+		"convId":     convId,
+	}
+	var generateSQL string
+	generateSQL += "update conversation set upstream_id = @upstreamId where conversation_id = @convId"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
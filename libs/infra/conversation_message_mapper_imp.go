@@ -0,0 +1,163 @@
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+
+package infra
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/repo"
+)
+
+func init() {
+	AppendInitFunc(func() {
+		_ = container.Singleton(NewConversationMessageMapper)
+	})
+}
+
+type ConversationMessageMapperImp struct {
+	db    *gorm.DB `container:"type"`
+	table string
+}
+
+func NewConversationMessageMapper() repo.ConversationMessageMapper {
+	out := &ConversationMessageMapperImp{
+		table: "conversation_message",
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (d *ConversationMessageMapperImp) DB() *gorm.DB {
+	return d.db
+}
+
+func (d *ConversationMessageMapperImp) Table() string {
+	return d.table
+}
+
+func (d *ConversationMessageMapperImp) WithTable() *gorm.DB {
+	return d.db.Table(d.table)
+}
+
+func (d *ConversationMessageMapperImp) WithDB(db *gorm.DB) repo.ConversationMessageMapper {
+	return &ConversationMessageMapperImp{
+		db:    db,
+		table: d.table,
+	}
+}
+
+func (d *ConversationMessageMapperImp) Page(page, pageSize int, order string, conds ...model.ConversationMessage) (result []model.ConversationMessage, count int64, err error) {
+
+	db := d.db.Table(d.table)
+	err = db.Count(&count).Error
+	if err != nil {
+		return
+	}
+
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	db = db.Limit(pageSize).Offset((page - 1) * pageSize)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	err = db.Find(&result).Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) Find(conds model.ConversationMessage) (result []model.ConversationMessage, err error) {
+	err = d.db.Table(d.table).Where(conds).Find(&result).Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) Take(order string, conds ...model.ConversationMessage) (result model.ConversationMessage, err error) {
+	db := d.db.Table(d.table).Where(conds)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Take(&result).Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) Count(conds ...model.ConversationMessage) (count int64, err error) {
+	db := d.db.Table(d.table)
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Count(&count).Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) Insert(items ...*model.ConversationMessage) error {
+	return d.db.Table(d.table).Create(&items).Error
+}
+
+func (d *ConversationMessageMapperImp) InsertInBatches(items []*model.ConversationMessage, size int) error {
+	return d.db.Table(d.table).CreateInBatches(&items, size).Error
+}
+
+func (d *ConversationMessageMapperImp) UpdateOrCreate(update *model.ConversationMessage, conds model.ConversationMessage) error {
+	return d.DB().Table(d.table).
+		Where(conds).
+		Assign(*update).
+		FirstOrCreate(update).Error
+}
+
+func (d *ConversationMessageMapperImp) Updates(updates *model.ConversationMessage, conds model.ConversationMessage) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Updates(updates)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) FirstOrCreate(insert *model.ConversationMessage, conds model.ConversationMessage) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).
+		Where(conds).
+		Attrs(*insert).
+		FirstOrCreate(insert)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) Delete(conds model.ConversationMessage) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Delete(&model.ConversationMessage{})
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) ListByConversationId(convId string) (res []model.ConversationMessage, err error) {
+	params := map[string]interface{}{
+		"convId": convId,
+	}
+	var generateSQL string
+	generateSQL += "select * from conversation_message where conversation_id = @convId order by id "
+
+	executeSQL := d.DB().Raw(generateSQL, params).Find(&res)
+	err = executeSQL.Error
+	return
+}
+
+func (d *ConversationMessageMapperImp) GetByMessageId(convId string, messageId string) (res model.ConversationMessage, err error) {
+	params := map[string]interface{}{
+		"convId":    convId,
+		"messageId": messageId,
+	}
+	var generateSQL string
+	generateSQL += "select * from conversation_message where conversation_id = @convId and message_id = @messageId"
+
+	executeSQL := d.DB().Raw(generateSQL, params).Take(&res)
+	err = executeSQL.Error
+	return
+}
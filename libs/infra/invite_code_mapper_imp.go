@@ -0,0 +1,151 @@
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+// Code generated by crudgen DO NOT EDIT.
+
+package infra
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/repo"
+)
+
+func init() {
+	AppendInitFunc(func() {
+		_ = container.Singleton(NewInviteCodeMapper)
+	})
+}
+
+type InviteCodeMapperImp struct {
+	db    *gorm.DB `container:"type"`
+	table string
+}
+
+func NewInviteCodeMapper() repo.InviteCodeMapper {
+	out := &InviteCodeMapperImp{
+		table: "invite_code",
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (d *InviteCodeMapperImp) DB() *gorm.DB {
+	return d.db
+}
+
+func (d *InviteCodeMapperImp) Table() string {
+	return d.table
+}
+
+func (d *InviteCodeMapperImp) WithTable() *gorm.DB {
+	return d.db.Table(d.table)
+}
+
+func (d *InviteCodeMapperImp) WithDB(db *gorm.DB) repo.InviteCodeMapper {
+	return &InviteCodeMapperImp{
+		db:    db,
+		table: d.table,
+	}
+}
+
+func (d *InviteCodeMapperImp) Page(page, pageSize int, order string, conds ...model.InviteCode) (result []model.InviteCode, count int64, err error) {
+
+	db := d.db.Table(d.table)
+	err = db.Count(&count).Error
+	if err != nil {
+		return
+	}
+
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	db = db.Limit(pageSize).Offset((page - 1) * pageSize)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	err = db.Find(&result).Error
+	return
+}
+
+func (d *InviteCodeMapperImp) Find(conds model.InviteCode) (result []model.InviteCode, err error) {
+	err = d.db.Table(d.table).Where(conds).Find(&result).Error
+	return
+}
+
+func (d *InviteCodeMapperImp) Take(order string, conds ...model.InviteCode) (result model.InviteCode, err error) {
+	db := d.db.Table(d.table).Where(conds)
+	if len(order) > 0 {
+		db = db.Order(order)
+	}
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Take(&result).Error
+	return
+}
+
+func (d *InviteCodeMapperImp) Count(conds ...model.InviteCode) (count int64, err error) {
+	db := d.db.Table(d.table)
+	if len(conds) > 0 {
+		db = db.Where(conds[0])
+	}
+	err = db.Count(&count).Error
+	return
+}
+
+func (d *InviteCodeMapperImp) Insert(items ...*model.InviteCode) error {
+	return d.db.Table(d.table).Create(&items).Error
+}
+
+func (d *InviteCodeMapperImp) InsertInBatches(items []*model.InviteCode, size int) error {
+	return d.db.Table(d.table).CreateInBatches(&items, size).Error
+}
+
+func (d *InviteCodeMapperImp) UpdateOrCreate(update *model.InviteCode, conds model.InviteCode) error {
+	return d.DB().Table(d.table).
+		Where(conds).
+		Assign(*update).
+		FirstOrCreate(update).Error
+}
+
+func (d *InviteCodeMapperImp) Updates(updates *model.InviteCode, conds model.InviteCode) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Updates(updates)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *InviteCodeMapperImp) FirstOrCreate(insert *model.InviteCode, conds model.InviteCode) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).
+		Where(conds).
+		Attrs(*insert).
+		FirstOrCreate(insert)
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *InviteCodeMapperImp) Delete(conds model.InviteCode) (rowsAffected int64, err error) {
+	res := d.db.Table(d.table).Where(conds).Delete(&model.InviteCode{})
+	rowsAffected = res.RowsAffected
+	err = res.Error
+	return
+}
+
+func (d *InviteCodeMapperImp) UseCode(code string) (rowsAffected int64, err error) {
+	params := map[string]interface{}{
+		"code": code,
+	}
+	var generateSQL string
+	generateSQL += "update invite_code set uses = uses + 1 where code = @code and uses < max_uses "
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	rowsAffected = executeSQL.RowsAffected
+	err = executeSQL.Error
+	return
+}
@@ -0,0 +1,78 @@
+package infra
+
+import (
+	"sync"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/go-redis/redis/v8"
+)
+
+func init() {
+	AppendInitFunc(func() {
+		var client redis.Cmdable
+		if container.Resolve(&client) == nil && client != nil {
+			_ = container.Singleton(NewRateLimitStoreRedisImp)
+			return
+		}
+		_ = container.Singleton(NewRateLimitStoreImp)
+	})
+}
+
+type counter struct {
+	value    int64
+	expireAt time.Time
+}
+
+// RateLimitStoreImp in memory store, used when no redis is configured,
+// limits are enforced per instance
+type RateLimitStoreImp struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	// sweepAt next time expired counters are dropped
+	sweepAt time.Time
+}
+
+func NewRateLimitStoreImp() repo.RateLimitStore {
+	return &RateLimitStoreImp{
+		counters: make(map[string]*counter),
+	}
+}
+
+func (s *RateLimitStoreImp) Incr(key string, delta int64, ttl time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	c := s.counter(key, now, ttl)
+	c.value += delta
+	return c.value, c.expireAt.Sub(now), nil
+}
+
+func (s *RateLimitStoreImp) IncrExpire(key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	c := s.counter(key, now, ttl)
+	c.value += delta
+	c.expireAt = now.Add(ttl)
+	return c.value, nil
+}
+
+// counter the live counter of key, created with ttl when missing
+func (s *RateLimitStoreImp) counter(key string, now time.Time, ttl time.Duration) *counter {
+	if now.After(s.sweepAt) {
+		for k, c := range s.counters {
+			if !now.Before(c.expireAt) {
+				delete(s.counters, k)
+			}
+		}
+		s.sweepAt = now.Add(time.Minute)
+	}
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expireAt) {
+		c = &counter{expireAt: now.Add(ttl)}
+		s.counters[key] = c
+	}
+	return c
+}
@@ -0,0 +1,60 @@
+package infra
+
+import (
+	"context"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// incrScript incrby and set the ttl of a new key in one round trip,
+// returns the value and the ttl left in milliseconds
+var incrScript = redis.NewScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	ttl = tonumber(ARGV[2])
+end
+return {v, ttl}
+`)
+
+// incrExpireScript incrby and reset the ttl in one round trip
+var incrExpireScript = redis.NewScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return v
+`)
+
+// RateLimitStoreRedisImp store shared by all instances
+type RateLimitStoreRedisImp struct {
+	client redis.Cmdable `container:"type"`
+}
+
+func NewRateLimitStoreRedisImp() repo.RateLimitStore {
+	out := &RateLimitStoreRedisImp{}
+	util.PanicWhenError(container.Fill(out))
+	return out
+}
+
+func (s *RateLimitStoreRedisImp) Incr(key string, delta int64, ttl time.Duration) (int64, time.Duration, error) {
+	res, err := incrScript.Run(context.Background(), s.client, []string{key},
+		delta, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "incr rate limit counter")
+	}
+	return res[0], time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func (s *RateLimitStoreRedisImp) IncrExpire(key string, delta int64, ttl time.Duration) (int64, error) {
+	n, err := incrExpireScript.Run(context.Background(), s.client, []string{key},
+		delta, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, errors.Wrap(err, "incr rate limit counter")
+	}
+	return n, nil
+}
@@ -0,0 +1,65 @@
+package infra
+
+import (
+	"sync"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/go-redis/redis/v8"
+)
+
+func init() {
+	AppendInitFunc(func() {
+		var client redis.Cmdable
+		if container.Resolve(&client) == nil && client != nil {
+			_ = container.Singleton(NewTokenDenylistRedisImp)
+			return
+		}
+		_ = container.Singleton(NewTokenDenylistImp)
+	})
+}
+
+// TokenDenylistImp in memory denylist, used when no redis is configured,
+// revocations are only known to this instance
+type TokenDenylistImp struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	// sweepAt next time expired ids are dropped
+	sweepAt time.Time
+}
+
+func NewTokenDenylistImp() repo.TokenDenylist {
+	return &TokenDenylistImp{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (d *TokenDenylistImp) Revoke(jti string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.After(d.sweepAt) {
+		for id, expireAt := range d.revoked {
+			if !now.Before(expireAt) {
+				delete(d.revoked, id)
+			}
+		}
+		d.sweepAt = now.Add(time.Minute)
+	}
+	if expireAt, ok := d.revoked[jti]; ok && now.Before(expireAt) {
+		return true, nil
+	}
+	d.revoked[jti] = now.Add(ttl)
+	return false, nil
+}
+
+func (d *TokenDenylistImp) IsRevoked(jti string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	expireAt, ok := d.revoked[jti]
+	return ok && time.Now().Before(expireAt), nil
+}
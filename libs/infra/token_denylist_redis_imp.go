@@ -0,0 +1,44 @@
+package infra
+
+import (
+	"context"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+const denylistKeyPrefix = "token_denylist:"
+
+// TokenDenylistRedisImp denylist shared by all instances
+type TokenDenylistRedisImp struct {
+	client redis.Cmdable `container:"type"`
+}
+
+func NewTokenDenylistRedisImp() repo.TokenDenylist {
+	out := &TokenDenylistRedisImp{}
+	util.PanicWhenError(container.Fill(out))
+	return out
+}
+
+func (d *TokenDenylistRedisImp) Revoke(jti string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, nil
+	}
+	ok, err := d.client.SetNX(context.Background(), denylistKeyPrefix+jti, 1, ttl).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "revoke token")
+	}
+	return !ok, nil
+}
+
+func (d *TokenDenylistRedisImp) IsRevoked(jti string) (bool, error) {
+	n, err := d.client.Exists(context.Background(), denylistKeyPrefix+jti).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "check revoked token")
+	}
+	return n > 0, nil
+}
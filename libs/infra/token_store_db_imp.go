@@ -0,0 +1,39 @@
+package infra
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// TokenStoreDBImp tokens kept in the auth_token table
+type TokenStoreDBImp struct {
+	mapper repo.AuthTokenMapper `container:"type"`
+}
+
+func NewTokenStoreDBImp() repo.TokenStore {
+	out := &TokenStoreDBImp{}
+	util.PanicWhenError(container.Fill(out))
+	return out
+}
+
+func (s *TokenStoreDBImp) GetToken(account string) (model.AuthToken, error) {
+	token, err := s.mapper.GetByAccount(account)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return token, errorcode.ErrNotFound
+	}
+	if err != nil {
+		return token, errors.Wrap(err, "get token")
+	}
+	return token, nil
+}
+
+func (s *TokenStoreDBImp) SaveToken(token model.AuthToken) error {
+	token.Id = 0
+	err := s.mapper.UpdateOrCreate(&token, model.AuthToken{Account: token.Account})
+	return errors.Wrap(err, "save token")
+}
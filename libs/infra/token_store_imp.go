@@ -0,0 +1,85 @@
+package infra
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/pkg/errors"
+)
+
+// TokenStoreFileImp tokens of all accounts in one json file, for single
+// instance deployments
+type TokenStoreFileImp struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewTokenStoreFileImp(path string) repo.TokenStore {
+	return &TokenStoreFileImp{path: path}
+}
+
+func (s *TokenStoreFileImp) load() (map[string]model.AuthToken, error) {
+	out := make(map[string]model.AuthToken)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read token file")
+	}
+	if len(data) == 0 {
+		return out, nil
+	}
+	if err = json.Unmarshal(data, &out); err != nil {
+		return nil, errors.Wrap(err, "decode token file")
+	}
+	return out, nil
+}
+
+func (s *TokenStoreFileImp) GetToken(account string) (model.AuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return model.AuthToken{}, err
+	}
+	token, ok := tokens[account]
+	if !ok {
+		return model.AuthToken{}, errorcode.ErrNotFound
+	}
+	return token, nil
+}
+
+func (s *TokenStoreFileImp) SaveToken(token model.AuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	tokens[token.Account] = token
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode token file")
+	}
+	// write aside and rename, a crash never leaves a truncated file
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "create token file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write token file")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "write token file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), s.path), "replace token file")
+}
@@ -0,0 +1,63 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+const tokenKeyPrefix = "auth_token:"
+
+// TokenStoreRedisImp store shared by all instances, a key lives as long
+// as the longest lived token it holds
+type TokenStoreRedisImp struct {
+	client redis.Cmdable `container:"type"`
+}
+
+func NewTokenStoreRedisImp() repo.TokenStore {
+	out := &TokenStoreRedisImp{}
+	util.PanicWhenError(container.Fill(out))
+	return out
+}
+
+func (s *TokenStoreRedisImp) GetToken(account string) (model.AuthToken, error) {
+	var out model.AuthToken
+	data, err := s.client.Get(context.Background(), tokenKeyPrefix+account).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return out, errorcode.ErrNotFound
+	}
+	if err != nil {
+		return out, errors.Wrap(err, "get token")
+	}
+	if err = json.Unmarshal(data, &out); err != nil {
+		return out, errors.Wrap(err, "decode token")
+	}
+	return out, nil
+}
+
+func (s *TokenStoreRedisImp) SaveToken(token model.AuthToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "encode token")
+	}
+	expireAt := token.SessionExpire
+	if token.AccessExpire > expireAt {
+		expireAt = token.AccessExpire
+	}
+	var ttl time.Duration
+	if expireAt > 0 {
+		if ttl = time.Until(time.Unix(expireAt, 0)); ttl <= 0 {
+			return nil
+		}
+	}
+	err = s.client.Set(context.Background(), tokenKeyPrefix+token.Account, data, ttl).Err()
+	return errors.Wrap(err, "set token")
+}
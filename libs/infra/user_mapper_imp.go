@@ -148,3 +148,55 @@ func (d *UserMapperImp) GetByUserName(name string) (res model.User, err error) {
 	err = executeSQL.Error
 	return
 }
+
+func (d *UserMapperImp) GetById(id int) (res model.User, err error) {
+	params := map[string]interface{}{
+		"id": id,
+	}
+	var generateSQL string
+	generateSQL += "select * from user where id = @id"
+
+	executeSQL := d.DB().Raw(generateSQL, params).Take(&res)
+	err = executeSQL.Error
+	return
+}
+
+func (d *UserMapperImp) SetPassword(id int, password string) (err error) {
+	params := map[string]interface{}{
+		"password": password,
+		"id":       id,
+	}
+	var generateSQL string
+	generateSQL += "update user set password = @password, password_legacy = 0 where id = @id"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
+
+func (d *UserMapperImp) UpdateProfile(id int, nickname string, email string) (err error) {
+	params := map[string]interface{}{
+		"nickname": nickname,
+		"email":    email,
+		"id":       id,
+	}
+	var generateSQL string
+	generateSQL += "update user set nickname = @nickname, email = @email where id = @id"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
+
+func (d *UserMapperImp) UpdateDisabled(id int, disabled bool) (err error) {
+	params := map[string]interface{}{
+		"disabled": disabled,
+		"id":       id,
+	}
+	var generateSQL string
+	generateSQL += "update user set disabled = @disabled where id = @id"
+
+	executeSQL := d.DB().Exec(generateSQL, params)
+	err = executeSQL.Error
+	return
+}
@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+const (
+	// ApiKeyPrefix prefix of every api key, tells keys and jwts apart
+	ApiKeyPrefix = "sk-"
+
+	// ScopeAsk may use the http conversation api
+	ScopeAsk = "ask"
+	// ScopeChat may use the chat websocket
+	ScopeChat = "chat"
+	// ScopeAdmin may use the admin api if the owner is an admin
+	ScopeAdmin = "admin"
+)
+
+// ScopePermissions permissions allowed by each scope, a key never has
+// more permissions than the role of its owner
+var ScopePermissions = map[string][]string{
+	ScopeAsk:   {PermChat},
+	ScopeChat:  {PermChatWS},
+	ScopeAdmin: {PermUserManage, PermAccountManage},
+}
+
+// ApiKey key for programmatic access, only the sha256 of the key is stored
+type ApiKey struct {
+	Id     int    `json:"id"`
+	UserId int    `gorm:"column:user_id" json:"user_id"`
+	Name   string `gorm:"column:name" json:"name"`
+	// Prefix first characters of the key, shown to tell keys apart
+	Prefix       string     `gorm:"column:prefix" json:"prefix"`
+	KeyHash      string     `gorm:"column:key_hash" json:"-"`
+	Scopes       []string   `gorm:"column:scopes;serializer:json" json:"scopes"`
+	LastUsedTime *time.Time `gorm:"column:last_used_time" json:"last_used_time"`
+	CreateTime   time.Time  `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+}
+
+// HasScope whether the key was granted the scope
+//
+//	@receiver k
+//	@param scope
+//	@return bool
+func (k ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// AuthToken cached upstream session of an account, expiries are unix
+// seconds, zero when unknown
+type AuthToken struct {
+	Id            int       `json:"-"`
+	Account       string    `gorm:"column:account" json:"account"`
+	SessionToken  string    `gorm:"column:session_token" json:"session_token"`
+	SessionExpire int64     `gorm:"column:session_expire" json:"session_expire"`
+	AccessToken   string    `gorm:"column:access_token" json:"access_token"`
+	AccessExpire  int64     `gorm:"column:access_expire" json:"access_expire"`
+	UpdateTime    time.Time `gorm:"column:update_time;autoUpdateTime" json:"update_time"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// Conversation conversation owned by a user, UpstreamId is the id
+// assigned by the llm backend on the first answer
+type Conversation struct {
+	Id             int       `json:"-"`
+	ConversationId string    `gorm:"column:conversation_id" json:"conversation_id"`
+	UserId         int       `gorm:"column:user_id" json:"user_id"`
+	Title          string    `gorm:"column:title" json:"title"`
+	UpstreamId     string    `gorm:"column:upstream_id" json:"-"`
+	CurrentNode    string    `gorm:"column:current_node" json:"current_node"`
+	Archived       bool      `gorm:"column:archived" json:"archived"`
+	CreateTime     time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+	UpdateTime     time.Time `gorm:"column:update_time;autoUpdateTime" json:"update_time"`
+}
+
+// ConversationMessage one message of a conversation, ParentId links
+// the messages into a tree
+type ConversationMessage struct {
+	Id             int       `json:"-"`
+	MessageId      string    `gorm:"column:message_id" json:"message_id"`
+	ConversationId string    `gorm:"column:conversation_id" json:"conversation_id"`
+	ParentId       string    `gorm:"column:parent_id" json:"parent_id"`
+	Role           string    `gorm:"column:role" json:"role"`
+	Content        string    `gorm:"column:content" json:"content"`
+	ModelSlug      string    `gorm:"column:model_slug" json:"model_slug"`
+	FinishReason   string    `gorm:"column:finish_reason" json:"finish_reason"`
+	CreateTime     time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+}
+
+// MessageNode message with the ids of its children
+type MessageNode struct {
+	ConversationMessage
+	Children []string `json:"children"`
+}
+
+// ConversationDetail conversation with the whole message tree
+type ConversationDetail struct {
+	Conversation
+	Messages []MessageNode `json:"messages"`
+}
+
+// ConversationTurn prompt about to be sent and its place in the message tree
+type ConversationTurn struct {
+	Conversation *Conversation
+	// Prompt user message, ParentId is the message it replies to
+	Prompt ConversationMessage
+	// Variant the prompt is already stored, only another answer is added to it
+	Variant bool
+}
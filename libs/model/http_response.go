@@ -69,10 +69,20 @@ func WithError(err error, data ...interface{}) ResponseOption {
 		res.Message = err.Error()
 		if len(data) == 1 {
 			res.ErrData = data[0]
+			return
+		}
+		var hint errData
+		if errors.As(err, &hint) {
+			res.ErrData = hint.ErrData()
 		}
 	}
 }
 
+// errData error carrying details for clients, e.g. errorcode.RetryError
+type errData interface {
+	ErrData() interface{}
+}
+
 // NewResponse create http response
 func NewResponse(opts ...ResponseOption) *Response {
 	res := &Response{
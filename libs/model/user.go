@@ -1,7 +1,57 @@
 package model
 
+import "time"
+
+const (
+	// RoleUser regular user
+	RoleUser = "user"
+	// RoleAdmin may use the admin api
+	RoleAdmin = "admin"
+)
+
+const (
+	// PermChat may talk to the bot and manage the own conversations
+	PermChat = "chat"
+	// PermChatWS may talk to the bot through the chat websocket
+	PermChatWS = "chat:ws"
+	// PermUserManage may list, disable and reset other users
+	PermUserManage = "user:manage"
+	// PermAccountManage may inspect the web account pool
+	PermAccountManage = "account:manage"
+)
+
+// RolePermissions permissions granted to each role
+var RolePermissions = map[string][]string{
+	RoleUser:  {PermChat, PermChatWS},
+	RoleAdmin: {PermChat, PermChatWS, PermUserManage, PermAccountManage},
+}
+
 type User struct {
-	Id       int
-	UserName string `gorm:"column:user_name"`
-	Password string `gorm:"column:password"`
+	Id       int    `json:"id"`
+	UserName string `gorm:"column:name" json:"user_name"`
+	// Password argon2id or bcrypt hash, plain text when PasswordLegacy
+	Password       string    `gorm:"column:password" json:"-"`
+	PasswordLegacy bool      `gorm:"column:password_legacy" json:"-"`
+	Nickname       string    `gorm:"column:nickname" json:"nickname"`
+	Email          string    `gorm:"column:email" json:"email"`
+	Role           string    `gorm:"column:role" json:"role"`
+	Disabled       bool      `gorm:"column:disabled" json:"disabled"`
+	CreateTime     time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+	UpdateTime     time.Time `gorm:"column:update_time;autoUpdateTime" json:"update_time"`
+}
+
+// UserPage one page of users
+type UserPage struct {
+	Total int64  `json:"total"`
+	Users []User `json:"users"`
+}
+
+// InviteCode code allowing MaxUses sign ups
+type InviteCode struct {
+	Id         int       `json:"-"`
+	Code       string    `gorm:"column:code" json:"code"`
+	CreatedBy  int       `gorm:"column:created_by" json:"created_by"`
+	MaxUses    int       `gorm:"column:max_uses" json:"max_uses"`
+	Uses       int       `gorm:"column:uses" json:"uses"`
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`
 }
@@ -794,7 +794,7 @@ func (m *MethodParser) parseDoc() string {
 				log.Fatalf("incomplete sql @RowsAffected define, struct: %s,method: %s",
 					m.StructName, m.MethodName)
 			}
-			name := strings.TrimSpace(line[12:end])
+			name := strings.TrimSpace(line[len("@RowsAffected("):end])
 			p, ok := findParamByName(m.Params, name)
 			if ok {
 				m.RowsAffected = &p
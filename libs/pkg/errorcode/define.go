@@ -5,6 +5,9 @@ import "errors"
 var (
 	defines map[error]int
 
+	// codes sentinel error of a code, see FromCode
+	codes map[int]error
+
 	// ErrUnknownError .
 	ErrUnknownError = errors.New("未知参数")
 
@@ -23,6 +26,30 @@ var (
 	// ErrNotFound .
 	ErrNotFound = errors.New("资源不存在")
 
+	// ErrForbidden resource owned by others
+	ErrForbidden = errors.New("无权访问该资源")
+
+	// ErrTooManyRequests request rate or concurrency limit reached
+	ErrTooManyRequests = errors.New("请求过于频繁")
+
+	// ErrQuotaExceeded daily quota used up
+	ErrQuotaExceeded = errors.New("额度已用完")
+
+	// ErrInvalidCredentials wrong user name or password
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+	// ErrUserExists user name taken
+	ErrUserExists = errors.New("用户名已存在")
+
+	// ErrInvalidInviteCode invite code unknown or used up
+	ErrInvalidInviteCode = errors.New("邀请码无效")
+
+	// ErrUserDisabled user disabled by an admin
+	ErrUserDisabled = errors.New("用户已被禁用")
+
+	// ErrUnauthorized request without a logged in user
+	ErrUnauthorized = errors.New("用户未登录")
+
 	// ErrInternalServerError .
 	ErrInternalServerError = errors.New("内部服务器错误或异常")
 
@@ -147,6 +174,15 @@ func init() {
 		ErrNotImplemented:       1102035,
 		ErrNoWorker:             1102036,
 		ErrInvalidSignature:     1102037,
+		ErrForbidden:            1102038,
+		ErrTooManyRequests:      1102039,
+		ErrQuotaExceeded:        1102040,
+		ErrInvalidCredentials:   1102041,
+		ErrUserExists:           1102042,
+		ErrInvalidInviteCode:    1102043,
+		ErrUserDisabled:         1102044,
+		ErrUnauthorized:         1102045,
+		ErrHTTPRequestTimeOut:   1102046,
 
 		ErrMissingDBConnector:    1200001,
 		ErrFlowNeedsToBeDeployed: 1200002,
@@ -155,6 +191,12 @@ func init() {
 		ErrFlowIsNotDeployed: 30003,
 		ErrInvalidNodeConfig: 30004,
 	}
+	codes = make(map[int]error, len(defines))
+	for err, code := range defines {
+		codes[code] = err
+	}
+	// ErrNoWorker shares the code of ErrServiceUnavailable
+	codes[defines[ErrServiceUnavailable]] = ErrServiceUnavailable
 }
 
 // Code get error code
@@ -171,5 +213,9 @@ func Code(err error) int {
 	if code, ok := defines[err]; ok {
 		return code
 	}
+	// unknown code answered by another service
+	if remote, ok := err.(*RemoteError); ok {
+		return remote.Code
+	}
 	return -1
 }
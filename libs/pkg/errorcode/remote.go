@@ -0,0 +1,33 @@
+package errorcode
+
+// RemoteError error code and message answered by another service
+type RemoteError struct {
+	err     error
+	Code    int
+	Message string
+}
+
+// FromCode error of a response code, the sentinel defining the code is kept
+// as the cause so errors.Is still matches it
+//
+//	@param code
+//	@param message
+//	@return error nil when code is 0
+func FromCode(code int, message string) error {
+	if code == 0 {
+		return nil
+	}
+	err := codes[code]
+	if err != nil && len(message) == 0 {
+		message = err.Error()
+	}
+	return &RemoteError{err: err, Code: code, Message: message}
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.err
+}
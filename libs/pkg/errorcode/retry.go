@@ -0,0 +1,36 @@
+package errorcode
+
+import (
+	"math"
+	"time"
+)
+
+// RetryError error of a request that may succeed when sent again later
+type RetryError struct {
+	err        error
+	RetryAfter time.Duration
+}
+
+// WithRetryAfter attach a retry hint to err, the code of err is kept
+//
+//	@param err
+//	@param after
+//	@return error
+func WithRetryAfter(err error, after time.Duration) error {
+	return &RetryError{err: err, RetryAfter: after}
+}
+
+func (e *RetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.err
+}
+
+// ErrData hint returned to clients, retry_after in seconds
+func (e *RetryError) ErrData() interface{} {
+	return map[string]int64{
+		"retry_after": int64(math.Ceil(e.RetryAfter.Seconds())),
+	}
+}
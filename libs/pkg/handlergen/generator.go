@@ -21,6 +21,9 @@ type Config struct {
 	HelperPackage    string
 	OutputPath       string
 	Imports          []string
+	// OpenAPIPath openapi document the operations are merged into, empty
+	// skips it
+	OpenAPIPath string
 }
 
 type Generator struct {
@@ -51,6 +54,11 @@ type structTmpl struct {
 	Services             []paramWrapper
 	RootPath             string
 	Parsers              []MethodParser
+	// Complete every method has a route, so the client implements the
+	// interface
+	Complete bool
+	// GrpcServiceName <package>.<interface>
+	GrpcServiceName string
 }
 
 func (g *Generator) Generate(p *Parser, conf Config) error {
@@ -61,17 +69,30 @@ func (g *Generator) Generate(p *Parser, conf Config) error {
 	impStructDefine := template.Must(template.New("impStructDefine").Parse(ImpStructDefineTemplate))
 	wrapperFunc := template.Must(template.New("wrapperFunc").Parse(WrapperFuncTemplate))
 	impFunc := template.Must(template.New("impFunc").Parse(ImpFuncTemplate))
+	clientStructDefine := template.Must(template.New("clientStructDefine").Parse(ClientStructDefineTemplate))
+	clientFunc := template.Must(template.New("clientFunc").Parse(ClientFuncTemplate))
+	grpcStructDefine := template.Must(template.New("grpcStructDefine").Parse(GrpcStructDefineTemplate))
+	grpcFunc := template.Must(template.New("grpcFunc").Parse(GrpcFuncTemplate))
+	kafkaStructDefine := template.Must(template.New("kafkaStructDefine").Parse(KafkaStructDefineTemplate))
+	kafkaFunc := template.Must(template.New("kafkaFunc").Parse(KafkaFuncTemplate))
 	conf.Imports = p.visitor.imports
 
+	var apis []openAPIInterface
 	for _, idefine := range p.visitor.defines {
 		buf := bytes.NewBuffer(nil)
 		impBuf := bytes.NewBuffer(nil)
+		clientBuf := bytes.NewBuffer(nil)
 		errorLog(execute(notEdit, buf, ""))
 		errorLog(execute(importHeader, buf, conf))
 		errorLog(execute(importHeader, impBuf, conf))
+		errorLog(execute(notEdit, clientBuf, ""))
+		errorLog(execute(importHeader, clientBuf, conf))
 
 		wrapperFile := toSnakeStyle(idefine.Name+"Wrapper") + ".gen.go"
 		impFile := toSnakeStyle(idefine.Name+"Func") + ".example"
+		clientFile := toSnakeStyle(idefine.Name+"Client") + ".gen.go"
+		grpcFile := toSnakeStyle(idefine.Name+"Grpc") + ".gen.go"
+		kafkaFile := toSnakeStyle(idefine.Name+"Kafka") + ".gen.go"
 		splits := strings.Split(conf.InterfacePackage, "/")
 		var parsers []MethodParser
 		for _, m := range idefine.Methods {
@@ -82,11 +103,24 @@ func (g *Generator) Generate(p *Parser, conf Config) error {
 				Results:       m.Results,
 				Doc:           m.Doc,
 				FuncDefine:    m.Define,
+
+				GrpcServiceName: conf.Package + "." + idefine.Name,
 			}
 			err := mp.Parse()
 			if err != nil {
 				return err
 			}
+			if !mp.HasRequireRoles() {
+				mp.RequireRoles = idefine.RequireRoles
+			}
+			if !mp.HasRequirePermissions() {
+				mp.RequirePermissions = idefine.RequirePermissions
+			}
+			// the first match wins, so the method's own statuses go first
+			mp.ErrorStatuses = append(mp.ErrorStatuses, idefine.ErrorStatuses...)
+			if err = mp.checkTransports(); err != nil {
+				return err
+			}
 			parsers = append(parsers, mp)
 		}
 		sTmpl := structTmpl{
@@ -96,6 +130,14 @@ func (g *Generator) Generate(p *Parser, conf Config) error {
 			Model:                &idefine.Model,
 			RootPath:             idefine.RootPath,
 			Parsers:              parsers,
+			Complete:             true,
+			GrpcServiceName:      conf.Package + "." + idefine.Name,
+		}
+		hasGrpc, hasKafka := false, false
+		for _, mp := range parsers {
+			sTmpl.Complete = sTmpl.Complete && mp.HasRequestMapping()
+			hasGrpc = hasGrpc || mp.IsGrpc()
+			hasKafka = hasKafka || mp.IsKafka()
 		}
 		for _, s := range idefine.GetServices() {
 			sTmpl.Services = append(sTmpl.Services, paramWrapper{
@@ -103,15 +145,48 @@ func (g *Generator) Generate(p *Parser, conf Config) error {
 				ContainerTag: "`container:\"type\"`",
 			})
 		}
+		apis = append(apis, openAPIInterface{define: idefine, parsers: parsers})
 		errorLog(execute(structDefine, buf, sTmpl))
 		errorLog(execute(impStructDefine, buf, sTmpl))
+		errorLog(execute(clientStructDefine, clientBuf, sTmpl))
 
 		for _, mp := range parsers {
 			if mp.HasRequestMapping() {
 				errorLog(wrapperFunc.Execute(buf, &mp))
+				errorLog(clientFunc.Execute(clientBuf, &mp))
+			}
+			if mp.HasRequestMapping() || mp.IsGrpc() || mp.IsKafka() {
 				errorLog(impFunc.Execute(impBuf, &mp))
 			}
 		}
+		if hasGrpc {
+			grpcBuf := bytes.NewBuffer(nil)
+			errorLog(execute(notEdit, grpcBuf, ""))
+			errorLog(execute(importHeader, grpcBuf, conf))
+			errorLog(execute(grpcStructDefine, grpcBuf, sTmpl))
+			for _, mp := range parsers {
+				if mp.IsGrpc() {
+					errorLog(grpcFunc.Execute(grpcBuf, &mp))
+				}
+			}
+			if err := save(path.Join(conf.OutputPath, grpcFile), grpcBuf.Bytes()); err != nil {
+				return err
+			}
+		}
+		if hasKafka {
+			kafkaBuf := bytes.NewBuffer(nil)
+			errorLog(execute(notEdit, kafkaBuf, ""))
+			errorLog(execute(importHeader, kafkaBuf, conf))
+			errorLog(execute(kafkaStructDefine, kafkaBuf, sTmpl))
+			for _, mp := range parsers {
+				if mp.IsKafka() {
+					errorLog(kafkaFunc.Execute(kafkaBuf, &mp))
+				}
+			}
+			if err := save(path.Join(conf.OutputPath, kafkaFile), kafkaBuf.Bytes()); err != nil {
+				return err
+			}
+		}
 
 		fullPath := path.Join(conf.OutputPath, wrapperFile)
 		if err := save(fullPath, buf.Bytes()); err != nil {
@@ -121,8 +196,15 @@ func (g *Generator) Generate(p *Parser, conf Config) error {
 		if err := save(fullPath, impBuf.Bytes()); err != nil {
 			return err
 		}
+		fullPath = path.Join(conf.OutputPath, clientFile)
+		if err := save(fullPath, clientBuf.Bytes()); err != nil {
+			return err
+		}
 	}
 
+	if len(conf.OpenAPIPath) > 0 {
+		return g.generateOpenAPI(p, conf, apis)
+	}
 	return nil
 }
 
@@ -0,0 +1,142 @@
+package helper
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+)
+
+// BindForm bind an url encoded or multipart form, *multipart.FileHeader
+// fields receive the uploaded files, used by the wrappers of methods
+// annotated with @BindForm
+//
+//	@param c
+//	@param obj
+//	@return error
+func BindForm(c *gin.Context, obj interface{}) error {
+	if strings.HasPrefix(c.ContentType(), gin.MIMEMultipartPOSTForm) {
+		return c.ShouldBindWith(obj, binding.FormMultipart)
+	}
+	return c.ShouldBindWith(obj, binding.Form)
+}
+
+// Status http status answered for Err
+type Status struct {
+	Err  error
+	Code int
+}
+
+// ErrorStatus http status of err, used by the wrappers of methods annotated
+// with @ErrorStatus
+//
+//	@param err
+//	@param statuses the first one matching err wins
+//	@return int 200 when none matches
+func ErrorStatus(err error, statuses ...Status) int {
+	for _, s := range statuses {
+		if errors.Is(err, s.Err) {
+			return s.Code
+		}
+	}
+	return 200
+}
+
+// FieldError failed validation of a field
+type FieldError struct {
+	// Field path of the field named by its json, form, uri or header tag,
+	// e.g. items[0].name
+	Field string `json:"field"`
+	// Tag failed validation, e.g. required
+	Tag   string `json:"tag"`
+	Param string `json:"param,omitempty"`
+}
+
+// ValidationError binding error of a method annotated with @Validate, the
+// failed fields are answered as errData
+type ValidationError struct {
+	err    error
+	Fields []FieldError
+}
+
+// NewValidationError description
+//
+//	@param err error of ShouldBind
+//	@param obj the bound value, its tags name the fields
+//	@return error wraps errorcode.ErrParameterInvalid
+func NewValidationError(err error, obj interface{}) error {
+	out := &ValidationError{err: errors.Wrap(errorcode.ErrParameterInvalid, err.Error())}
+	var errs validator.ValidationErrors
+	if errors.As(err, &errs) {
+		t := reflect.TypeOf(obj)
+		for _, fe := range errs {
+			out.Fields = append(out.Fields, FieldError{
+				Field: fieldPath(t, fe.StructNamespace()),
+				Tag:   fe.Tag(),
+				Param: fe.Param(),
+			})
+		}
+	}
+	return out
+}
+
+func (e *ValidationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.err
+}
+
+// ErrData failed fields answered to clients
+func (e *ValidationError) ErrData() interface{} {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e.Fields
+}
+
+// fieldPath rename the go fields of a struct namespace, Req.Items[0].Name,
+// by their tags
+func fieldPath(t reflect.Type, namespace string) string {
+	parts := strings.Split(namespace, ".")
+	if len(parts) > 0 {
+		// the first part is the struct itself
+		parts = parts[1:]
+	}
+	for i, part := range parts {
+		name, index := part, ""
+		if n := strings.Index(part, "["); n >= 0 {
+			name, index = part[:n], part[n:]
+		}
+		for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice ||
+			t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			continue
+		}
+		field, ok := t.FieldByName(name)
+		if !ok {
+			t = nil
+			continue
+		}
+		parts[i] = tagName(field) + index
+		t = field.Type
+	}
+	return strings.Join(parts, ".")
+}
+
+func tagName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form", "uri", "header"} {
+		name := strings.Split(field.Tag.Get(key), ",")[0]
+		if len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
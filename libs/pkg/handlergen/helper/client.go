@@ -0,0 +1,337 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/httpclient"
+	"github.com/pkg/errors"
+)
+
+// RequestOption changes the requests sent by a Client, e.g. api.WithDiscovery
+// or api.WithSign
+type RequestOption func(context.Context, *http.Request) error
+
+// Client http transport of the generated handler clients
+type Client struct {
+	baseURL string
+	opts    []RequestOption
+}
+
+// NewClient description
+//
+//	@param baseURL scheme and host of the service, the host is replaced when
+//	api.WithDiscovery is one of the options
+//	@param opts applied in order to every request
+//	@return *Client
+func NewClient(baseURL string, opts ...RequestOption) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		opts:    opts,
+	}
+}
+
+// ClientRequest call of a handler method
+type ClientRequest struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Header  http.Header
+	Cookies []*http.Cookie
+	Body    interface{}
+	// Form sent as multipart form, *multipart.FileHeader fields as files
+	Form interface{}
+}
+
+// NewClientRequest description
+//
+//	@param method
+//	@param path route of the method, e.g. /conversation/:id
+//	@return *ClientRequest
+func NewClientRequest(method, path string) *ClientRequest {
+	return &ClientRequest{
+		Method: method,
+		Path:   path,
+		Query:  url.Values{},
+		Header: http.Header{},
+	}
+}
+
+// PathVariable fill the :name segment of the path
+func (r *ClientRequest) PathVariable(name string, v interface{}) {
+	s, _ := ObjectToString(v)
+	r.Path = strings.Replace(r.Path, ":"+name, url.PathEscape(s), 1)
+}
+
+// RequestParam add a query param, nil values are skipped
+func (r *ClientRequest) RequestParam(name string, v interface{}) {
+	if s, ok := ObjectToString(v); ok {
+		r.Query.Set(name, s)
+	}
+}
+
+// BindHeader set a header, nil values are skipped
+func (r *ClientRequest) BindHeader(name string, v interface{}) {
+	if s, ok := ObjectToString(v); ok {
+		r.Header.Set(name, s)
+	}
+}
+
+// BindCookie add a cookie, nil values are skipped
+func (r *ClientRequest) BindCookie(name string, v interface{}) {
+	if s, ok := ObjectToString(v); ok {
+		r.Cookies = append(r.Cookies, &http.Cookie{Name: name, Value: s})
+	}
+}
+
+// BindURI fill the path variables from the uri tags of v
+func (r *ClientRequest) BindURI(v interface{}) {
+	structFields(v, "uri", r.PathVariable)
+}
+
+// BindQuery add the query params from the form tags of v
+func (r *ClientRequest) BindQuery(v interface{}) {
+	structFields(v, "form", r.RequestParam)
+}
+
+func structFields(v interface{}, tag string, fn func(string, interface{})) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		fn(name, rv.Field(i).Interface())
+	}
+}
+
+// ObjectToString reverse of BindStringToObject
+//
+//	@param v
+//	@return string
+//	@return bool false when v is a nil pointer
+func ObjectToString(v interface{}) (string, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", false
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return "", false
+	}
+	switch val := rv.Interface().(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano), true
+	case fmt.Stringer:
+		return val.String(), true
+	}
+	return fmt.Sprint(rv.Interface()), true
+}
+
+func (c *Client) send(ctx context.Context, r *ClientRequest) (*http.Response, error) {
+	u, err := url.Parse(c.baseURL + r.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse url")
+	}
+	u.RawQuery = r.Query.Encode()
+	var body bytes.Buffer
+	contentType := ""
+	if r.Form != nil {
+		if contentType, err = writeForm(&body, r.Form); err != nil {
+			return nil, errors.Wrap(err, "write form")
+		}
+	} else if r.Body != nil {
+		if err = json.NewEncoder(&body).Encode(r.Body); err != nil {
+			return nil, errors.Wrap(err, "marshal request body")
+		}
+		contentType = "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, u.String(), &body)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	for _, cookie := range r.Cookies {
+		req.AddCookie(cookie)
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, opt := range c.opts {
+		if err = opt(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	res, err := httpclient.Do(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, r.Method+" "+r.Path)
+	}
+	return res, nil
+}
+
+// Do send the request and decode the data of the response into out, a non
+// zero code is returned as the errorcode error defining it
+//
+//	@param ctx
+//	@param r
+//	@param out nil when the method has no result data
+//	@return error
+func (c *Client) Do(ctx context.Context, r *ClientRequest, out interface{}) error {
+	res, err := c.send(ctx, r)
+	if err != nil {
+		return err
+	}
+	return readResponse(res, out)
+}
+
+// writeForm the form tags of v as multipart form
+func writeForm(w io.Writer, v interface{}) (string, error) {
+	mw := multipart.NewWriter(w)
+	var err error
+	structFields(v, "form", func(name string, field interface{}) {
+		if err != nil {
+			return
+		}
+		switch f := field.(type) {
+		case *multipart.FileHeader:
+			err = writeFile(mw, name, f)
+		case []*multipart.FileHeader:
+			for _, file := range f {
+				if err = writeFile(mw, name, file); err != nil {
+					return
+				}
+			}
+		default:
+			if s, ok := ObjectToString(field); ok {
+				err = mw.WriteField(name, s)
+			}
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return mw.FormDataContentType(), mw.Close()
+}
+
+func writeFile(mw *multipart.Writer, name string, file *multipart.FileHeader) error {
+	if file == nil {
+		return nil
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := mw.CreateFormFile(name, file.Filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func readResponse(res *http.Response, out interface{}) error {
+	if res.StatusCode == http.StatusNoContent {
+		res.Body.Close()
+		return nil
+	}
+	body, err := model.GenericReadFromBody[json.RawMessage](res.Body)
+	if err != nil {
+		return errors.Wrapf(err, "status %d", res.StatusCode)
+	}
+	if err = errorcode.FromCode(body.Code, body.Message); err != nil {
+		return err
+	}
+	if out == nil || len(body.Data) == 0 {
+		return nil
+	}
+	return errors.Wrap(json.Unmarshal(body.Data, out), "unmarshal data")
+}
+
+// ClientStream send the request of a @Stream method, the events are decoded
+// into T until the response ends or ctx is done
+//
+//	@param ctx
+//	@param c
+//	@param r
+//	@return <-chan T
+//	@return error error answered before the stream started
+func ClientStream[T any](ctx context.Context, c *Client, r *ClientRequest) (<-chan T, error) {
+	res, err := c.send(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		err = readResponse(res, nil)
+		if err == nil {
+			err = errors.Errorf("%s %s: not an event stream", r.Method, r.Path)
+		}
+		return nil, err
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		defer res.Body.Close()
+		scanner := bufio.NewScanner(res.Body)
+		scanner.Buffer(nil, 1<<20)
+		var data []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "data:") {
+				data = append(data, strings.TrimPrefix(line[5:], " "))
+				continue
+			}
+			if len(line) > 0 || len(data) == 0 {
+				continue
+			}
+			item, err := decodeEvent[T](strings.Join(data, "\n"))
+			data = data[:0]
+			if err != nil {
+				continue
+			}
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// decodeEvent strings are sent as they are, anything else as json
+func decodeEvent[T any](data string) (T, error) {
+	var item T
+	if s, ok := interface{}(&item).(*string); ok {
+		*s = data
+		return item, nil
+	}
+	err := json.Unmarshal([]byte(data), &item)
+	return item, err
+}
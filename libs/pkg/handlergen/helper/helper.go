@@ -182,3 +182,20 @@ type InjectServices6[T ServiceInterface[T],
 type InjectServices7[T ServiceInterface[T],
 	T1 ServiceInterface[T1], T2 ServiceInterface[T2], T3 ServiceInterface[T3],
 	T4 ServiceInterface[T4], T5 ServiceInterface[T5], T6 ServiceInterface[T6]] interface{}
+
+// StreamEvent item of a @Stream channel choosing its own sse event name,
+// items not implementing it are sent as "message" events
+type StreamEvent interface {
+	EventName() string
+}
+
+// EventName sse event name of a stream item
+//
+//	@param item
+//	@return string
+func EventName(item interface{}) string {
+	if e, ok := item.(StreamEvent); ok {
+		return e.EventName()
+	}
+	return "message"
+}
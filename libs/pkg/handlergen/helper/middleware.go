@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// RegisterMiddleware bind a middleware to name in the container, methods
+// annotated with @Middleware(name) run it
+//
+//	@param name
+//	@param mid
+//	@return error
+func RegisterMiddleware(name string, mid gin.HandlerFunc) error {
+	return container.NamedSingleton(name, func() gin.HandlerFunc {
+		return mid
+	})
+}
+
+// Middleware resolve a middleware registered with RegisterMiddleware, the
+// wrappers resolve them when their routes are registered
+//
+//	@param name
+//	@return gin.HandlerFunc
+func Middleware(name string) gin.HandlerFunc {
+	var mid gin.HandlerFunc
+	if err := container.NamedResolve(&mid, name); err != nil {
+		panic(errors.Wrap(err, "resolve middleware "+name))
+	}
+	return mid
+}
+
+// Timeout cancel the request context after d, used by methods annotated
+// with @Timeout
+//
+//	@param d
+//	@return gin.HandlerFunc
+func Timeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// Deprecated mark the answers of methods annotated with @Deprecated
+//
+//	@return gin.HandlerFunc
+func Deprecated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		log.WithContext(c.Request.Context()).Warnf("deprecated api called: %s %s", c.Request.Method, c.FullPath())
+		c.Next()
+	}
+}
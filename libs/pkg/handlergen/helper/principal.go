@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"github.com/LSDXXX/libs/constant"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Principal caller of a request, the auth middleware stores it under
+// constant.JWTIdentityKey
+type Principal interface {
+	HasRole(role string) bool
+	HasPermission(perm string) bool
+}
+
+// GetPrincipal caller of the request
+//
+//	@param c
+//	@return Principal
+//	@return bool false if the request was not authenticated
+func GetPrincipal(c *gin.Context) (Principal, bool) {
+	v, ok := c.Get(constant.JWTIdentityKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(Principal)
+	return p, ok
+}
+
+// RequireRole check the caller has any of the roles, used by the wrappers
+// of methods annotated with @RequireRole
+//
+//	@param c
+//	@param roles
+//	@return error ErrUnauthorized or ErrForbidden
+func RequireRole(c *gin.Context, roles ...string) error {
+	return require(c, "role", roles, Principal.HasRole)
+}
+
+// RequirePermission check the caller has any of the permissions, used by
+// the wrappers of methods annotated with @RequirePermission
+//
+//	@param c
+//	@param perms
+//	@return error ErrUnauthorized or ErrForbidden
+func RequirePermission(c *gin.Context, perms ...string) error {
+	return require(c, "permission", perms, Principal.HasPermission)
+}
+
+func require(c *gin.Context, kind string, wants []string, has func(Principal, string) bool) error {
+	p, ok := GetPrincipal(c)
+	if !ok {
+		return errorcode.ErrUnauthorized
+	}
+	for _, want := range wants {
+		if has(p, want) {
+			return nil
+		}
+	}
+	return errors.Wrapf(errorcode.ErrForbidden, "%s %v required", kind, wants)
+}
@@ -0,0 +1,176 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/servercontext"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcCodecName content subtype of the generated grpc services, clients call
+// them with grpc.CallContentSubtype(GrpcCodecName). It is private to the
+// generated services so the "json" codec of the binary is left alone
+const GrpcCodecName = "handlergen-json"
+
+// ErrorCodeTrailer grpc trailer holding the errorcode code of a failed call
+const ErrorCodeTrailer = "errorcode"
+
+// jsonCodec messages of the generated grpc services are the method params
+// and results encoded as json
+type jsonCodec struct{}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return GrpcCodecName
+}
+
+// grpcCodes grpc code of the errorcode errors, anything else is Unknown
+var grpcCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{errorcode.ErrParameterInvalid, codes.InvalidArgument},
+	{errorcode.ErrIncompleteParameters, codes.InvalidArgument},
+	{errorcode.ErrNotFound, codes.NotFound},
+	{errorcode.ErrUnauthorized, codes.Unauthenticated},
+	{errorcode.ErrForbidden, codes.PermissionDenied},
+	{errorcode.ErrUserExists, codes.AlreadyExists},
+	{errorcode.ErrTooManyRequests, codes.ResourceExhausted},
+	{errorcode.ErrQuotaExceeded, codes.ResourceExhausted},
+	{errorcode.ErrNotImplemented, codes.Unimplemented},
+	{errorcode.ErrServiceUnavailable, codes.Unavailable},
+	{errorcode.ErrHTTPRequestTimeOut, codes.DeadlineExceeded},
+	{errorcode.ErrInternalServerError, codes.Internal},
+}
+
+// GrpcError status error of err answered by the generated grpc services, the
+// errorcode code is sent in the ErrorCodeTrailer trailer
+//
+//	@param ctx
+//	@param err
+//	@return error nil when err is nil
+func GrpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	_ = grpc.SetTrailer(ctx, metadata.Pairs(ErrorCodeTrailer, strconv.Itoa(errorcode.Code(err))))
+	code := codes.Unknown
+	for _, v := range grpcCodes {
+		if errors.Is(err, v.err) {
+			code = v.code
+			break
+		}
+	}
+	return status.Error(code, err.Error())
+}
+
+// Validate check the binding tags of obj as gin does when binding a request
+//
+//	@param obj
+//	@return error a ValidationError
+func Validate(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if binding.Validator == nil || v.Kind() != reflect.Struct {
+		return nil
+	}
+	if err := binding.Validator.ValidateStruct(v.Interface()); err != nil {
+		return NewValidationError(err, obj)
+	}
+	return nil
+}
+
+// DecodeMessage decode a json message into obj and validate it
+//
+//	@param message
+//	@param obj
+//	@return error wraps errorcode.ErrParameterInvalid
+func DecodeMessage(message []byte, obj interface{}) error {
+	if err := json.Unmarshal(message, obj); err != nil {
+		return errors.Wrap(errorcode.ErrParameterInvalid, err.Error())
+	}
+	return Validate(obj)
+}
+
+// NewMessageContext context of a consumed message with a new trace id
+//
+//	@return context.Context
+func NewMessageContext() context.Context {
+	return servercontext.WithTraceID(context.Background(), uuid.NewString())
+}
+
+// StreamError error of a consumed message, the errorcode code is kept in the
+// message the consumer logs
+//
+//	@param err
+//	@return error nil when err is nil
+func StreamError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.WithMessagef(err, "errorcode %d", errorcode.Code(err))
+}
+
+// StreamHandler api.StreamMessageHandler of a method annotated with
+// @KafkaTopic
+type StreamHandler struct {
+	topic   string
+	groupID string
+	process func([]byte) error
+}
+
+// NewStreamHandler description
+//
+//	@param topic
+//	@param groupID the group of the server when empty
+//	@param process
+//	@return *StreamHandler
+func NewStreamHandler(topic, groupID string, process func([]byte) error) *StreamHandler {
+	return &StreamHandler{
+		topic:   topic,
+		groupID: groupID,
+		process: process,
+	}
+}
+
+func (h *StreamHandler) Topic() string {
+	return h.topic
+}
+
+func (h *StreamHandler) GroupID() string {
+	return h.groupID
+}
+
+func (h *StreamHandler) Process(message []byte) error {
+	return h.process(message)
+}
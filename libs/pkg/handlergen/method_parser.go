@@ -3,7 +3,9 @@ package handlergen
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func findParamByName(params []param, name string) (param, bool) {
@@ -26,6 +28,14 @@ type paramDefine struct {
 	Required bool
 }
 
+// errorStatusDefine http status answered for an error, e.g.
+// @ErrorStatus(ErrNotFound=404)
+type errorStatusDefine struct {
+	// Error go expression of the error, errorcode.ErrNotFound
+	Error  string
+	Status int
+}
+
 type MethodParser struct {
 	MethodName     string
 	StructName     string
@@ -40,6 +50,33 @@ type MethodParser struct {
 	URIBinding     param
 	BodyBinding    param
 	ParamBinding   param
+	FormBinding    param
+	HeaderParams   []paramDefine
+	CookieParams   []paramDefine
+	Stream         bool
+	// Validate binding errors are answered with the failed fields
+	Validate bool
+	// Status http status of a successful answer, 200 when 0
+	Status int
+	// ErrorStatuses http status of errors, overrides the interface's
+	ErrorStatuses []errorStatusDefine
+	// Middlewares names of the middlewares registered in the container
+	Middlewares []string
+	// Timeout deadline of the request context, none when 0
+	Timeout    time.Duration
+	Deprecated bool
+	// RequireRoles the caller needs any of them, overrides the interface's
+	RequireRoles []string
+	// RequirePermissions the caller needs any of them, overrides the interface's
+	RequirePermissions []string
+	// GrpcMethod name of the method in the grpc service, none when empty
+	GrpcMethod string
+	// GrpcServiceName <package>.<interface>
+	GrpcServiceName string
+	// KafkaTopic topic consumed by the method, none when empty
+	KafkaTopic string
+	// KafkaGroup consumer group of KafkaTopic, the server's when empty
+	KafkaGroup string
 }
 
 func (m *MethodParser) HasResponseData() bool {
@@ -50,6 +87,54 @@ func (m *MethodParser) HasRequestMapping() bool {
 	return m.RequestMapping != nil
 }
 
+func (m *MethodParser) IsStream() bool {
+	return m.Stream
+}
+
+func (m *MethodParser) IsGrpc() bool {
+	return len(m.GrpcMethod) > 0
+}
+
+func (m *MethodParser) IsKafka() bool {
+	return len(m.KafkaTopic) > 0
+}
+
+// HasParam the payload of grpc and kafka is decoded into the only param
+func (m *MethodParser) HasParam() bool {
+	return len(m.Params) > 0
+}
+
+// ParamTypeInTmpl type of the only param
+func (m *MethodParser) ParamTypeInTmpl() string {
+	return m.Params[0].TypeInTmpl()
+}
+
+func (m *MethodParser) HasRequireRoles() bool {
+	return len(m.RequireRoles) > 0
+}
+
+func (m *MethodParser) HasRequirePermissions() bool {
+	return len(m.RequirePermissions) > 0
+}
+
+// RequireRolesInTmpl roles as go string literals
+func (m *MethodParser) RequireRolesInTmpl() string {
+	return quoteList(m.RequireRoles)
+}
+
+// RequirePermissionsInTmpl permissions as go string literals
+func (m *MethodParser) RequirePermissionsInTmpl() string {
+	return quoteList(m.RequirePermissions)
+}
+
+func quoteList(in []string) string {
+	var out []string
+	for _, v := range in {
+		out = append(out, strconv.Quote(v))
+	}
+	return strings.Join(out, ", ")
+}
+
 func (m *MethodParser) HasURIBinding() bool {
 	return !m.URIBinding.IsNull()
 }
@@ -62,6 +147,66 @@ func (m *MethodParser) HasParamBinding() bool {
 	return !m.ParamBinding.IsNull()
 }
 
+func (m *MethodParser) HasFormBinding() bool {
+	return !m.FormBinding.IsNull()
+}
+
+// SuccessStatus http status of a successful answer
+func (m *MethodParser) SuccessStatus() int {
+	if m.Status == 0 {
+		return 200
+	}
+	return m.Status
+}
+
+// IsNoContent successful answers have no body
+func (m *MethodParser) IsNoContent() bool {
+	return m.Status == 204
+}
+
+// ErrorStatusInTmpl http status of err in the wrapper
+func (m *MethodParser) ErrorStatusInTmpl() string {
+	if len(m.ErrorStatuses) == 0 {
+		return "200"
+	}
+	var out []string
+	for _, v := range m.ErrorStatuses {
+		out = append(out, fmt.Sprintf("helper.Status{Err: %s, Code: %d}", v.Error, v.Status))
+	}
+	return "helper.ErrorStatus(err, " + strings.Join(out, ", ") + ")"
+}
+
+func (m *MethodParser) HasTimeout() bool {
+	return m.Timeout > 0
+}
+
+// HandlersInTmpl middlewares of the route ahead of the wrapper
+func (m *MethodParser) HandlersInTmpl() string {
+	var out []string
+	if m.HasTimeout() {
+		out = append(out, fmt.Sprintf("helper.Timeout(%d * time.Millisecond)", m.Timeout.Milliseconds()))
+	}
+	if m.Deprecated {
+		out = append(out, "helper.Deprecated()")
+	}
+	for _, name := range m.Middlewares {
+		out = append(out, fmt.Sprintf("helper.Middleware(%s)", strconv.Quote(name)))
+	}
+	out = append(out, "w."+m.MethodName)
+	return strings.Join(out, ", ")
+}
+
+// BindErrorInTmpl error answered when binding p fails
+func (m *MethodParser) BindErrorInTmpl(p param) string {
+	if m.Validate {
+		if p.IsPointer {
+			return "helper.NewValidationError(err, " + p.Name + ")"
+		}
+		return "helper.NewValidationError(err, &" + p.Name + ")"
+	}
+	return "errors.Wrap(errorcode.ErrParameterInvalid, err.Error())"
+}
+
 func (m *MethodParser) HasResultError() bool {
 	for _, p := range m.Results {
 		if p.Type == "error" {
@@ -99,11 +244,30 @@ func (m *MethodParser) GetParamInFunc() string {
 	return strings.Join(names, ",")
 }
 
+// GetResultTypesInTmpl results without their names
+func (m *MethodParser) GetResultTypesInTmpl() string {
+	var res []string
+	for _, p := range m.Results {
+		res = append(res, p.TypeInTmpl())
+	}
+	return strings.Join(res, ",")
+}
+
+// ResultDataInTmpl type of the result data, the element type for streams
+func (m *MethodParser) ResultDataInTmpl() string {
+	p := m.Results[0]
+	p.IsChan = false
+	return p.TypeInTmpl()
+}
+
 func paramToString(params []param) string {
 	var res []string
 	for _, param := range params {
 		name := param.Name
 		tmplString := fmt.Sprintf("%s ", name)
+		if param.IsChan {
+			tmplString += "<-chan "
+		}
 		if param.IsArray {
 			tmplString += "[]"
 		}
@@ -155,6 +319,42 @@ func parseValue(data string) []kv {
 	return out
 }
 
+// parseParams name=@param pairs of RequestParam, PathVariable, BindHeader and
+// BindCookie
+func (m *MethodParser) parseParams(value string, required bool) ([]paramDefine, error) {
+	var out []paramDefine
+	for _, kv := range parseValue(value) {
+		v := strings.TrimPrefix(kv.val, "@")
+		p, ok := findParamByName(m.Params, v)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("param %s not found in method", v))
+		}
+		out = append(out, paramDefine{
+			Name:     kv.key,
+			Param:    p,
+			Required: required,
+		})
+	}
+	return out, nil
+}
+
+// parseErrorStatus error=status pairs, errors without package are errorcode's
+func parseErrorStatus(value string) ([]errorStatusDefine, error) {
+	var out []errorStatusDefine
+	for _, kv := range parseValue(value) {
+		status, err := strconv.Atoi(kv.val)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid status of %s: %s", kv.key, kv.val))
+		}
+		name := kv.key
+		if !strings.Contains(name, ".") {
+			name = "errorcode." + name
+		}
+		out = append(out, errorStatusDefine{Error: name, Status: status})
+	}
+	return out, nil
+}
+
 func (m *MethodParser) parseDoc() error {
 	docString := strings.TrimSpace(m.getDocString())
 	lines := strings.Split(strings.ReplaceAll(docString, "\n\r", "\n"), "\n")
@@ -171,56 +371,18 @@ func (m *MethodParser) parseDoc() error {
 				Path:   path,
 				Method: method,
 			}
-		case "RequestParam":
-			kvs := parseValue(value)
-			for _, kv := range kvs {
-				v := kv.val
-				if strings.HasPrefix(kv.val, "@") {
-					v = v[1:]
-				}
-				p, ok := findParamByName(m.Params, v)
-				if !ok {
-					return errors.New(fmt.Sprintf("param %s not found in method", v))
-				}
-				m.RequestParams = append(m.RequestParams, paramDefine{
-					Name:  kv.key,
-					Param: p,
-				})
-			}
-		case "RequestParamRequired":
-			kvs := parseValue(value)
-			for _, kv := range kvs {
-				v := kv.val
-				if strings.HasPrefix(kv.val, "@") {
-					v = v[1:]
-				}
-				p, ok := findParamByName(m.Params, v)
-				if !ok {
-					return errors.New(fmt.Sprintf("param %s not found in method", v))
-				}
-				m.RequestParams = append(m.RequestParams, paramDefine{
-					Name:     kv.key,
-					Param:    p,
-					Required: true,
-				})
+		case "RequestParam", "RequestParamRequired":
+			params, err := m.parseParams(value, key == "RequestParamRequired")
+			if err != nil {
+				return err
 			}
-
+			m.RequestParams = append(m.RequestParams, params...)
 		case "PathVariable":
-			kvs := parseValue(value)
-			for _, kv := range kvs {
-				v := kv.val
-				if strings.HasPrefix(kv.val, "@") {
-					v = v[1:]
-				}
-				p, ok := findParamByName(m.Params, v)
-				if !ok {
-					return errors.New(fmt.Sprintf("param %s not found in method", v))
-				}
-				m.PathVariables = append(m.RequestParams, paramDefine{
-					Name:  kv.key,
-					Param: p,
-				})
+			params, err := m.parseParams(value, false)
+			if err != nil {
+				return err
 			}
+			m.PathVariables = append(m.PathVariables, params...)
 		case "BindURI":
 			p, ok := findParamByName(m.Params, value)
 			if !ok {
@@ -239,8 +401,70 @@ func (m *MethodParser) parseDoc() error {
 				return errors.New(fmt.Sprintf("param %s not found in method", value))
 			}
 			m.BodyBinding = p
+		case "BindForm":
+			p, ok := findParamByName(m.Params, value)
+			if !ok {
+				return errors.New(fmt.Sprintf("param %s not found in method", value))
+			}
+			m.FormBinding = p
+		case "BindHeader":
+			params, err := m.parseParams(value, false)
+			if err != nil {
+				return err
+			}
+			m.HeaderParams = append(m.HeaderParams, params...)
+		case "BindCookie":
+			params, err := m.parseParams(value, false)
+			if err != nil {
+				return err
+			}
+			m.CookieParams = append(m.CookieParams, params...)
+		case "Validate":
+			m.Validate = true
+		case "Middleware":
+			m.Middlewares = append(m.Middlewares, parseList(value)...)
+		case "Timeout":
+			timeout, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || timeout < time.Millisecond {
+				return errors.New("invalid timeout: " + value)
+			}
+			m.Timeout = timeout
+		case "Deprecated":
+			m.Deprecated = true
+		case "Status":
+			status, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return errors.New("invalid status: " + value)
+			}
+			m.Status = status
+		case "ErrorStatus":
+			statuses, err := parseErrorStatus(value)
+			if err != nil {
+				return err
+			}
+			m.ErrorStatuses = append(m.ErrorStatuses, statuses...)
+		case "Stream":
+			m.Stream = true
+		case "RequireRole":
+			m.RequireRoles = append(m.RequireRoles, parseList(value)...)
+		case "RequirePermission":
+			m.RequirePermissions = append(m.RequirePermissions, parseList(value)...)
+		case "GrpcMethod":
+			m.GrpcMethod = strings.TrimSpace(value)
+			if len(m.GrpcMethod) == 0 {
+				m.GrpcMethod = m.MethodName
+			}
+		case "KafkaTopic":
+			list := parseList(value)
+			if len(list) == 0 || len(list) > 2 {
+				return errors.New("invalid kafka topic: " + value)
+			}
+			m.KafkaTopic = list[0]
+			if len(list) == 2 {
+				m.KafkaGroup = list[1]
+			}
 		default:
-			return errors.New("invalid annotation")
+			return errors.New("invalid annotation: " + key)
 		}
 	}
 	return nil
@@ -251,10 +475,26 @@ func (m *MethodParser) Parse() error {
 	if err != nil {
 		return err
 	}
-	if m.HasRequestMapping() {
+	if m.IsStream() {
+		if !(len(m.Results) == 2 && m.Results[0].IsChan && m.Results[1].IsError()) {
+			return errors.New("stream method must return (<-chan T, error)")
+		}
+	} else if m.HasRequestMapping() || m.IsGrpc() || m.IsKafka() {
 		if !(len(m.Results) == 2 && m.Results[1].IsError()) && !(len(m.Results) == 1 && m.Results[0].IsError()) {
 			return errors.New("method result type invalid")
 		}
 	}
+	if (m.IsGrpc() || m.IsKafka()) && (m.IsStream() || len(m.Params) > 1) {
+		return errors.New(m.MethodName + ": grpc and kafka methods take at most one param and can not stream")
+	}
+	return nil
+}
+
+// checkTransports access rules are checked on the gin context, the other
+// transports would skip them
+func (m *MethodParser) checkTransports() error {
+	if (m.IsGrpc() || m.IsKafka()) && (m.HasRequireRoles() || m.HasRequirePermissions()) {
+		return errors.New(m.MethodName + ": access rules are only enforced over http")
+	}
 	return nil
 }
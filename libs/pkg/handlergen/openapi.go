@@ -0,0 +1,589 @@
+package handlergen
+
+import (
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// OpenAPI openapi 3 document, only the parts handlergen writes
+type OpenAPI struct {
+	OpenAPI    string                          `yaml:"openapi"`
+	Info       Info                            `yaml:"info"`
+	Paths      map[string]map[string]Operation `yaml:"paths"`
+	Components Components                      `yaml:"components"`
+}
+
+type Info struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description,omitempty"`
+	Version     string `yaml:"version"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `yaml:"schemas,omitempty"`
+}
+
+type Operation struct {
+	Tags        []string            `yaml:"tags,omitempty"`
+	OperationId string              `yaml:"operationId"`
+	Summary     string              `yaml:"summary,omitempty"`
+	Parameters  []Parameter         `yaml:"parameters,omitempty"`
+	RequestBody *RequestBody        `yaml:"requestBody,omitempty"`
+	Responses   map[string]Response `yaml:"responses"`
+	Deprecated  bool                `yaml:"deprecated,omitempty"`
+	// RequireRoles, RequirePermissions access rules of the method
+	RequireRoles       []string `yaml:"x-require-roles,omitempty"`
+	RequirePermissions []string `yaml:"x-require-permissions,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `yaml:"required"`
+	Content  map[string]MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Description string               `yaml:"description"`
+	Content     map[string]MediaType `yaml:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `yaml:"$ref,omitempty"`
+	Type                 string             `yaml:"type,omitempty"`
+	Format               string             `yaml:"format,omitempty"`
+	Nullable             bool               `yaml:"nullable,omitempty"`
+	Items                *Schema            `yaml:"items,omitempty"`
+	Properties           map[string]*Schema `yaml:"properties,omitempty"`
+	Required             []string           `yaml:"required,omitempty"`
+	AdditionalProperties *Schema            `yaml:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `yaml:"allOf,omitempty"`
+}
+
+// responseSchemaName schema of model.Response, the envelope of every answer
+const responseSchemaName = "Response"
+
+// responseSchema model.Response as it is written by the wrappers
+func responseSchema() *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":    {Type: "integer"},
+			"message": {Type: "string"},
+			"msg":     {Type: "string"},
+			"errData": {},
+			"data":    {},
+		},
+		Required: []string{"code", "message"},
+	}
+}
+
+// openAPIInterface parsed methods of a handler interface
+type openAPIInterface struct {
+	define  interfaceDefine
+	parsers []MethodParser
+}
+
+// schemaBuilder openapi schemas of go types, named structs become components
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	// owners type of every component, so equal names of other packages get
+	// the package as prefix
+	owners map[string]*types.TypeName
+}
+
+func newSchemaBuilder(schemas map[string]*Schema) *schemaBuilder {
+	return &schemaBuilder{
+		schemas: schemas,
+		owners:  make(map[string]*types.TypeName),
+	}
+}
+
+func (b *schemaBuilder) componentName(obj *types.TypeName) string {
+	name := obj.Name()
+	if owner, ok := b.owners[name]; ok && owner != obj && obj.Pkg() != nil {
+		name = strings.Title(obj.Pkg().Name()) + name
+	}
+	return name
+}
+
+func (b *schemaBuilder) build(t types.Type) *Schema {
+	switch v := t.(type) {
+	case *types.Named:
+		obj := v.Obj()
+		if obj.Pkg() != nil {
+			switch obj.Pkg().Path() + "." + obj.Name() {
+			case "time.Time":
+				return &Schema{Type: "string", Format: "date-time"}
+			case "github.com/LSDXXX/libs/pkg/handlergen/helper.Date":
+				return &Schema{Type: "string", Format: "date"}
+			case "encoding/json.RawMessage":
+				return &Schema{}
+			case "mime/multipart.FileHeader":
+				return &Schema{Type: "string", Format: "binary"}
+			}
+		}
+		if _, ok := v.Underlying().(*types.Struct); !ok {
+			return b.build(v.Underlying())
+		}
+		name := b.componentName(obj)
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		if _, ok := b.owners[name]; ok {
+			return ref
+		}
+		// registered first, so recursive types refer to themselves
+		b.owners[name] = obj
+		b.schemas[name] = &Schema{}
+		*b.schemas[name] = *b.build(v.Underlying())
+		return ref
+	case *types.Pointer:
+		s := *b.build(v.Elem())
+		if len(s.Ref) > 0 {
+			return &s
+		}
+		s.Nullable = true
+		return &s
+	case *types.Slice:
+		if basic, ok := v.Elem().(*types.Basic); ok && basic.Kind() == types.Byte {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.build(v.Elem())}
+	case *types.Array:
+		return &Schema{Type: "array", Items: b.build(v.Elem())}
+	case *types.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.build(v.Elem())}
+	case *types.Chan:
+		return b.build(v.Elem())
+	case *types.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		b.addFields(s, v)
+		return s
+	case *types.Basic:
+		return basicSchema(v)
+	}
+	// interfaces and anything else may hold any value
+	return &Schema{}
+}
+
+func basicSchema(t *types.Basic) *Schema {
+	switch t.Kind() {
+	case types.Bool:
+		return &Schema{Type: "boolean"}
+	case types.Int64, types.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case types.Int32, types.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case types.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case types.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case types.String:
+		return &Schema{Type: "string"}
+	}
+	if t.Info()&types.IsInteger != 0 {
+		return &Schema{Type: "integer"}
+	}
+	return &Schema{}
+}
+
+// addFields properties of the exported fields named by their json tags,
+// embedded structs without a name are flattened
+func (b *schemaBuilder) addFields(s *Schema, st *types.Struct) {
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		name, opts := tagName(tag.Get("json"))
+		if name == "-" && len(opts) == 0 {
+			continue
+		}
+		if field.Anonymous() && len(name) == 0 {
+			t := field.Type()
+			if p, ok := t.(*types.Pointer); ok {
+				t = p.Elem()
+			}
+			if embedded, ok := t.Underlying().(*types.Struct); ok {
+				b.addFields(s, embedded)
+				continue
+			}
+		}
+		if !field.Exported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name()
+		}
+		s.Properties[name] = b.build(field.Type())
+		if hasOption(tag.Get("binding"), "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// tagName name and options of a json, form or uri tag
+func tagName(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+func hasOption(tag, option string) bool {
+	for _, v := range strings.Split(tag, ",") {
+		if v == option {
+			return true
+		}
+	}
+	return false
+}
+
+// formSchema multipart form of a struct bound with @BindForm, named by the
+// form tags
+func (b *schemaBuilder) formSchema(t types.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, p := range b.structParameters(t, "formData", "form") {
+		s.Properties[p.Name] = p.Schema
+		if p.Required {
+			s.Required = append(s.Required, p.Name)
+		}
+	}
+	return s
+}
+
+// structParameters a parameter of every field of a struct bound with
+// ShouldBindQuery or ShouldBindUri, named by the form or uri tag
+func (b *schemaBuilder) structParameters(t types.Type, in, tagKey string) []Parameter {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	var out []Parameter
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() {
+			continue
+		}
+		tag := reflect.StructTag(st.Tag(i))
+		name, _ := tagName(tag.Get(tagKey))
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name()
+		}
+		out = append(out, Parameter{
+			Name:     name,
+			In:       in,
+			Required: in == "path" || hasOption(tag.Get("binding"), "required"),
+			Schema:   b.build(field.Type()),
+		})
+	}
+	return out
+}
+
+var pathVariableRegexp = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// openAPIPath gin path to an openapi path, /conversation/:id is /conversation/{id}
+func openAPIPath(path string) string {
+	return pathVariableRegexp.ReplaceAllString(path, "{$1}")
+}
+
+// summary first line of the method doc which is no annotation
+func (m *MethodParser) summary() string {
+	for _, line := range strings.Split(m.getDocString(), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 && !strings.HasPrefix(line, "@") {
+			return line
+		}
+	}
+	return ""
+}
+
+// operation openapi operation of the method, sig is nil when the package
+// could not be type checked
+func (b *schemaBuilder) operation(m *MethodParser, sig *types.Signature) Operation {
+	typeOf := func(p param) types.Type {
+		if sig == nil {
+			return nil
+		}
+		for i := 0; i < sig.Params().Len(); i++ {
+			if sig.Params().At(i).Name() == p.Name {
+				return sig.Params().At(i).Type()
+			}
+		}
+		return nil
+	}
+	schemaOf := func(t types.Type) *Schema {
+		if t == nil {
+			return &Schema{}
+		}
+		return b.build(t)
+	}
+	op := Operation{
+		Tags:               []string{m.InterfaceName},
+		OperationId:        m.MethodName,
+		Summary:            m.summary(),
+		RequireRoles:       m.RequireRoles,
+		RequirePermissions: m.RequirePermissions,
+		Responses:          make(map[string]Response),
+		Deprecated:         m.Deprecated,
+	}
+	for _, v := range m.PathVariables {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: v.Name, In: "path", Required: true, Schema: schemaOf(typeOf(v.Param)),
+		})
+	}
+	for _, v := range m.RequestParams {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: v.Name, In: "query", Required: v.Required, Schema: schemaOf(typeOf(v.Param)),
+		})
+	}
+	for _, v := range m.HeaderParams {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: v.Name, In: "header", Schema: schemaOf(typeOf(v.Param)),
+		})
+	}
+	for _, v := range m.CookieParams {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: v.Name, In: "cookie", Schema: schemaOf(typeOf(v.Param)),
+		})
+	}
+	if t := typeOf(m.URIBinding); m.HasURIBinding() && t != nil {
+		op.Parameters = append(op.Parameters, b.structParameters(t, "path", "uri")...)
+	}
+	if t := typeOf(m.ParamBinding); m.HasParamBinding() && t != nil {
+		op.Parameters = append(op.Parameters, b.structParameters(t, "query", "form")...)
+	}
+	if m.HasBodyBinding() {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: schemaOf(typeOf(m.BodyBinding))},
+			},
+		}
+	}
+	if t := typeOf(m.FormBinding); m.HasFormBinding() && t != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"multipart/form-data": {Schema: b.formSchema(t)},
+			},
+		}
+	}
+	envelope := &Schema{Ref: "#/components/schemas/" + responseSchemaName}
+	for _, v := range m.ErrorStatuses {
+		status := strconv.Itoa(v.Status)
+		res, ok := op.Responses[status]
+		if !ok {
+			res = Response{Content: map[string]MediaType{
+				"application/json": {Schema: envelope},
+			}}
+		}
+		res.Description = strings.TrimPrefix(strings.Join([]string{res.Description, v.Error}, ", "), ", ")
+		op.Responses[status] = res
+	}
+	if m.HasResponseData() {
+		var data *Schema = &Schema{}
+		if sig != nil {
+			data = b.build(sig.Results().At(0).Type())
+		}
+		if m.IsStream() {
+			// errors before the stream starts are still answered as json
+			op.Responses["200"] = Response{
+				Description: "server sent events, each event data is an item",
+				Content: map[string]MediaType{
+					"text/event-stream": {Schema: data},
+					"application/json":  {Schema: envelope},
+				},
+			}
+			return op
+		}
+		envelope = &Schema{AllOf: []*Schema{envelope, {
+			Type:       "object",
+			Properties: map[string]*Schema{"data": data},
+		}}}
+	}
+	if m.IsNoContent() {
+		op.Responses["204"] = Response{Description: "no content"}
+		return op
+	}
+	op.Responses[strconv.Itoa(m.SuccessStatus())] = Response{
+		Description: "model.Response, code is 0 on success",
+		Content: map[string]MediaType{
+			"application/json": {Schema: envelope},
+		},
+	}
+	return op
+}
+
+// loadPackage type checked package of the file, type errors are ignored so
+// the wrappers need not exist yet. The imports are read from the export
+// data the go command builds for them
+func loadPackage(file string) *types.Package {
+	dir := filepath.Dir(file)
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil
+	}
+	exports, err := exportFiles(dir)
+	if err != nil {
+		log.Printf("list export data: %s", err)
+		return nil
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+			file, ok := exports[path]
+			if !ok {
+				return nil, errors.Errorf("no export data of %s", path)
+			}
+			return os.Open(file)
+		}),
+		Error: func(error) {},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, fset, files, nil)
+	return pkg
+}
+
+// exportFiles export data file of every dependency of the package in dir
+func exportFiles(dir string) (map[string]string, error) {
+	cmd := exec.Command("go", "list", "-e", "-export", "-deps", "-f", "{{.ImportPath}}\t{{.Export}}", ".")
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	exports := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if parts := strings.SplitN(line, "\t", 2); len(parts) == 2 && len(parts[1]) > 0 {
+			exports[parts[0]] = parts[1]
+		}
+	}
+	return exports, nil
+}
+
+// readOpenAPI the existing document, or a new one named by the package
+func readOpenAPI(file, title string) (*OpenAPI, error) {
+	doc := &OpenAPI{
+		OpenAPI: "3.0.0",
+		Info:    Info{Title: title, Version: "1.0.0"},
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "read openapi: %s", file)
+	}
+	if err == nil {
+		if err = yaml.Unmarshal(data, doc); err != nil {
+			return nil, errors.Wrapf(err, "parse openapi: %s", file)
+		}
+	}
+	if doc.Paths == nil {
+		doc.Paths = make(map[string]map[string]Operation)
+	}
+	if doc.Components.Schemas == nil {
+		doc.Components.Schemas = make(map[string]*Schema)
+	}
+	return doc, nil
+}
+
+// removeInterface drop the operations generated for the interface before,
+// so removed methods do not stay in the document
+func (doc *OpenAPI) removeInterface(name string) {
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			if len(op.Tags) > 0 && op.Tags[0] == name {
+				delete(item, method)
+			}
+		}
+		if len(item) == 0 {
+			delete(doc.Paths, path)
+		}
+	}
+}
+
+// generateOpenAPI merge the operations of the interfaces into the document
+// at conf.OpenAPIPath, the handlers of a service share one document
+func (g *Generator) generateOpenAPI(p *Parser, conf Config, apis []openAPIInterface) error {
+	doc, err := readOpenAPI(conf.OpenAPIPath, conf.Package)
+	if err != nil {
+		return err
+	}
+	pkg := loadPackage(p.file)
+	// schemas of this run replace the ones of the same name
+	b := newSchemaBuilder(doc.Components.Schemas)
+	doc.Components.Schemas[responseSchemaName] = responseSchema()
+	b.owners[responseSchemaName] = types.NewTypeName(0, nil, responseSchemaName, nil)
+
+	for _, api := range apis {
+		doc.removeInterface(api.define.Name)
+		var iface *types.Interface
+		if pkg != nil {
+			if obj := pkg.Scope().Lookup(api.define.Name); obj != nil {
+				iface, _ = obj.Type().Underlying().(*types.Interface)
+			}
+		}
+		for i := range api.parsers {
+			m := &api.parsers[i]
+			if !m.HasRequestMapping() {
+				continue
+			}
+			var sig *types.Signature
+			if iface != nil {
+				for j := 0; j < iface.NumMethods(); j++ {
+					if iface.Method(j).Name() == m.MethodName {
+						sig, _ = iface.Method(j).Type().(*types.Signature)
+					}
+				}
+			}
+			path := openAPIPath(api.define.RootPath + m.RequestMapping.Path)
+			method := strings.ToLower(strings.TrimSpace(m.RequestMapping.Method))
+			if len(method) == 0 {
+				method = "get"
+			}
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]Operation)
+			}
+			doc.Paths[path][method] = b.operation(m, sig)
+		}
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "marshal openapi")
+	}
+	return errors.Wrapf(ioutil.WriteFile(conf.OpenAPIPath, data, 0644), "write openapi: %s", conf.OpenAPIPath)
+}
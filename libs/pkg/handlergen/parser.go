@@ -15,6 +15,8 @@ import (
 
 type Parser struct {
 	visitor *interfaceVisitor
+	// file parsed file, its package is type checked for the openapi schemas
+	file string
 }
 
 func toSnakeStyle(in string) string {
@@ -47,6 +49,7 @@ type param struct { // (user model.User)
 	Type      string // param's type: User
 	IsArray   bool   // is array or not
 	IsPointer bool   // is pointer or not
+	IsChan    bool   // is receive only channel or not
 }
 
 func (p *param) IsString() bool {
@@ -60,6 +63,17 @@ func (p *param) FullType() string {
 	return p.Type
 }
 
+// TypeInTmpl type as written in go code, e.g. []*model.User
+func (p *param) TypeInTmpl() string {
+	return strings.TrimSpace(paramToString([]param{{
+		Package:   p.Package,
+		Type:      p.Type,
+		IsArray:   p.IsArray,
+		IsPointer: p.IsPointer,
+		IsChan:    p.IsChan,
+	}}))
+}
+
 func (p *param) IsMap() bool {
 	return strings.HasPrefix(p.Type, "map[")
 }
@@ -102,6 +116,9 @@ func (p *param) astGetParamType(param ast.Expr) {
 	case *ast.StarExpr:
 		p.IsPointer = true
 		p.astGetEltType(v.X)
+	case *ast.ChanType:
+		p.IsChan = true
+		p.astGetEltType(v.Value)
 	default:
 		log.Fatalf("unknow param type: %+v", v)
 	}
@@ -165,7 +182,12 @@ type interfaceDefine struct {
 	Methods  []methodDefine
 	Model    param
 	RootPath string
-	services []param
+	// RequireRoles, RequirePermissions default access rules of the methods
+	RequireRoles       []string
+	RequirePermissions []string
+	// ErrorStatuses default http status of errors
+	ErrorStatuses []errorStatusDefine
+	services      []param
 }
 
 func (d *interfaceDefine) GetServices() []param {
@@ -174,9 +196,20 @@ func (d *interfaceDefine) GetServices() []param {
 
 var annotationRegexp = regexp.MustCompile(`^@([a-z A-Z]+)\((.*)\)$`)
 
+// flagAnnotations annotations written without value, e.g. @Stream
+var flagAnnotations = map[string]bool{
+	"Stream":     true,
+	"Validate":   true,
+	"Deprecated": true,
+	"GrpcMethod": true,
+}
+
 func parseAnnotation(s string) (key string, value string, ok bool) {
 	matches := annotationRegexp.FindStringSubmatch(s)
 	if len(matches) == 0 {
+		if strings.HasPrefix(s, "@") && flagAnnotations[s[1:]] {
+			return s[1:], "", true
+		}
 		return "", "", false
 	}
 	return matches[1], matches[2], true
@@ -191,7 +224,7 @@ func parseRequestMapping(data string) (path, method string, ok bool) {
 	if len(vs) == 1 {
 		return vs[0], "", true
 	}
-	return vs[0], vs[1], true
+	return strings.TrimSpace(vs[0]), strings.TrimSpace(vs[1]), true
 }
 
 func parseRootPath(in string) string {
@@ -206,6 +239,53 @@ func parseRootPath(in string) string {
 	return ""
 }
 
+// parseList comma separated annotation value, e.g. @RequireRole(admin, user)
+func parseList(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseErrorStatuses @ErrorStatus of the interface doc
+func parseErrorStatuses(in string) []errorStatusDefine {
+	var out []errorStatusDefine
+	lines := strings.Split(strings.ReplaceAll(in, "\n\r", "\n"), "\n")
+	for _, line := range lines {
+		key, value, ok := parseAnnotation(strings.TrimSpace(line))
+		if !ok || key != "ErrorStatus" {
+			continue
+		}
+		statuses, err := parseErrorStatus(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out = append(out, statuses...)
+	}
+	return out
+}
+
+// parseAccessRules @RequireRole and @RequirePermission of the interface doc
+func parseAccessRules(in string) (roles, perms []string) {
+	lines := strings.Split(strings.ReplaceAll(in, "\n\r", "\n"), "\n")
+	for _, line := range lines {
+		key, value, ok := parseAnnotation(strings.TrimSpace(line))
+		if !ok {
+			continue
+		}
+		switch key {
+		case "RequireRole":
+			roles = append(roles, parseList(value)...)
+		case "RequirePermission":
+			perms = append(perms, parseList(value)...)
+		}
+	}
+	return roles, perms
+}
+
 func getParamList(fields *ast.FieldList) []param {
 	if fields == nil {
 		return nil
@@ -244,6 +324,8 @@ func (i *interfaceVisitor) Visit(n ast.Node) (w ast.Visitor) {
 		if data, ok := n.Type.(*ast.InterfaceType); ok {
 			interfaceDoc := i.docs[n.Name.Name]
 			define.RootPath = parseRootPath(interfaceDoc)
+			define.RequireRoles, define.RequirePermissions = parseAccessRules(interfaceDoc)
+			define.ErrorStatuses = parseErrorStatuses(interfaceDoc)
 			define.Name = n.Name.Name
 			methods := data.Methods.List
 
@@ -313,4 +395,5 @@ func (p *Parser) ParseFile(name string) {
 	v.imports = doc.Imports
 	ast.Walk(v, f)
 	p.visitor = v
+	p.file = name
 }
@@ -22,17 +22,17 @@ import (
 
 	StructDefineTemplate = `
 
-func Register(mid ...func(*gin.Context)) {
+func Register(mid ...gin.HandlerFunc) {
 	api.RegisterHttpRouter(New{{.InterfaceName}}Wrapper(mid))
 }
 
 type {{.InterfaceName}}Wrapper struct {
 	handler *{{.InterfaceName}}Imp
 	rootPath string
-	middleWares []func(*gin.Context)
+	middleWares []gin.HandlerFunc
 }
 
-func New{{.InterfaceName}}Wrapper(mid []func(*gin.Context)) *{{.InterfaceName}}Wrapper {
+func New{{.InterfaceName}}Wrapper(mid []gin.HandlerFunc) *{{.InterfaceName}}Wrapper {
 	out := &{{.InterfaceName}}Wrapper {
 		rootPath: "{{.RootPath}}",
 		handler: New{{.InterfaceName}}Imp(),
@@ -46,8 +46,15 @@ func New{{.InterfaceName}}Wrapper(mid []func(*gin.Context)) *{{.InterfaceName}}W
 }
 
 func (w *{{.InterfaceName}}Wrapper) Use(e *gin.Engine) {
+	w.Group(&e.RouterGroup)
+}
+
+// Group register the routes in a group of g at the root path, the
+// middlewares of Register run for every route
+func (w *{{.InterfaceName}}Wrapper) Group(g *gin.RouterGroup) {
+	r := g.Group(w.rootPath, w.middleWares...)
 	{{range $p:=.Parsers}}
-	{{if $p.HasRequestMapping}}e.{{$p.RequestMapping.Method}}(w.rootPath+"{{$p.RequestMapping.Path}}", w.{{$p.MethodName}}){{end}}{{end}}
+	{{if $p.HasRequestMapping}}r.{{$p.RequestMapping.Method}}("{{$p.RequestMapping.Path}}", {{$p.HandlersInTmpl}}){{end}}{{end}}
 }
 
 	`
@@ -88,59 +95,83 @@ func (imp *{{.InterfaceName}}Imp) {{.MethodName}}({{.GetParamInTmpl}}) ({{.GetRe
 
 	WrapperFuncTemplate = `
 func (w *{{.InterfaceName}}Wrapper) {{.MethodName}}(c *gin.Context) {
-	for _, mid := range w.middleWares {
-		mid(c)
-		if c.IsAborted() {
-			return
-		}
-	}
-
 	var _tmp string
 	_ = _tmp
 	var err error
-	{{range $val := .Params}} 
+	fail := func(err error) {
+		c.JSON({{.ErrorStatusInTmpl}}, 
+			model.NewResponse(model.WithError(err)))
+	}
+	{{if .HasRequireRoles}}
+	if err = helper.RequireRole(c, {{.RequireRolesInTmpl}}); err != nil {
+		fail(err)
+		return
+	}
+	{{end}}{{if .HasRequirePermissions}}
+	if err = helper.RequirePermission(c, {{.RequirePermissionsInTmpl}}); err != nil {
+		fail(err)
+		return
+	}
+	{{end}}{{range $val := .Params}} 
 	var {{$val.Name}} {{if $val.IsPointer}}= new({{end}}{{if ne $val.Package ""}}{{$val.Package}}.{{end}}{{$val.Type}}{{if $val.IsPointer}}){{end}}{{end}}
 	{{range $val:= .PathVariables}}
-	_tmp = c.GetParam("{{$val.Name}}")
+	_tmp = c.Param("{{$val.Name}}")
 	if _tmp != "" {
 		err = helper.BindStringToObject(_tmp, {{if not $val.Param.IsPointer}}&{{end}}{{$val.Param.Name}})
 		if err != nil {
-			c.JSON(200, 
-				model.NewResponse(model.WithError(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: {{$val.Name}}"))))
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: {{$val.Name}}"))
 			return 
 		}
 	}
 	{{end}}{{range $val:= .RequestParams}}
 	_tmp = c.Query("{{$val.Name}}")
 	{{if $val.Required}}if _tmp == "" {
-		c.JSON(200, 
-			model.NewResponse(model.WithError(errors.Wrap(errorcode.ErrParameterInvalid, "request param {{$val.Name}} is required"))))
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, "request param {{$val.Name}} is required"))
 		return
 	}{{end}}
 	if _tmp != "" {
 		err = helper.BindStringToObject(_tmp, {{if not $val.Param.IsPointer}}&{{end}}{{$val.Param.Name}})
 		if err != nil {
-			c.JSON(200, 
-				model.NewResponse(model.WithError(errors.Wrap(errorcode.ErrParameterInvalid, "request param {{$val.Name}}"))))
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "request param {{$val.Name}}"))
+			return 
+		}
+	}
+	{{end}}{{range $val:= .HeaderParams}}
+	_tmp = c.GetHeader("{{$val.Name}}")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, {{if not $val.Param.IsPointer}}&{{end}}{{$val.Param.Name}})
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "header {{$val.Name}}"))
+			return 
+		}
+	}
+	{{end}}{{range $val:= .CookieParams}}
+	_tmp, _ = c.Cookie("{{$val.Name}}")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, {{if not $val.Param.IsPointer}}&{{end}}{{$val.Param.Name}})
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "cookie {{$val.Name}}"))
 			return 
 		}
 	}
 	{{end}}{{if .HasURIBinding}}
 	if err = c.ShouldBindUri({{if not .URIBinding.IsPointer}}&{{end}}{{.URIBinding.Name}}); err != nil {
-		c.JSON(200, 
-			model.NewResponse(model.WithError(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))))
+		fail({{.BindErrorInTmpl .URIBinding}})
 		return
 	}
 	{{end}}{{if .HasBodyBinding}}
 	if err = c.ShouldBindJSON({{if not .BodyBinding.IsPointer}}&{{end}}{{.BodyBinding.Name}}); err != nil {
-		c.JSON(200, 
-			model.NewResponse(model.WithError(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))))
+		fail({{.BindErrorInTmpl .BodyBinding}})
 		return
 	}
 	{{end}}{{if .HasParamBinding}}
 	if err = c.ShouldBindQuery({{if not .ParamBinding.IsPointer}}&{{end}}{{.ParamBinding.Name}}); err != nil {
-		c.JSON(200, 
-			model.NewResponse(model.WithError(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))))
+		fail({{.BindErrorInTmpl .ParamBinding}})
+		return
+	}
+	{{end}}{{if .HasFormBinding}}
+	if err = helper.BindForm(c, {{if not .FormBinding.IsPointer}}&{{end}}{{.FormBinding.Name}}); err != nil {
+		fail({{.BindErrorInTmpl .FormBinding}})
 		return
 	}
 	{{end}}
@@ -149,11 +180,171 @@ func (w *{{.InterfaceName}}Wrapper) {{.MethodName}}(c *gin.Context) {
 	handler := w.handler.WithContext(ctx)
 	{{if .HasResponseData}}res, {{end}}err {{if .HasResponseData}}:{{end}}= handler.{{.MethodName}}({{.GetParamInFunc}})
 	if err != nil {
-		c.JSON(200, 
-			model.NewResponse(model.WithError(err)))
+		{{if .HasTimeout}}if ctx.Err() == context.DeadlineExceeded {
+			err = errors.Wrap(errorcode.ErrHTTPRequestTimeOut, err.Error())
+		}
+		{{end}}fail(err)
 		return
 	}
-	c.JSON(200, model.NewResponse(model.WithData({{if .HasResponseData}}res{{else}}nil{{end}})))
+	{{if .IsStream}}c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(_ io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case item, ok := <-res:
+			if !ok {
+				return false
+			}
+			c.SSEvent(helper.EventName(item), item)
+			return true
+		}
+	}){{else if .IsNoContent}}c.Status(204){{else}}c.JSON({{.SuccessStatus}}, model.NewResponse(model.WithData({{if .HasResponseData}}res{{else}}nil{{end}}))){{end}}
+}
+	`
+
+	ClientStructDefineTemplate = `
+
+// {{.InterfaceName}}Client {{.InterfaceName}} over http
+type {{.InterfaceName}}Client struct {
+	client *helper.Client
+	rootPath string
+	ctx context.Context
+}
+{{if .Complete}}
+var _ {{.InterfaceName}} = (*{{.InterfaceName}}Client)(nil)
+{{end}}
+func New{{.InterfaceName}}Client(baseURL string, opts ...helper.RequestOption) *{{.InterfaceName}}Client {
+	return &{{.InterfaceName}}Client{
+		client: helper.NewClient(baseURL, opts...),
+		rootPath: "{{.RootPath}}",
+		ctx: context.Background(),
+	}
+}
+
+// New{{.InterfaceName}}DiscoveryClient client of the service registered as name
+func New{{.InterfaceName}}DiscoveryClient(name string, opts ...helper.RequestOption) *{{.InterfaceName}}Client {
+	return New{{.InterfaceName}}Client("http://"+name,
+		append([]helper.RequestOption{api.WithDiscovery(name)}, opts...)...)
+}
+
+func (cli *{{.InterfaceName}}Client) WithContext(ctx context.Context) *{{.InterfaceName}}Client {
+	out := *cli
+	out.ctx = ctx
+	return &out
+}
+	`
+
+	ClientFuncTemplate = `
+{{if .Deprecated}}// {{.MethodName}} {{.RequestMapping.Method}} {{.RequestMapping.Path}}
+//
+// Deprecated: the route is deprecated
+{{end}}func (cli *{{.InterfaceName}}Client) {{.MethodName}}({{.GetParamInTmpl}}) ({{.GetResultTypesInTmpl}}) {
+	_req := helper.NewClientRequest("{{.RequestMapping.Method}}", cli.rootPath+"{{.RequestMapping.Path}}")
+	{{range $val:= .PathVariables}}_req.PathVariable("{{$val.Name}}", {{$val.Param.Name}})
+	{{end}}{{range $val:= .RequestParams}}_req.RequestParam("{{$val.Name}}", {{$val.Param.Name}})
+	{{end}}{{range $val:= .HeaderParams}}_req.BindHeader("{{$val.Name}}", {{$val.Param.Name}})
+	{{end}}{{range $val:= .CookieParams}}_req.BindCookie("{{$val.Name}}", {{$val.Param.Name}})
+	{{end}}{{if .HasURIBinding}}_req.BindURI({{.URIBinding.Name}})
+	{{end}}{{if .HasParamBinding}}_req.BindQuery({{.ParamBinding.Name}})
+	{{end}}{{if .HasBodyBinding}}_req.Body = {{.BodyBinding.Name}}
+	{{end}}{{if .HasFormBinding}}_req.Form = {{.FormBinding.Name}}
+	{{end}}{{if .IsStream}}return helper.ClientStream[{{.ResultDataInTmpl}}](cli.ctx, cli.client, _req){{else if .HasResponseData}}var _res {{.ResultDataInTmpl}}
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err{{else}}return cli.client.Do(cli.ctx, _req, nil){{end}}
+}
+	`
+
+	GrpcStructDefineTemplate = `
+
+func RegisterGrpc() {
+	api.RegisterGrpcService(New{{.InterfaceName}}Grpc())
+}
+
+// {{.InterfaceName}}Grpc {{.InterfaceName}} as the grpc service {{.GrpcServiceName}},
+// messages are encoded by the helper.GrpcCodecName codec
+type {{.InterfaceName}}Grpc struct {
+	handler *{{.InterfaceName}}Imp
+}
+
+func New{{.InterfaceName}}Grpc() *{{.InterfaceName}}Grpc {
+	return &{{.InterfaceName}}Grpc{
+		handler: New{{.InterfaceName}}Imp(),
+	}
+}
+
+func (g *{{.InterfaceName}}Grpc) Use(s *grpc.Server) {
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "{{.GrpcServiceName}}",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{ {{range $p:=.Parsers}}{{if $p.IsGrpc}}
+			{MethodName: "{{$p.GrpcMethod}}", Handler: g.{{$p.MethodName}}},{{end}}{{end}}
+		},
+		Streams: []grpc.StreamDesc{},
+	}, g)
+}
+	`
+
+	GrpcFuncTemplate = `
+func (g *{{.InterfaceName}}Grpc) {{.MethodName}}(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	{{if .HasParam}}var in {{.ParamTypeInTmpl}}
+	if err := dec(&in); err != nil {
+		return nil, helper.GrpcError(ctx, errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+	}
+	if err := helper.Validate(&in); err != nil {
+		return nil, helper.GrpcError(ctx, err)
+	}
+	{{else}}var in interface{}
+	if err := dec(&in); err != nil {
+		return nil, helper.GrpcError(ctx, errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+	}
+	{{end}}handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		{{if .HasResponseData}}res, {{end}}err := g.handler.WithContext(ctx).{{.MethodName}}({{if .HasParam}}req.({{.ParamTypeInTmpl}}){{end}})
+		if err != nil {
+			return nil, helper.GrpcError(ctx, err)
+		}
+		return {{if .HasResponseData}}res{{else}}nil{{end}}, nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{
+		Server:     g,
+		FullMethod: "/{{.GrpcServiceName}}/{{.GrpcMethod}}",
+	}, handler)
+}
+	`
+
+	KafkaStructDefineTemplate = `
+
+func RegisterKafka() {
+	k := New{{.InterfaceName}}Kafka(){{range $p:=.Parsers}}{{if $p.IsKafka}}
+	api.RegisterSteamMessageHandler(helper.NewStreamHandler("{{$p.KafkaTopic}}", "{{$p.KafkaGroup}}", k.{{$p.MethodName}})){{end}}{{end}}
+}
+
+// {{.InterfaceName}}Kafka {{.InterfaceName}} consuming json messages
+type {{.InterfaceName}}Kafka struct {
+	handler *{{.InterfaceName}}Imp
+}
+
+func New{{.InterfaceName}}Kafka() *{{.InterfaceName}}Kafka {
+	return &{{.InterfaceName}}Kafka{
+		handler: New{{.InterfaceName}}Imp(),
+	}
+}
+	`
+
+	KafkaFuncTemplate = `
+func (k *{{.InterfaceName}}Kafka) {{.MethodName}}(message []byte) error {
+	ctx := helper.NewMessageContext()
+	{{if .HasParam}}var in {{.ParamTypeInTmpl}}
+	if err := helper.DecodeMessage(message, &in); err != nil {
+		return helper.StreamError(err)
+	}
+	{{end}}{{if .HasResponseData}}_, {{end}}err := k.handler.WithContext(ctx).{{.MethodName}}({{if .HasParam}}in{{end}})
+	return helper.StreamError(err)
 }
 	`
 
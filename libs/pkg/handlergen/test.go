@@ -2,28 +2,90 @@ package handlergen
 
 import (
 	"context"
+	"mime/multipart"
+	"time"
 
 	"github.com/LSDXXX/libs/pkg/handlergen/helper"
 )
 
 type serviceTest struct{}
 
+type testReq struct {
+	Name string   `json:"name" binding:"required"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+type testForm struct {
+	Name string                `form:"name" binding:"required"`
+	File *multipart.FileHeader `form:"file"`
+}
+
+type testRes struct {
+	Id      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Parent  *testRes  `json:"parent"`
+	secret  string
+}
+
 func (s *serviceTest) WithContext(ctx context.Context) *serviceTest {
 	return s
 }
 
 //@RequestMapping(/test/haha)
 //@GenerateType(server)
+//@RequireRole(user, admin)
+//@ErrorStatus(ErrUnauthorized=401)
 type TestHandler interface {
 	//@RequestParam(haah=@id)
 	//@RequestMapping(/user, GET)
 	TestMethod(id *int) (int, error)
 
 	//@RequestMapping(/user1, GET)
+	//@RequireRole(admin)
+	//@RequirePermission(user:manage)
 	TestMethod2(id *int) (int, error)
 
 	//@RequestMapping(/user2, GET)
+	//@Middleware(audit, timing)
+	//@Timeout(1500ms)
+	//@Deprecated
 	TestNoRes(id *int) error
 
+	//@RequestMapping(/user/stream, GET)
+	//@RequestParam(id=@id)
+	//@Stream
+	TestStream(id *int) (<-chan int, error)
+
+	//@RequestMapping(/item/:id, PUT)
+	//@PathVariable(id=@id)
+	//@BindBody(req)
+	TestBody(id int, req testReq) (*testRes, error)
+
+	//@RequestMapping(/upload, POST)
+	//@BindHeader(X-Trace-Id=@trace)
+	//@BindCookie(session=@session)
+	//@BindForm(form)
+	//@Validate
+	//@Status(201)
+	//@ErrorStatus(ErrParameterInvalid=400, errorcode.ErrForbidden=403)
+	TestUpload(trace string, session string, form testForm) (*testRes, error)
+
+	helper.InjectServices1[*serviceTest]
+}
+
+//@RequestMapping(/test/transport)
+type TestTransport interface {
+	//@RequestMapping(/create, POST)
+	//@BindBody(req)
+	//@GrpcMethod
+	//@KafkaTopic(test.create, test-group)
+	TestCreate(req *testReq) (*testRes, error)
+
+	//@GrpcMethod(Ping)
+	TestPing() error
+
+	//@KafkaTopic(test.delete)
+	TestDelete(id int) error
+
 	helper.InjectServices1[*serviceTest]
 }
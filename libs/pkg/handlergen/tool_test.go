@@ -1,6 +1,13 @@
 package handlergen
 
-import "testing"
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
 
 func TestG(t *testing.T) {
 
@@ -12,9 +19,228 @@ func TestG(t *testing.T) {
 		ModelPackage:     "github.com/LSDXXX//libs/model",
 		InterfacePackage: "github.com/LSDXXX//libs/repo",
 		HelperPackage:    "github.com/LSDXXX//libs/pkg/handlergen/helper",
-		OutputPath:       "./",
+		OutputPath:       t.TempDir(),
 	})
 	if err != nil {
 		panic(err)
 	}
 }
+
+func TestOpenAPI(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "openapi.yml")
+	// operations of other handlers are kept, stale ones of this one dropped
+	old := `openapi: 3.0.0
+info:
+  title: service
+  version: 2.0.0
+paths:
+  /other:
+    get:
+      tags: [OtherHandler]
+      operationId: Other
+      responses: {}
+  /test/haha/removed:
+    get:
+      tags: [TestHandler]
+      operationId: Removed
+      responses: {}
+`
+	if err := ioutil.WriteFile(file, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := Parser{}
+	p.ParseFile("test.go")
+	g := Generator{}
+	err := g.Generate(&p, Config{
+		Package:       "handlergen",
+		HelperPackage: "github.com/LSDXXX/libs/pkg/handlergen/helper",
+		OutputPath:    dir,
+		OpenAPIPath:   file,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(file)
+	var doc OpenAPI
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info.Version != "2.0.0" || len(doc.Paths["/other"]) != 1 || len(doc.Paths["/test/haha/removed"]) != 0 {
+		t.Fatalf("not merged: %s", data)
+	}
+
+	op, ok := doc.Paths["/test/haha/item/{id}"]["put"]
+	if !ok {
+		t.Fatalf("missing operation: %s", data)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].In != "path" || op.Parameters[0].Schema.Type != "integer" {
+		t.Fatalf("unexpected parameters: %+v", op.Parameters)
+	}
+	if ref := op.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/testReq" {
+		t.Fatalf("unexpected body: %s", ref)
+	}
+	req := doc.Components.Schemas["testReq"]
+	if len(req.Required) != 1 || req.Required[0] != "name" || req.Properties["tags"].Items.Type != "string" {
+		t.Fatalf("unexpected request schema: %+v", req)
+	}
+	envelope := op.Responses["200"].Content["application/json"].Schema
+	if len(envelope.AllOf) != 2 || envelope.AllOf[0].Ref != "#/components/schemas/Response" ||
+		envelope.AllOf[1].Properties["data"].Ref != "#/components/schemas/testRes" {
+		t.Fatalf("unexpected response: %s", data)
+	}
+	res := doc.Components.Schemas["testRes"]
+	if res.Properties["created"].Format != "date-time" || res.Properties["parent"].Ref != "#/components/schemas/testRes" ||
+		res.Properties["secret"] != nil {
+		t.Fatalf("unexpected response schema: %+v", res)
+	}
+	if roles := doc.Paths["/test/haha/user1"]["get"].RequireRoles; len(roles) != 1 || roles[0] != "admin" {
+		t.Fatalf("unexpected roles: %v", roles)
+	}
+	if q := doc.Paths["/test/haha/user"]["get"].Parameters; len(q) != 1 || q[0].Name != "haah" || q[0].In != "query" {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+	if stream := doc.Paths["/test/haha/user/stream"]["get"].Responses["200"].Content["text/event-stream"]; stream.Schema.Type != "integer" {
+		t.Fatalf("unexpected stream: %s", data)
+	}
+
+	if !doc.Paths["/test/haha/user2"]["get"].Deprecated {
+		t.Fatalf("expect deprecated: %s", data)
+	}
+
+	upload := doc.Paths["/test/haha/upload"]["post"]
+	for _, status := range []string{"201", "400", "401", "403"} {
+		if _, ok := upload.Responses[status]; !ok {
+			t.Fatalf("missing status %s: %+v", status, upload.Responses)
+		}
+	}
+	if len(upload.Parameters) != 2 || upload.Parameters[0].In != "header" || upload.Parameters[1].In != "cookie" {
+		t.Fatalf("unexpected parameters: %+v", upload.Parameters)
+	}
+	form := upload.RequestBody.Content["multipart/form-data"].Schema
+	if form.Properties["file"].Format != "binary" || len(form.Required) != 1 || form.Required[0] != "name" {
+		t.Fatalf("unexpected form: %+v", form)
+	}
+}
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	p := Parser{}
+	p.ParseFile("test.go")
+	g := Generator{}
+	err := g.Generate(&p, Config{
+		Package:       "handlergen",
+		HelperPackage: "github.com/LSDXXX/libs/pkg/handlergen/helper",
+		OutputPath:    dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path.Join(dir, "test_handler_client.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper, err := ioutil.ReadFile(path.Join(dir, "test_handler_wrapper.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"helper.ErrorStatus(err, helper.Status{Err: errorcode.ErrParameterInvalid, Code: 400}, " +
+			"helper.Status{Err: errorcode.ErrForbidden, Code: 403}, helper.Status{Err: errorcode.ErrUnauthorized, Code: 401})",
+		`_tmp = c.GetHeader("X-Trace-Id")`,
+		`_tmp, _ = c.Cookie("session")`,
+		"if err = helper.BindForm(c, &form); err != nil {\n\t\tfail(helper.NewValidationError(err, &form))",
+		"c.JSON(201, model.NewResponse(model.WithData(res)))",
+		"r := g.Group(w.rootPath, w.middleWares...)",
+		`r.GET("/user2", helper.Timeout(1500*time.Millisecond), helper.Deprecated(), ` +
+			`helper.Middleware("audit"), helper.Middleware("timing"), w.TestNoRes)`,
+		"err = errors.Wrap(errorcode.ErrHTTPRequestTimeOut, err.Error())",
+	} {
+		if !strings.Contains(string(wrapper), want) {
+			t.Fatalf("missing %q in:\n%s", want, wrapper)
+		}
+	}
+	for _, want := range []string{
+		"var _ TestHandler = (*TestHandlerClient)(nil)",
+		"func (cli *TestHandlerClient) TestBody(id int, req testReq) (*testRes, error) {",
+		`helper.NewClientRequest("PUT", cli.rootPath+"/item/:id")`,
+		`_req.PathVariable("id", id)`,
+		`_req.RequestParam("haah", id)`,
+		"return helper.ClientStream[int](cli.ctx, cli.client, _req)",
+		"return cli.client.Do(cli.ctx, _req, nil)",
+		`_req.BindHeader("X-Trace-Id", trace)`,
+		`_req.BindCookie("session", session)`,
+		"_req.Form = form",
+		"// Deprecated: the route is deprecated",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+	}
+}
+
+func TestTransports(t *testing.T) {
+	dir := t.TempDir()
+	p := Parser{}
+	p.ParseFile("test.go")
+	g := Generator{}
+	err := g.Generate(&p, Config{
+		Package:       "handlergen",
+		HelperPackage: "github.com/LSDXXX/libs/pkg/handlergen/helper",
+		OutputPath:    dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadFile(path.Join(dir, "test_handler_grpc.gen.go")); err == nil {
+		t.Fatal("unexpected grpc service of TestHandler")
+	}
+	grpc, err := ioutil.ReadFile(path.Join(dir, "test_transport_grpc.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kafka, err := ioutil.ReadFile(path.Join(dir, "test_transport_kafka.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"api.RegisterGrpcService(NewTestTransportGrpc())",
+		`ServiceName: "handlergen.TestTransport"`,
+		`{MethodName: "TestCreate", Handler: g.TestCreate}`,
+		`{MethodName: "Ping", Handler: g.TestPing}`,
+		"var in *testReq",
+		"if err := helper.Validate(&in); err != nil {",
+		"res, err := g.handler.WithContext(ctx).TestCreate(req.(*testReq))",
+		`FullMethod: "/handlergen.TestTransport/Ping"`,
+	} {
+		if !strings.Contains(string(grpc), want) {
+			t.Fatalf("missing %q in:\n%s", want, grpc)
+		}
+	}
+	for _, want := range []string{
+		`api.RegisterSteamMessageHandler(helper.NewStreamHandler("test.create", "test-group", k.TestCreate))`,
+		`api.RegisterSteamMessageHandler(helper.NewStreamHandler("test.delete", "", k.TestDelete))`,
+		"if err := helper.DecodeMessage(message, &in); err != nil {",
+		"_, err := k.handler.WithContext(ctx).TestCreate(in)",
+		"return helper.StreamError(err)",
+	} {
+		if !strings.Contains(string(kafka), want) {
+			t.Fatalf("missing %q in:\n%s", want, kafka)
+		}
+	}
+}
+
+func TestTransportAccessRules(t *testing.T) {
+	mp := MethodParser{
+		MethodName:   "M",
+		Doc:          "M\n@GrpcMethod",
+		Results:      []param{{Type: "error"}},
+		RequireRoles: []string{"admin"},
+	}
+	if err := mp.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.checkTransports(); err == nil {
+		t.Fatal("expect access rules rejected over grpc")
+	}
+}
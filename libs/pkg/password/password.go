@@ -0,0 +1,113 @@
+// Package password hashes user passwords with argon2id and verifies
+// argon2id and bcrypt hashes.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	saltLen      = 16
+)
+
+// ErrInvalidHash the stored hash is in no known format
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Hash argon2id hash of plain in the PHC string format
+//
+//	@param plain
+//	@return string
+//	@return error
+func Hash(plain string) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "generate salt")
+	}
+	key := argon2.IDKey([]byte(plain), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify whether plain matches the hash, in constant time
+//
+//	@param hash argon2id or bcrypt hash
+//	@param plain
+//	@return bool
+//	@return error ErrInvalidHash when the hash cannot be parsed
+func Verify(hash, plain string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, plain)
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrap(ErrInvalidHash, err.Error())
+		}
+		return true, nil
+	}
+	return false, ErrInvalidHash
+}
+
+// VerifyLegacy compare a plain text password stored before hashing was
+// introduced, in constant time
+//
+//	@param stored
+//	@param plain
+//	@return bool
+func VerifyLegacy(stored, plain string) bool {
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1
+}
+
+// NeedsRehash whether the hash is not argon2id with the current parameters
+//
+//	@param hash
+//	@return bool
+func NeedsRehash(hash string) bool {
+	var version, memory, time, threads int
+	_, err := fmt.Sscanf(hash, "$argon2id$v=%d$m=%d,t=%d,p=%d$", &version, &memory, &time, &threads)
+	return err != nil || version != argon2.Version || memory != argonMemory ||
+		time != argonTime || threads != argonThreads
+}
+
+func verifyArgon2id(hash, plain string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrInvalidHash
+	}
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, ErrInvalidHash
+	}
+	got := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
@@ -0,0 +1,44 @@
+package password_test
+
+import (
+	"testing"
+
+	"github.com/LSDXXX/libs/pkg/password"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashVerify(t *testing.T) {
+	hash, err := password.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := password.Verify(hash, "secret"); !ok || err != nil {
+		t.Fatalf("expect match, got %v, %v", ok, err)
+	}
+	if ok, _ := password.Verify(hash, "Secret"); ok {
+		t.Fatal("expect mismatch")
+	}
+	if password.NeedsRehash(hash) {
+		t.Fatal("fresh hash should not need a rehash")
+	}
+	other, _ := password.Hash("secret")
+	if other == hash {
+		t.Fatal("hashes should be salted")
+	}
+}
+
+func TestVerifyBcrypt(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if ok, err := password.Verify(string(hash), "secret"); !ok || err != nil {
+		t.Fatalf("expect match, got %v, %v", ok, err)
+	}
+	if !password.NeedsRehash(string(hash)) {
+		t.Fatal("bcrypt hash should be rehashed")
+	}
+	if _, err := password.Verify("secret", "secret"); err != password.ErrInvalidHash {
+		t.Fatalf("expect invalid hash, got %v", err)
+	}
+	if !password.VerifyLegacy("secret", "secret") || password.VerifyLegacy("secret", "secre") {
+		t.Fatal("unexpected legacy comparison")
+	}
+}
@@ -0,0 +1,32 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const labelPolicy = "policy"
+
+var (
+	// websocket 丢弃的消息计数
+	wsDroppedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "websocket_dropped_messages_total",
+		Help: "The number of messages dropped because the queue of a client or of the manager was full.",
+	})
+
+	// websocket 慢客户端计数
+	wsSlowClientCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_slow_clients_total",
+		Help: "The number of times a client queue was full (per slow policy).",
+	}, []string{labelPolicy})
+)
+
+// WSDroppedCounterInc inc dropped websocket messages
+func WSDroppedCounterInc() {
+	wsDroppedCounter.Inc()
+}
+
+// WSSlowClientCounterInc inc slow websocket clients
+func WSSlowClientCounterInc(policy string) {
+	wsSlowClientCounter.With(map[string]string{labelPolicy: policy}).Inc()
+}
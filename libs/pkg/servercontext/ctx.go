@@ -76,7 +76,7 @@ func ExtractFromHTTP(c context.Context, ginc *gin.Context) context.Context {
 		}
 		req.Body = io.NopCloser(bytes.NewBuffer(data))
 	}
-	newCtx := context.WithValue(context.Background(), ctxKey, &ctx)
+	newCtx := context.WithValue(c, ctxKey, &ctx)
 	return newCtx
 }
 
@@ -0,0 +1,61 @@
+package wsmanager
+
+import (
+	"sync"
+)
+
+// Broker delivers the sends of any instance to the managers of every
+// instance, including the sending one
+type Broker interface {
+	// Publish send the message to every subscriber, messages with the same
+	// key are delivered in order
+	Publish(key string, message []byte) error
+	// Subscribe call fn with every published message, fn blocks at most
+	// the write timeout of the manager
+	Subscribe(fn func(message []byte)) error
+}
+
+// brokerMessage envelope of a send passed through the broker
+type brokerMessage struct {
+	// Kind send, group or all
+	Kind    string `json:"kind"`
+	Id      string `json:"id,omitempty"`
+	Group   string `json:"group,omitempty"`
+	Message []byte `json:"message"`
+}
+
+const (
+	kindSend  = "send"
+	kindGroup = "group"
+	kindAll   = "all"
+)
+
+// MemoryBroker broker of a single instance, managers sharing it behave
+// like instances of a cluster
+type MemoryBroker struct {
+	mu  sync.RWMutex
+	fns []func([]byte)
+}
+
+// NewMemoryBroker new
+//
+//	@return *MemoryBroker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(key string, message []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.fns {
+		fn(message)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(fn func([]byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fns = append(b.fns, fn)
+	return nil
+}
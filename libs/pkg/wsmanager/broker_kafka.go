@@ -0,0 +1,68 @@
+package wsmanager
+
+import (
+	"sync"
+
+	"github.com/LSDXXX/libs/infra"
+	"github.com/pkg/errors"
+)
+
+// KafkaBroker kafka topic, every instance consumes it in its own consumer
+// group. It is a stream message handler and must be registered with
+// api.RegisterSteamMessageHandler before the app starts
+type KafkaBroker struct {
+	producer infra.Producer
+	topic    string
+	groupID  string
+	mu       sync.RWMutex
+	fns      []func([]byte)
+}
+
+// NewKafkaBroker new
+//
+//	@param producer
+//	@param topic
+//	@param node id of the instance, names its consumer group
+//	@return *KafkaBroker
+func NewKafkaBroker(producer infra.Producer, topic, node string) *KafkaBroker {
+	return &KafkaBroker{
+		producer: producer,
+		topic:    topic,
+		groupID:  topic + "-" + node,
+	}
+}
+
+func (b *KafkaBroker) Publish(key string, message []byte) error {
+	var err error
+	if len(key) == 0 {
+		err = b.producer.ProduceMessage(b.topic, message)
+	} else {
+		// one partition per key keeps the messages of a group in order
+		err = b.producer.ProduceMessageWithKey(b.topic, []byte(key), message)
+	}
+	return errors.Wrap(err, "produce websocket message")
+}
+
+func (b *KafkaBroker) Subscribe(fn func([]byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fns = append(b.fns, fn)
+	return nil
+}
+
+func (b *KafkaBroker) Topic() string {
+	return b.topic
+}
+
+func (b *KafkaBroker) GroupID() string {
+	return b.groupID
+}
+
+func (b *KafkaBroker) Process(message []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.fns {
+		fn(message)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package wsmanager
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// redisSubscriber both redis.Client and redis.ClusterClient
+type redisSubscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// RedisBroker redis pub/sub, messages published while an instance is
+// disconnected from redis are lost for it
+type RedisBroker struct {
+	client  redis.Cmdable
+	channel string
+}
+
+// NewRedisBroker new
+//
+//	@param client
+//	@param channel
+//	@return *RedisBroker
+func NewRedisBroker(client redis.Cmdable, channel string) *RedisBroker {
+	return &RedisBroker{
+		client:  client,
+		channel: channel,
+	}
+}
+
+func (b *RedisBroker) Publish(key string, message []byte) error {
+	err := b.client.Publish(context.Background(), b.channel, message).Err()
+	return errors.Wrap(err, "publish websocket message")
+}
+
+func (b *RedisBroker) Subscribe(fn func([]byte)) error {
+	sub, ok := b.client.(redisSubscriber)
+	if !ok {
+		return errors.New("redis client does not support pub/sub")
+	}
+	ctx := context.Background()
+	pubsub := sub.Subscribe(ctx, b.channel)
+	// wait for the subscription, so no message published after it is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return errors.Wrap(err, "subscribe websocket channel")
+	}
+	go func() {
+		for msg := range pubsub.Channel() {
+			fn([]byte(msg.Payload))
+		}
+		logrus.Warnf("websocket channel %s closed", b.channel)
+	}()
+	return nil
+}
@@ -0,0 +1,74 @@
+package wsmanager
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Presence cluster wide registry of the connected clients
+type Presence interface {
+	// Join the client of the group connected to the node
+	Join(node, group, id string) error
+	// Leave the client disconnected
+	Leave(node, group, id string) error
+	// Clients ids of the clients of the group connected to any live node
+	Clients(group string) ([]string, error)
+	// KeepAlive the node is alive for ttl, clients of dead nodes are not
+	// reported any more
+	KeepAlive(node string, ttl time.Duration) error
+}
+
+// MemoryPresence presence of a single instance
+type MemoryPresence struct {
+	mu     sync.Mutex
+	groups map[string]map[string]string
+}
+
+// NewMemoryPresence new
+//
+//	@return *MemoryPresence
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{
+		groups: make(map[string]map[string]string),
+	}
+}
+
+func (p *MemoryPresence) Join(node, group, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.groups[group] == nil {
+		p.groups[group] = make(map[string]string)
+	}
+	p.groups[group][id] = node
+	return nil
+}
+
+func (p *MemoryPresence) Leave(node, group, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// the client may have reconnected to another node meanwhile
+	if p.groups[group][id] != node {
+		return nil
+	}
+	delete(p.groups[group], id)
+	if len(p.groups[group]) == 0 {
+		delete(p.groups, group)
+	}
+	return nil
+}
+
+func (p *MemoryPresence) Clients(group string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ids []string
+	for id := range p.groups[group] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (p *MemoryPresence) KeepAlive(string, time.Duration) error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package wsmanager
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+const (
+	presenceKeyPrefix = "ws_presence:"
+	nodeKeyPrefix     = "ws_node:"
+)
+
+// RedisPresence presence shared by all instances, a hash per group maps
+// client ids to nodes and a key per node expires when the node dies
+type RedisPresence struct {
+	client redis.Cmdable
+}
+
+// NewRedisPresence new
+//
+//	@param client
+//	@return *RedisPresence
+func NewRedisPresence(client redis.Cmdable) *RedisPresence {
+	return &RedisPresence{
+		client: client,
+	}
+}
+
+func (p *RedisPresence) Join(node, group, id string) error {
+	err := p.client.HSet(context.Background(), presenceKeyPrefix+group, id, node).Err()
+	return errors.Wrap(err, "join presence")
+}
+
+// leaveScript delete the client only if it is still on the node
+var leaveScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+func (p *RedisPresence) Leave(node, group, id string) error {
+	err := leaveScript.Run(context.Background(), p.client, []string{presenceKeyPrefix + group}, id, node).Err()
+	if err == redis.Nil {
+		err = nil
+	}
+	return errors.Wrap(err, "leave presence")
+}
+
+func (p *RedisPresence) Clients(group string) ([]string, error) {
+	ctx := context.Background()
+	clients, err := p.client.HGetAll(ctx, presenceKeyPrefix+group).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "get presence")
+	}
+	alive := make(map[string]bool)
+	var ids, stale []string
+	for id, node := range clients {
+		live, ok := alive[node]
+		if !ok {
+			n, err := p.client.Exists(ctx, nodeKeyPrefix+node).Result()
+			if err != nil {
+				return nil, errors.Wrap(err, "check presence node")
+			}
+			live = n > 0
+			alive[node] = live
+		}
+		if live {
+			ids = append(ids, id)
+		} else {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		// best effort, a client reconnecting meanwhile joins again on its next connect
+		_ = p.client.HDel(ctx, presenceKeyPrefix+group, stale...).Err()
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (p *RedisPresence) KeepAlive(node string, ttl time.Duration) error {
+	err := p.client.Set(context.Background(), nodeKeyPrefix+node, 1, ttl).Err()
+	return errors.Wrap(err, "keep presence node alive")
+}
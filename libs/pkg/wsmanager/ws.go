@@ -2,10 +2,17 @@ package wsmanager
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/LSDXXX/libs/config"
 	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/pkg/prometheus"
 	"github.com/LSDXXX/libs/pkg/util"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -22,6 +29,81 @@ type WSManager struct {
 	Message                 chan *MessageData
 	GroupMessage            chan *GroupMessageData
 	BroadCastMessage        chan *BroadCastMessageData
+
+	conf config.WebSocketConfig
+	// node id of this instance in the broker and presence
+	node     string
+	broker   Broker
+	presence Presence
+	// droppedCount messages dropped because a client or manager queue was
+	// full, slowCount times a client queue was full
+	droppedCount, slowCount uint64
+}
+
+// presenceTTL a node not kept alive for it is considered dead
+const presenceTTL = 30 * time.Second
+
+// Option option of the manager
+type Option func(*WSManager)
+
+// WithConfig heartbeat and backpressure settings, zero fields keep the
+// defaults. A pong timeout not longer than the ping interval would time
+// out healthy clients, it is raised to twice the interval
+//
+//	@param conf
+//	@return Option
+func WithConfig(conf config.WebSocketConfig) Option {
+	return func(m *WSManager) {
+		if conf.PingInterval > 0 {
+			m.conf.PingInterval = conf.PingInterval
+		}
+		if conf.PongTimeout > 0 {
+			m.conf.PongTimeout = conf.PongTimeout
+		}
+		if conf.WriteTimeout > 0 {
+			m.conf.WriteTimeout = conf.WriteTimeout
+		}
+		if conf.QueueSize > 0 {
+			m.conf.QueueSize = conf.QueueSize
+		}
+		if len(conf.SlowPolicy) > 0 {
+			m.conf.SlowPolicy = conf.SlowPolicy
+		}
+		if conf.MaxMessageSize > 0 {
+			m.conf.MaxMessageSize = conf.MaxMessageSize
+		}
+		if len(conf.NodeId) > 0 {
+			m.node = conf.NodeId
+		}
+		if m.conf.PongTimeout <= m.conf.PingInterval {
+			logrus.Warnf("websocket pong timeout %s not longer than ping interval %s, use %s",
+				m.conf.PongTimeout, m.conf.PingInterval, 2*m.conf.PingInterval)
+			m.conf.PongTimeout = 2 * m.conf.PingInterval
+		}
+		m.conf.AllowedOrigins = conf.AllowedOrigins
+		m.conf.Subprotocols = conf.Subprotocols
+		m.conf.Compression = conf.Compression
+	}
+}
+
+// WithBroker deliver sends to the clients of every instance
+//
+//	@param broker
+//	@return Option
+func WithBroker(broker Broker) Option {
+	return func(m *WSManager) {
+		m.broker = broker
+	}
+}
+
+// WithPresence register the clients in the presence
+//
+//	@param presence
+//	@return Option
+func WithPresence(presence Presence) Option {
+	return func(m *WSManager) {
+		m.presence = presence
+	}
 }
 
 // WSEventHandler handler
@@ -32,6 +114,30 @@ type WSEventHandler interface {
 	OnClientMessage(*WSClient, []byte) error
 }
 
+// WSSubprotocolHandler optional, a handler implementing it speaks these
+// subprotocols, in order of preference
+type WSSubprotocolHandler interface {
+	Subprotocols() []string
+}
+
+// TokenProtocolPrefix browsers cannot set the Authorization header of a
+// websocket, they may offer the access token as the subprotocol
+// "bearer.<token>" next to a supported one. It is never selected
+const TokenProtocolPrefix = "bearer."
+
+// SubprotocolToken access token offered as a subprotocol
+//
+//	@param r
+//	@return string empty if none
+func SubprotocolToken(r *http.Request) string {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, TokenProtocolPrefix) {
+			return strings.TrimPrefix(protocol, TokenProtocolPrefix)
+		}
+	}
+	return ""
+}
+
 // WSClient client
 type WSClient struct {
 	Id, Group string
@@ -39,6 +145,8 @@ type WSClient struct {
 	Message   chan []byte
 	Manager   *WSManager
 	handler   WSEventHandler
+	// closing set once the client is disconnected for being slow
+	closing int32
 }
 
 // MessageData message info
@@ -69,11 +177,21 @@ func (c *WSClient) Read() {
 		}
 	}()
 
+	conf := c.Manager.conf
+	if conf.MaxMessageSize > 0 {
+		c.Socket.SetReadLimit(conf.MaxMessageSize)
+	}
+	// a client which neither answers pings nor sends anything is dead
+	_ = c.Socket.SetReadDeadline(time.Now().Add(conf.PongTimeout))
+	c.Socket.SetPongHandler(func(string) error {
+		return c.Socket.SetReadDeadline(time.Now().Add(conf.PongTimeout))
+	})
 	for {
 		messageType, message, err := c.Socket.ReadMessage()
 		if err != nil || messageType == websocket.CloseMessage {
 			break
 		}
+		_ = c.Socket.SetReadDeadline(time.Now().Add(conf.PongTimeout))
 		logrus.Infof("client [%s] receive message: %s", c.Id, string(message))
 		c.handler.OnClientMessage(c, message)
 	}
@@ -82,8 +200,12 @@ func (c *WSClient) Read() {
 // Write description
 // @receiver c
 func (c *WSClient) Write() {
+	conf := c.Manager.conf
+	ticker := time.NewTicker(conf.PingInterval)
 	defer func() {
+		ticker.Stop()
 		logrus.Infof("client [%s] disconnect", c.Id)
+		// also stops Read, which unregisters the client
 		if err := c.Socket.Close(); err != nil {
 			logrus.Infof("client [%s] disconnect err: %s", c.Id, err)
 		}
@@ -92,6 +214,7 @@ func (c *WSClient) Write() {
 	for {
 		select {
 		case message, ok := <-c.Message:
+			_ = c.Socket.SetWriteDeadline(time.Now().Add(conf.WriteTimeout))
 			if !ok {
 				_ = c.Socket.WriteMessage(websocket.CloseMessage, []byte{})
 				return
@@ -100,11 +223,64 @@ func (c *WSClient) Write() {
 			err := c.Socket.WriteMessage(websocket.BinaryMessage, message)
 			if err != nil {
 				logrus.Infof("client [%s] writemessage err: %s", c.Id, err)
+				return
+			}
+		case <-ticker.C:
+			err := c.Socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(conf.WriteTimeout))
+			if err != nil {
+				logrus.Infof("client [%s] ping err: %s", c.Id, err)
+				return
 			}
 		}
 	}
 }
 
+// push queue the message without blocking, a full queue is handled by the
+// slow policy. Called with manager.Lock held so Message is not closed meanwhile
+//
+//	@receiver c
+//	@param message
+func (c *WSClient) push(message []byte) {
+	if atomic.LoadInt32(&c.closing) == 1 {
+		// disconnected, nothing may follow the messages it lost
+		return
+	}
+	select {
+	case c.Message <- message:
+		return
+	default:
+	}
+	manager := c.Manager
+	policy := manager.conf.SlowPolicy
+	atomic.AddUint64(&manager.droppedCount, 1)
+	prometheus.WSDroppedCounterInc()
+	if policy == config.WebSocketDisconnect {
+		// count the client once, the queue stays full until it is unregistered
+		if !c.disconnect("too slow") {
+			return
+		}
+	} else {
+		logrus.Warnf("client [%s] too slow, drop message", c.Id)
+	}
+	atomic.AddUint64(&manager.slowCount, 1)
+	prometheus.WSSlowClientCounterInc(policy)
+}
+
+// disconnect close the connection once, the client can tell it lost
+// messages and resync when it reconnects
+//
+//	@receiver c
+//	@param reason
+//	@return bool false if it is already closing
+func (c *WSClient) disconnect(reason string) bool {
+	if !atomic.CompareAndSwapInt32(&c.closing, 0, 1) {
+		return false
+	}
+	logrus.Warnf("client [%s] %s, disconnect", c.Id, reason)
+	_ = c.Socket.Close()
+	return true
+}
+
 // 启动 websocket 管理器
 func (manager *WSManager) start() {
 	logrus.Infof("websocket manage start")
@@ -124,6 +300,9 @@ func (manager *WSManager) start() {
 			manager.Group[client.Group][client.Id] = client
 			manager.clientCount += 1
 			manager.Lock.Unlock()
+			if err := manager.presence.Join(manager.node, client.Group, client.Id); err != nil {
+				logrus.Errorf("client [%s] join presence error: %s", client.Id, err)
+			}
 
 		// 注销
 		case client := <-manager.UnRegister:
@@ -143,6 +322,9 @@ func (manager *WSManager) start() {
 				}
 			}
 			manager.Lock.Unlock()
+			if err := manager.presence.Leave(manager.node, client.Group, client.Id); err != nil {
+				logrus.Errorf("client [%s] leave presence error: %s", client.Id, err)
+			}
 
 			// 发送广播数据到某个组的 channel 变量 Send 中
 			//case data := <-manager.boardCast:
@@ -163,7 +345,7 @@ func (manager *WSManager) sendService() {
 			manager.Lock.Lock()
 			if groupMap, ok := manager.Group[data.Group]; ok {
 				if conn, ok := groupMap[data.Id]; ok {
-					conn.Message <- data.Message
+					conn.push(data.Message)
 				}
 			}
 			manager.Lock.Unlock()
@@ -180,7 +362,7 @@ func (manager *WSManager) sendGroupService() {
 			manager.Lock.Lock()
 			if groupMap, ok := manager.Group[data.Group]; ok {
 				for _, conn := range groupMap {
-					conn.Message <- data.Message
+					conn.push(data.Message)
 				}
 			}
 			manager.Lock.Unlock()
@@ -196,7 +378,7 @@ func (manager *WSManager) sendAllService() {
 			manager.Lock.Lock()
 			for _, v := range manager.Group {
 				for _, conn := range v {
-					conn.Message <- data.Message
+					conn.push(data.Message)
 				}
 			}
 			manager.Lock.Unlock()
@@ -204,19 +386,19 @@ func (manager *WSManager) sendAllService() {
 	}
 }
 
-// Send send
+// Send send to the client, which may be connected to any instance
 //
 //	@receiver manager
 //	@param id
 //	@param group
 //	@param message
 func (manager *WSManager) Send(id string, group string, message []byte) {
-	data := &MessageData{
+	manager.publish(group, &brokerMessage{
+		Kind:    kindSend,
 		Id:      id,
 		Group:   group,
 		Message: message,
-	}
-	manager.Message <- data
+	})
 }
 
 // SendGroup group send
@@ -225,11 +407,11 @@ func (manager *WSManager) Send(id string, group string, message []byte) {
 //	@param group
 //	@param message
 func (manager *WSManager) SendGroup(group string, message []byte) {
-	data := &GroupMessageData{
+	manager.publish(group, &brokerMessage{
+		Kind:    kindGroup,
 		Group:   group,
 		Message: message,
-	}
-	manager.GroupMessage <- data
+	})
 }
 
 // SendAll 广播
@@ -237,10 +419,104 @@ func (manager *WSManager) SendGroup(group string, message []byte) {
 //	@receiver manager
 //	@param message
 func (manager *WSManager) SendAll(message []byte) {
-	data := &BroadCastMessageData{
+	manager.publish("", &brokerMessage{
+		Kind:    kindAll,
 		Message: message,
+	})
+}
+
+// publish pass the send through the broker, it is delivered locally when
+// the broker fails so the clients of this instance still get it
+func (manager *WSManager) publish(key string, msg *brokerMessage) {
+	data, _ := json.Marshal(msg)
+	if err := manager.broker.Publish(key, data); err != nil {
+		logrus.Errorf("publish websocket message error: %s", err)
+		manager.deliver(msg)
+	}
+}
+
+// receive a message of the broker
+func (manager *WSManager) receive(data []byte) {
+	var msg brokerMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		logrus.Errorf("invalid broker message: %s", err)
+		return
+	}
+	manager.deliver(&msg)
+}
+
+// deliver queue the send for the clients of this instance, waiting at
+// most the write timeout so a stalled instance does not hold up the
+// broker or the sender. The clients of a send which cannot be queued are
+// disconnected, they must not go on missing a message silently
+func (manager *WSManager) deliver(msg *brokerMessage) {
+	timer := time.NewTimer(manager.conf.WriteTimeout)
+	defer timer.Stop()
+	switch msg.Kind {
+	case kindSend:
+		select {
+		case manager.Message <- &MessageData{Id: msg.Id, Group: msg.Group, Message: msg.Message}:
+			return
+		case <-timer.C:
+		}
+	case kindGroup:
+		select {
+		case manager.GroupMessage <- &GroupMessageData{Group: msg.Group, Message: msg.Message}:
+			return
+		case <-timer.C:
+		}
+	case kindAll:
+		select {
+		case manager.BroadCastMessage <- &BroadCastMessageData{Message: msg.Message}:
+			return
+		case <-timer.C:
+		}
+	default:
+		return
+	}
+	atomic.AddUint64(&manager.droppedCount, 1)
+	prometheus.WSDroppedCounterInc()
+	logrus.Warnf("websocket %s queue full, drop message", msg.Kind)
+	manager.disconnect(msg)
+}
+
+// disconnect the clients of this instance msg was meant for
+func (manager *WSManager) disconnect(msg *brokerMessage) {
+	manager.Lock.Lock()
+	defer manager.Lock.Unlock()
+	for group, clients := range manager.Group {
+		if msg.Kind != kindAll && group != msg.Group {
+			continue
+		}
+		for id, c := range clients {
+			if msg.Kind == kindSend && id != msg.Id {
+				continue
+			}
+			c.disconnect("lost a message")
+		}
+	}
+}
+
+// Online ids of the clients of the group connected to any instance
+//
+//	@receiver manager
+//	@param group
+//	@return []string
+//	@return error
+func (manager *WSManager) Online(group string) ([]string, error) {
+	return manager.presence.Clients(group)
+}
+
+// keepAlive mark this instance alive in the presence
+func (manager *WSManager) keepAlive() {
+	ticker := time.NewTicker(presenceTTL / 3)
+	defer ticker.Stop()
+	for {
+		if err := manager.presence.KeepAlive(manager.node, presenceTTL); err != nil {
+			logrus.Errorf("keep websocket node alive error: %s", err)
+		}
+		<-ticker.C
 	}
-	manager.BroadCastMessage <- data
 }
 
 // RegisterClient 注册
@@ -275,6 +551,23 @@ func (manager *WSManager) LenClient() uint {
 	return manager.clientCount
 }
 
+// DroppedMessages messages dropped because a client or manager queue was full
+//
+//	@receiver manager
+//	@return uint64
+func (manager *WSManager) DroppedMessages() uint64 {
+	return atomic.LoadUint64(&manager.droppedCount)
+}
+
+// SlowClients times a client queue was full, a disconnected client is
+// counted once
+//
+//	@receiver manager
+//	@return uint64
+func (manager *WSManager) SlowClients() uint64 {
+	return atomic.LoadUint64(&manager.slowCount)
+}
+
 // Info manager info
 //
 //	@receiver manager
@@ -288,13 +581,16 @@ func (manager *WSManager) Info() map[string]interface{} {
 	managerInfo["chanMessageLen"] = len(manager.Message)
 	managerInfo["chanGroupMessageLen"] = len(manager.GroupMessage)
 	managerInfo["chanBroadCastMessageLen"] = len(manager.BroadCastMessage)
+	managerInfo["droppedMessages"] = manager.DroppedMessages()
+	managerInfo["slowClients"] = manager.SlowClients()
 	return managerInfo
 }
 
 // NewWSManager new
 //
+//	@param opts
 //	@return *WSManager
-func New() *WSManager {
+func New(opts ...Option) *WSManager {
 	manager := &WSManager{
 		Group:            make(map[string]map[string]*WSClient),
 		Register:         make(chan *WSClient, 128),
@@ -304,7 +600,23 @@ func New() *WSManager {
 		BroadCastMessage: make(chan *BroadCastMessageData, 128),
 		groupCount:       0,
 		clientCount:      0,
+		node:             uuid.NewString(),
+		broker:           NewMemoryBroker(),
+		presence:         NewMemoryPresence(),
+		conf: config.WebSocketConfig{
+			PingInterval:   30 * time.Second,
+			PongTimeout:    60 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			QueueSize:      256,
+			SlowPolicy:     config.WebSocketDisconnect,
+			MaxMessageSize: 64 << 10,
+		},
 	}
+	for _, opt := range opts {
+		opt(manager)
+	}
+	util.PanicWhenError(manager.broker.Subscribe(manager.receive))
+	go manager.keepAlive()
 	go manager.start()
 	go manager.sendGroupService()
 	go manager.sendService()
@@ -353,39 +665,83 @@ func (ws *wsEventHandlerWrapper) OnClientMessage(c *WSClient, message []byte) er
 	return ws.handler.OnClientMessage(c, message)
 }
 
-// BuildHTTPHandler  build http handler
+// checkOrigin allow requests of the same origin, of the allowed origins and
+// without an origin, which do not come from a browser
+//
+//	@receiver manager
+//	@param r
+//	@return bool
+func (manager *WSManager) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range manager.conf.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		switch {
+		case allowed == "*", allowed == strings.ToLower(origin):
+			return true
+		// *.example.com matches the subdomains of example.com
+		case strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// BuildHTTPHandler  build http handler, the origin is checked before the
+// handler authenticates the request
 //
 //	@receiver manager
 //	@param handler
-//	@return *gin.Context
 //	@return func(*gin.Context)
 func (manager *WSManager) BuildHTTPHandler(handler WSEventHandler) func(*gin.Context) {
+	var protocols []string
+	if h, ok := handler.(WSSubprotocolHandler); ok {
+		protocols = append(protocols, h.Subprotocols()...)
+	}
+	protocols = append(protocols, manager.conf.Subprotocols...)
+	upGrader := websocket.Upgrader{
+		CheckOrigin: manager.checkOrigin,
+		// only supported ones are selected, never the offered token
+		Subprotocols:      protocols,
+		EnableCompression: manager.conf.Compression,
+	}
 	handler = &wsEventHandlerWrapper{
 		handler: handler,
 	}
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 
+		if !manager.checkOrigin(c.Request) {
+			log.WithContext(ctx).Warnf("websocket origin %s not allowed", c.GetHeader("Origin"))
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
 		groupID, clientID, err := handler.OnUpgrade(c, manager)
 		if err != nil {
 			log.WithContext(ctx).Errorf("handle upgrade event error: %+v", err)
+			// the handler may have answered already, e.g. by an auth middleware
+			if !c.Writer.Written() {
+				c.AbortWithStatus(http.StatusUnauthorized)
+			}
 			return
 		}
 		if len(clientID) == 0 {
 			clientID = uuid.NewString()
 		}
-		upGrader := websocket.Upgrader{
-			// cross origin domain
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
-			// 处理 Sec-WebSocket-Protocol Header
-			Subprotocols: []string{c.GetHeader("Sec-WebSocket-Protocol")},
-		}
 
 		conn, err := upGrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
-			logrus.Infof("websocket connect error: %s", c.Param("channel"))
+			logrus.Infof("websocket connect error: %s", err)
 			return
 		}
 
@@ -394,7 +750,7 @@ func (manager *WSManager) BuildHTTPHandler(handler WSEventHandler) func(*gin.Con
 			Group:   groupID,
 			Socket:  conn,
 			Manager: manager,
-			Message: make(chan []byte, 1024),
+			Message: make(chan []byte, manager.conf.QueueSize),
 			handler: handler,
 		}
 
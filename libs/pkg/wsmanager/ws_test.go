@@ -0,0 +1,298 @@
+package wsmanager_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LSDXXX/libs/config"
+	"github.com/LSDXXX/libs/pkg/wsmanager"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// testHandler clients join the group and use the id of the query
+type testHandler struct {
+	registered, deregistered chan string
+}
+
+func (h *testHandler) OnUpgrade(c *gin.Context, _ *wsmanager.WSManager) (string, string, error) {
+	return c.Query("group"), c.Query("id"), nil
+}
+
+func (h *testHandler) OnClientRegister(c *wsmanager.WSClient) {
+	h.registered <- c.Id
+}
+
+func (h *testHandler) OnClientDeregister(c *wsmanager.WSClient) {
+	h.deregistered <- c.Id
+}
+
+func (h *testHandler) OnClientMessage(*wsmanager.WSClient, []byte) error {
+	return nil
+}
+
+func (h *testHandler) Subprotocols() []string {
+	return []string{"test.v1"}
+}
+
+func newServer(t *testing.T, conf config.WebSocketConfig, opts ...wsmanager.Option) (*wsmanager.WSManager, *testHandler, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	manager := wsmanager.New(append([]wsmanager.Option{wsmanager.WithConfig(conf)}, opts...)...)
+	handler := &testHandler{
+		registered:   make(chan string, 16),
+		deregistered: make(chan string, 16),
+	}
+	e := gin.New()
+	e.GET("/ws", manager.BuildHTTPHandler(handler))
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return manager, handler, "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func dial(t *testing.T, url, group, id string, h *testHandler) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?group="+group+"&id="+id, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitId(t, h.registered, id)
+	return conn
+}
+
+func waitId(t *testing.T, ch chan string, id string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-ch:
+			if got == id {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("client %s not seen", id)
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	_, h, url := newServer(t, config.WebSocketConfig{
+		PingInterval: 20 * time.Millisecond,
+		PongTimeout:  100 * time.Millisecond,
+	})
+	alive := dial(t, url, "g", "alive", h)
+	go func() {
+		// reading answers the pings
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	// never reads, so never answers a ping
+	dial(t, url, "g", "dead", h)
+
+	waitId(t, h.deregistered, "dead")
+	select {
+	case id := <-h.deregistered:
+		t.Fatalf("client %s should stay connected", id)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestPongTimeoutClamped(t *testing.T) {
+	_, h, url := newServer(t, config.WebSocketConfig{
+		PingInterval: 20 * time.Millisecond,
+		PongTimeout:  10 * time.Millisecond,
+	})
+	alive := dial(t, url, "g", "alive", h)
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case id := <-h.deregistered:
+		t.Fatalf("client %s should stay connected", id)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// flood send large messages to a group which does not read them
+func flood(manager *wsmanager.WSManager, group string) {
+	big := bytes.Repeat([]byte("x"), 1<<19)
+	for i := 0; i < 64; i++ {
+		manager.SendGroup(group, big)
+	}
+}
+
+func TestSlowClientDrop(t *testing.T) {
+	manager, h, url := newServer(t, config.WebSocketConfig{
+		QueueSize:    1,
+		WriteTimeout: time.Minute,
+		SlowPolicy:   config.WebSocketDrop,
+	})
+	dial(t, url, "slow", "slow", h)
+	fast := dial(t, url, "fast", "fast", h)
+
+	flood(manager, "slow")
+	// the slow client must not stall the others
+	manager.Send("fast", "fast", []byte("hi"))
+	_ = fast.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, data, err := fast.ReadMessage(); err != nil || string(data) != "hi" {
+		t.Fatalf("unexpected message: %s, %v", data, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for manager.DroppedMessages() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no message dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case id := <-h.deregistered:
+		t.Fatalf("client %s should stay connected", id)
+	default:
+	}
+}
+
+func TestSlowClientDisconnect(t *testing.T) {
+	// disconnect is the default policy
+	manager, h, url := newServer(t, config.WebSocketConfig{QueueSize: 1})
+	dial(t, url, "slow", "slow", h)
+
+	flood(manager, "slow")
+	waitId(t, h.deregistered, "slow")
+	if manager.SlowClients() != 1 || manager.DroppedMessages() == 0 {
+		t.Fatalf("unexpected counters: %d slow, %d dropped", manager.SlowClients(), manager.DroppedMessages())
+	}
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	manager, h, url := newServer(t, config.WebSocketConfig{QueueSize: 512, WriteTimeout: 50 * time.Millisecond})
+	conn := dial(t, url, "g", "c", h)
+
+	// holding the lock stalls the services, so the manager queue fills up
+	manager.Lock.Lock()
+	go func() {
+		for i := 0; i < 200; i++ {
+			manager.Send("c", "g", []byte(strconv.Itoa(i)))
+		}
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for manager.DroppedMessages() == 0 {
+		if time.Now().After(deadline) {
+			manager.Lock.Unlock()
+			t.Fatal("no message dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	manager.Lock.Unlock()
+
+	// the messages arrive in order until the client is disconnected
+	next := 0
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if string(data) != strconv.Itoa(next) {
+			t.Fatalf("expect message %d, got %s", next, data)
+		}
+		next++
+	}
+	if next == 200 {
+		t.Fatal("every message arrived although one was dropped")
+	}
+	waitId(t, h.deregistered, "c")
+}
+
+func TestBrokerFanOut(t *testing.T) {
+	broker, presence := wsmanager.NewMemoryBroker(), wsmanager.NewMemoryPresence()
+	opts := []wsmanager.Option{wsmanager.WithBroker(broker), wsmanager.WithPresence(presence)}
+	nodeA, ha, urlA := newServer(t, config.WebSocketConfig{NodeId: "a"}, opts...)
+	nodeB, hb, urlB := newServer(t, config.WebSocketConfig{NodeId: "b"}, opts...)
+	tab1 := dial(t, urlA, "u", "tab1", ha)
+	tab2 := dial(t, urlB, "u", "tab2", hb)
+
+	read := func(conn *websocket.Conn, want string) {
+		t.Helper()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, data, err := conn.ReadMessage(); err != nil || string(data) != want {
+			t.Fatalf("expect %s, got %s, %v", want, data, err)
+		}
+	}
+	// a group send of node a reaches the tab on node b
+	nodeA.SendGroup("u", []byte("group"))
+	read(tab1, "group")
+	read(tab2, "group")
+	nodeB.Send("tab1", "u", []byte("direct"))
+	read(tab1, "direct")
+	nodeA.SendAll([]byte("all"))
+	read(tab1, "all")
+	read(tab2, "all")
+
+	ids, err := nodeA.Online("u")
+	if err != nil || strings.Join(ids, ",") != "tab1,tab2" {
+		t.Fatalf("unexpected presence: %v, %v", ids, err)
+	}
+	tab2.Close()
+	waitId(t, hb.deregistered, "tab2")
+	if ids, _ = nodeA.Online("u"); strings.Join(ids, ",") != "tab1" {
+		t.Fatalf("unexpected presence: %v", ids)
+	}
+}
+
+func TestOriginAndSubprotocol(t *testing.T) {
+	_, h, url := newServer(t, config.WebSocketConfig{AllowedOrigins: []string{"*.example.com"}})
+	cases := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"https://chat.example.com", true},
+		{"https://example.com.evil.org", false},
+		{"https://evil.org", false},
+	}
+	for i, c := range cases {
+		header := http.Header{}
+		if len(c.origin) > 0 {
+			header.Set("Origin", c.origin)
+		}
+		id := strconv.Itoa(i)
+		conn, resp, err := websocket.DefaultDialer.Dial(url+"?group=g&id="+id, header)
+		if c.ok != (err == nil) {
+			t.Fatalf("origin %s: unexpected result %v", c.origin, err)
+		}
+		if err == nil {
+			conn.Close()
+		} else if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("origin %s: unexpected status %d", c.origin, resp.StatusCode)
+		}
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{"bearer.secret", "other", "test.v1"}}
+	conn, _, err := dialer.Dial(url+"?group=g&id=p", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitId(t, h.registered, "p")
+	if conn.Subprotocol() != "test.v1" {
+		t.Fatalf("unexpected subprotocol %s", conn.Subprotocol())
+	}
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "test.v1, bearer.secret")
+	if token := wsmanager.SubprotocolToken(req); token != "secret" {
+		t.Fatalf("unexpected token %s", token)
+	}
+}
@@ -0,0 +1,33 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/crudgen/helper"
+)
+
+//go:generate crudgentool -f $GOFILE -op ../infra
+//@Table(api_key)
+type ApiKeyMapper interface {
+	helper.DAO[ApiKeyMapper, model.ApiKey]
+
+	//@Sql(select * from @@table
+	//	where key_hash = @keyHash
+	//)
+	//@Result(res)
+	GetByHash(keyHash string) (res model.ApiKey, err error)
+
+	//@Sql(select * from @@table
+	//	where user_id = @userId
+	//	order by id
+	//)
+	//@Result(res)
+	ListByUserId(userId int) (res []model.ApiKey, err error)
+
+	//@Sql(update @@table
+	//	set last_used_time = @lastUsed
+	//	where id = @id
+	//)
+	UpdateLastUsed(id int, lastUsed time.Time) (err error)
+}
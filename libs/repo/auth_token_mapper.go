@@ -0,0 +1,18 @@
+package repo
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/crudgen/helper"
+)
+
+//go:generate crudgentool -f $GOFILE -op ../infra
+//@Table(auth_token)
+type AuthTokenMapper interface {
+	helper.DAO[AuthTokenMapper, model.AuthToken]
+
+	//@Sql(select * from @@table
+	//	where account = @account
+	//)
+	//@Result(res)
+	GetByAccount(account string) (res model.AuthToken, err error)
+}
@@ -1,7 +1,44 @@
 package repo
 
+import (
+	"context"
+
+	"github.com/LSDXXX/libs/model"
+)
+
 type ConversationContainer interface {
-	GetParentId(convId string) (string, bool)
+	// WithContext container whose store calls run in ctx
+	WithContext(ctx context.Context) ConversationContainer
+
+	// CreateConversation create an empty conversation
+	CreateConversation(conv *model.Conversation) error
+
+	// AddMessages append messages to the conversation, the conversation is
+	// created for the user if it does not exist, and its current node
+	// moves to the last message
+	AddMessages(userId int, convId string, messages ...model.ConversationMessage) error
+
+	// ListConversations conversations of the user, latest updated first
+	ListConversations(userId int, archived bool) ([]model.Conversation, error)
+
+	// GetConversation errorcode.ErrNotFound if not exist
+	GetConversation(convId string) (model.Conversation, error)
+
+	// GetMessages all messages of the conversation in insertion order
+	GetMessages(convId string) ([]model.ConversationMessage, error)
+
+	// GetMessage errorcode.ErrNotFound if not exist
+	GetMessage(convId string, messageId string) (model.ConversationMessage, error)
+
+	// UpdateCurrentNode move the conversation to another branch of its message tree
+	UpdateCurrentNode(convId string, node string) error
+
+	UpdateTitle(convId string, title string) error
+
+	UpdateArchived(convId string, archived bool) error
+
+	UpdateUpstreamId(convId string, upstreamId string) error
 
-	SetParentId(convId string, parentId string)
+	// DeleteConversation delete the conversation with all its messages
+	DeleteConversation(convId string) error
 }
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/crudgen/helper"
+)
+
+//go:generate crudgentool -f $GOFILE -op ../infra
+//@Table(conversation)
+type ConversationMapper interface {
+	helper.DAO[ConversationMapper, model.Conversation]
+
+	//@Sql(select * from @@table
+	//	where conversation_id = @convId
+	//)
+	//@Result(res)
+	GetByConversationId(convId string) (res model.Conversation, err error)
+
+	//@Sql(select * from @@table
+	//	where user_id = @userId and archived = @archived
+	//	order by update_time desc
+	//)
+	//@Result(res)
+	ListByUserId(userId int, archived bool) (res []model.Conversation, err error)
+
+	//@Sql(update @@table
+	//	set current_node = @node, update_time = now()
+	//	where conversation_id = @convId
+	//)
+	UpdateCurrentNode(convId string, node string) (err error)
+
+	//@Sql(update @@table
+	//	set title = @title, update_time = now()
+	//	where conversation_id = @convId
+	//)
+	UpdateTitle(convId string, title string) (err error)
+
+	//@Sql(update @@table
+	//	set archived = @archived, update_time = now()
+	//	where conversation_id = @convId
+	//)
+	UpdateArchived(convId string, archived bool) (err error)
+
+	//@Sql(update @@table
+	//	set upstream_id = @upstreamId
+	//	where conversation_id = @convId
+	//)
+	UpdateUpstreamId(convId string, upstreamId string) (err error)
+}
+
+//@Table(conversation_message)
+type ConversationMessageMapper interface {
+	helper.DAO[ConversationMessageMapper, model.ConversationMessage]
+
+	//@Sql(select * from @@table
+	//	where conversation_id = @convId
+	//	order by id
+	//)
+	//@Result(res)
+	ListByConversationId(convId string) (res []model.ConversationMessage, err error)
+
+	//@Sql(select * from @@table
+	//	where conversation_id = @convId and message_id = @messageId
+	//)
+	//@Result(res)
+	GetByMessageId(convId string, messageId string) (res model.ConversationMessage, err error)
+}
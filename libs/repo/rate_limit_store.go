@@ -0,0 +1,16 @@
+package repo
+
+import "time"
+
+// RateLimitStore counters of the rate limiter, shared by all instances
+// when backed by redis
+type RateLimitStore interface {
+	// Incr add delta to the counter, a counter that does not exist is
+	// created with the ttl. It returns the new value and the time left
+	// until the counter expires
+	Incr(key string, delta int64, ttl time.Duration) (int64, time.Duration, error)
+
+	// IncrExpire add delta to the counter and reset its ttl, the counter
+	// expires ttl after its last change. It returns the new value
+	IncrExpire(key string, delta int64, ttl time.Duration) (int64, error)
+}
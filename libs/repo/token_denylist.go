@@ -0,0 +1,16 @@
+package repo
+
+import "time"
+
+// TokenDenylist ids of revoked tokens, an id is kept until the token
+// would have expired anyway
+type TokenDenylist interface {
+	// Revoke deny the token for ttl, set only when absent so concurrent
+	// callers agree on who revoked it
+	//
+	//	@return bool whether the token was revoked already
+	Revoke(jti string, ttl time.Duration) (bool, error)
+
+	// IsRevoked whether the token was revoked
+	IsRevoked(jti string) (bool, error)
+}
@@ -0,0 +1,13 @@
+package repo
+
+import "github.com/LSDXXX/libs/model"
+
+// TokenStore cache of the upstream tokens of accounts, so restarts do not
+// have to login again
+type TokenStore interface {
+	// GetToken errorcode.ErrNotFound if nothing is cached for the account
+	GetToken(account string) (model.AuthToken, error)
+
+	// SaveToken replace the tokens of the account
+	SaveToken(token model.AuthToken) error
+}
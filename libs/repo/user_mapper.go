@@ -15,4 +15,40 @@ type UserMapper interface {
 	//)
 	//@Result(res)
 	GetByUserName(name string) (res model.User, err error)
+
+	//@Sql(select * from @@table
+	//	where id = @id
+	//)
+	//@Result(res)
+	GetById(id int) (res model.User, err error)
+
+	//@Sql(update @@table
+	//	set password = @password, password_legacy = 0
+	//	where id = @id
+	//)
+	SetPassword(id int, password string) (err error)
+
+	//@Sql(update @@table
+	//	set nickname = @nickname, email = @email
+	//	where id = @id
+	//)
+	UpdateProfile(id int, nickname string, email string) (err error)
+
+	//@Sql(update @@table
+	//	set disabled = @disabled
+	//	where id = @id
+	//)
+	UpdateDisabled(id int, disabled bool) (err error)
+}
+
+//@Table(invite_code)
+type InviteCodeMapper interface {
+	helper.DAO[InviteCodeMapper, model.InviteCode]
+
+	//@Sql(update @@table
+	//	set uses = uses + 1
+	//	where code = @code and uses < max_uses
+	//)
+	//@RowsAffected(rowsAffected)
+	UseCode(code string) (rowsAffected int64, err error)
 }
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/pkg/errors"
+)
+
+const (
+	// apiKeyPrefixLen characters of the key kept to tell keys apart
+	apiKeyPrefixLen = 10
+	// lastUsedInterval last used time is written at most this often
+	lastUsedInterval = time.Minute
+)
+
+func init() {
+	util.PanicWhenError(container.Singleton(NewApiKey))
+}
+
+// ApiKey api keys of the users, keys are random so a sha256 is enough
+// to store them
+type ApiKey struct {
+	mapper repo.ApiKeyMapper `container:"type"`
+	users  repo.UserMapper   `container:"type"`
+	ctx    context.Context
+}
+
+func NewApiKey() *ApiKey {
+	out := ApiKey{ctx: context.Background()}
+	util.PanicWhenError(container.Fill(&out))
+	return &out
+}
+
+func (a *ApiKey) WithContext(ctx context.Context) *ApiKey {
+	out := *a
+	out.ctx = ctx
+	return &out
+}
+
+// Create new key of the user, the key itself is only returned here
+//
+//	@receiver a
+//	@param userId
+//	@param name
+//	@param scopes
+//	@return model.ApiKey
+//	@return string the key
+//	@return error errorcode.ErrParameterInvalid on unknown scopes
+func (a *ApiKey) Create(userId int, name string, scopes []string) (model.ApiKey, string, error) {
+	if len(scopes) == 0 {
+		return model.ApiKey{}, "", errors.Wrap(errorcode.ErrParameterInvalid, "scopes required")
+	}
+	for _, scope := range scopes {
+		if _, ok := model.ScopePermissions[scope]; !ok {
+			return model.ApiKey{}, "", errors.Wrapf(errorcode.ErrParameterInvalid, "unknown scope %s", scope)
+		}
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return model.ApiKey{}, "", errors.Wrap(err, "generate api key")
+	}
+	key := model.ApiKeyPrefix + hex.EncodeToString(buf)
+	item := model.ApiKey{
+		UserId:  userId,
+		Name:    name,
+		Prefix:  key[:apiKeyPrefixLen],
+		KeyHash: hashApiKey(key),
+		Scopes:  scopes,
+	}
+	if err := a.mapper.Insert(&item); err != nil {
+		return model.ApiKey{}, "", errors.Wrap(err, "insert api key")
+	}
+	return item, key, nil
+}
+
+// List keys of the user
+//
+//	@receiver a
+//	@param userId
+//	@return []model.ApiKey
+//	@return error
+func (a *ApiKey) List(userId int) ([]model.ApiKey, error) {
+	keys, err := a.mapper.ListByUserId(userId)
+	return keys, errors.Wrap(err, "list api keys")
+}
+
+// Revoke delete a key of the user
+//
+//	@receiver a
+//	@param userId
+//	@param keyId
+//	@return error errorcode.ErrNotFound if the user has no such key
+func (a *ApiKey) Revoke(userId, keyId int) error {
+	// zero fields are no conditions of gorm, the delete would match every
+	// key of the user
+	if keyId <= 0 || userId <= 0 {
+		return errorcode.ErrParameterInvalid
+	}
+	n, err := a.mapper.Delete(model.ApiKey{Id: keyId, UserId: userId})
+	if err != nil {
+		return errors.Wrap(err, "delete api key")
+	}
+	if n == 0 {
+		return errorcode.ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate look up the key and its owner, the last used time is
+// updated on success
+//
+//	@receiver a
+//	@param key
+//	@return model.ApiKey
+//	@return model.User
+//	@return error errorcode.ErrInvalidCredentials on unknown keys,
+//	errorcode.ErrUserDisabled if the owner is disabled
+func (a *ApiKey) Authenticate(key string) (model.ApiKey, model.User, error) {
+	item, err := a.mapper.GetByHash(hashApiKey(key))
+	if notFound(err) {
+		return model.ApiKey{}, model.User{}, errorcode.ErrInvalidCredentials
+	}
+	if err != nil {
+		return model.ApiKey{}, model.User{}, errors.Wrap(err, "get api key")
+	}
+	user, err := a.users.GetById(item.UserId)
+	if notFound(err) {
+		return model.ApiKey{}, model.User{}, errorcode.ErrInvalidCredentials
+	}
+	if err != nil {
+		return model.ApiKey{}, model.User{}, errors.Wrap(err, "get user")
+	}
+	if user.Disabled {
+		return model.ApiKey{}, model.User{}, errorcode.ErrUserDisabled
+	}
+	user.Password = ""
+	now := time.Now()
+	if item.LastUsedTime == nil || now.Sub(*item.LastUsedTime) >= lastUsedInterval {
+		if err = a.mapper.UpdateLastUsed(item.Id, now); err != nil {
+			log.WithContext(a.ctx).Errorf("update last used of api key %d: %s", item.Id, err.Error())
+		}
+		item.LastUsedTime = &now
+	}
+	return item, user, nil
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package service_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/LSDXXX/libs/service"
+)
+
+type fakeApiKeyMapper struct {
+	repo.ApiKeyMapper
+	mu      sync.Mutex
+	keys    []model.ApiKey
+	updates int
+}
+
+func (m *fakeApiKeyMapper) Insert(items ...*model.ApiKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range items {
+		item.Id = len(m.keys) + 1
+		m.keys = append(m.keys, *item)
+	}
+	return nil
+}
+
+func (m *fakeApiKeyMapper) GetByHash(keyHash string) (model.ApiKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return model.ApiKey{}, errorcode.ErrNotFound
+}
+
+func (m *fakeApiKeyMapper) ListByUserId(userId int) ([]model.ApiKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.ApiKey
+	for _, key := range m.keys {
+		if key.UserId == userId {
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+func (m *fakeApiKeyMapper) UpdateLastUsed(id int, lastUsed time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updates++
+	for i := range m.keys {
+		if m.keys[i].Id == id {
+			m.keys[i].LastUsedTime = &lastUsed
+		}
+	}
+	return nil
+}
+
+// Delete zero fields are no conditions, as with gorm
+func (m *fakeApiKeyMapper) Delete(conds model.ApiKey) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []model.ApiKey
+	for _, key := range m.keys {
+		if (conds.Id == 0 || key.Id == conds.Id) && (conds.UserId == 0 || key.UserId == conds.UserId) {
+			continue
+		}
+		kept = append(kept, key)
+	}
+	n := len(m.keys) - len(kept)
+	m.keys = kept
+	return int64(n), nil
+}
+
+var apiKeys = &fakeApiKeyMapper{}
+
+func init() {
+	_ = container.Singleton(func() repo.ApiKeyMapper {
+		return apiKeys
+	})
+}
+
+func TestApiKey(t *testing.T) {
+	svc := service.NewApiKey()
+	if _, _, err := svc.Create(1, "bot", []string{"unknown"}); errorcode.Code(err) != errorcode.Code(errorcode.ErrParameterInvalid) {
+		t.Fatalf("expect parameter invalid, got %v", err)
+	}
+	item, key, err := svc.Create(1, "bot", []string{model.ScopeAsk})
+	if err != nil || !strings.HasPrefix(key, model.ApiKeyPrefix) || !strings.HasPrefix(key, item.Prefix) {
+		t.Fatalf("unexpected key: %+v, %s, %v", item, key, err)
+	}
+	if strings.Contains(item.KeyHash, key[len(model.ApiKeyPrefix):]) {
+		t.Fatal("key stored in plain text")
+	}
+
+	got, user, err := svc.Authenticate(key)
+	if err != nil || got.Id != item.Id || user.Id != 1 || got.LastUsedTime == nil {
+		t.Fatalf("unexpected authentication: %+v, %+v, %v", got, user, err)
+	}
+	// the last used time is not written on every request
+	if _, _, err = svc.Authenticate(key); err != nil || apiKeys.updates != 1 {
+		t.Fatalf("unexpected updates: %d, %v", apiKeys.updates, err)
+	}
+	if _, _, err = svc.Authenticate(key + "x"); errorcode.Code(err) != errorcode.Code(errorcode.ErrInvalidCredentials) {
+		t.Fatalf("expect invalid credentials, got %v", err)
+	}
+
+	if err = svc.Revoke(1, 0); errorcode.Code(err) != errorcode.Code(errorcode.ErrParameterInvalid) {
+		t.Fatalf("expect parameter invalid, got %v", err)
+	}
+	if keys, _ := svc.List(1); len(keys) != 1 {
+		t.Fatalf("key 0 deleted the keys of the user: %+v", keys)
+	}
+	if err = svc.Revoke(2, item.Id); errorcode.Code(err) != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("revoked the key of another user: %v", err)
+	}
+	if err = svc.Revoke(1, item.Id); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := svc.List(1); len(keys) != 0 {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+	if _, _, err = svc.Authenticate(key); errorcode.Code(err) != errorcode.Code(errorcode.ErrInvalidCredentials) {
+		t.Fatalf("revoked key accepted: %v", err)
+	}
+}
@@ -3,18 +3,23 @@ package service
 import (
 	"context"
 
+	"github.com/LSDXXX/libs/model"
 	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
 	"github.com/LSDXXX/libs/pkg/util"
 	"github.com/LSDXXX/libs/repo"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 func init() {
 	util.PanicWhenError(container.Singleton(NewConversation))
 }
 
+// Conversation conversations of users, every method takes the id of the
+// calling user and fails with errorcode.ErrForbidden on a foreign conversation
 type Conversation struct {
 	container repo.ConversationContainer `container:"type"`
-	ctx       context.Context
 }
 
 func NewConversation() *Conversation {
@@ -26,14 +31,330 @@ func NewConversation() *Conversation {
 
 func (c *Conversation) WithContext(ctx context.Context) *Conversation {
 	out := *c
-	out.ctx = ctx
+	out.container = c.container.WithContext(ctx)
 	return &out
 }
 
-func (c *Conversation) GetParentId(convId string) (string, bool) {
-	return c.container.GetParentId(convId)
+// Create create an empty conversation
+//
+//	@receiver c
+//	@param userId
+//	@param title
+//	@return *model.Conversation
+//	@return error
+func (c *Conversation) Create(userId int, title string) (*model.Conversation, error) {
+	conv := model.Conversation{
+		ConversationId: uuid.NewString(),
+		UserId:         userId,
+		Title:          title,
+	}
+	if err := c.container.CreateConversation(&conv); err != nil {
+		return nil, err
+	}
+	return &conv, nil
 }
 
-func (c *Conversation) SetParentId(convId string, parentId string) {
-	c.container.SetParentId(convId, parentId)
+// Find conversation owned by the user
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@return *model.Conversation
+//	@return error errorcode.ErrNotFound or errorcode.ErrForbidden
+func (c *Conversation) Find(userId int, convId string) (*model.Conversation, error) {
+	conv, err := c.container.GetConversation(convId)
+	if err != nil {
+		return nil, err
+	}
+	if conv.UserId != userId {
+		return nil, errorcode.ErrForbidden
+	}
+	return &conv, nil
+}
+
+// Open conversation to ask in, a new one is created when convId is empty
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@return *model.Conversation
+//	@return error
+func (c *Conversation) Open(userId int, convId string) (*model.Conversation, error) {
+	if len(convId) == 0 {
+		return c.Create(userId, "")
+	}
+	return c.Find(userId, convId)
+}
+
+// Next turn asking content after the current node, a new conversation
+// is created when convId is empty
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param content
+//	@return *model.ConversationTurn
+//	@return error
+func (c *Conversation) Next(userId int, convId string, content string) (*model.ConversationTurn, error) {
+	conv, err := c.Open(userId, convId)
+	if err != nil {
+		return nil, err
+	}
+	parent := conv.CurrentNode
+	if len(parent) == 0 {
+		parent = uuid.NewString()
+	}
+	return newTurn(conv, parent, content), nil
+}
+
+// Edit turn replacing an earlier user message, the new prompt forks a
+// branch beside the edited one
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param messageId user message to edit
+//	@param content
+//	@return *model.ConversationTurn
+//	@return error
+func (c *Conversation) Edit(userId int, convId string, messageId string, content string) (*model.ConversationTurn, error) {
+	conv, err := c.Find(userId, convId)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.container.GetMessage(convId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Role != "user" {
+		return nil, errors.Wrap(errorcode.ErrParameterInvalid, "only user messages can be edited")
+	}
+	return newTurn(conv, msg.ParentId, content), nil
+}
+
+// Regenerate turn answering a prompt again, the new answer becomes a
+// sibling of the old one
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param messageId assistant message to regenerate, the current node when empty
+//	@return *model.ConversationTurn
+//	@return error
+func (c *Conversation) Regenerate(userId int, convId string, messageId string) (*model.ConversationTurn, error) {
+	conv, err := c.Find(userId, convId)
+	if err != nil {
+		return nil, err
+	}
+	if len(messageId) == 0 {
+		messageId = conv.CurrentNode
+	}
+	answer, err := c.container.GetMessage(convId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if answer.Role != "assistant" {
+		return nil, errors.Wrap(errorcode.ErrParameterInvalid, "only assistant messages can be regenerated")
+	}
+	prompt, err := c.container.GetMessage(convId, answer.ParentId)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ConversationTurn{
+		Conversation: conv,
+		Prompt:       prompt,
+		Variant:      true,
+	}, nil
+}
+
+func newTurn(conv *model.Conversation, parent, content string) *model.ConversationTurn {
+	return &model.ConversationTurn{
+		Conversation: conv,
+		Prompt: model.ConversationMessage{
+			MessageId:      uuid.NewString(),
+			ConversationId: conv.ConversationId,
+			ParentId:       parent,
+			Role:           "user",
+			Content:        content,
+		},
+	}
+}
+
+// SaveTurn persist the prompt of the turn and its answer, the answer
+// becomes the current node
+//
+//	@receiver c
+//	@param userId
+//	@param turn
+//	@param answer
+//	@return error
+func (c *Conversation) SaveTurn(userId int, turn *model.ConversationTurn, answer model.ConversationMessage) error {
+	answer.ParentId = turn.Prompt.MessageId
+	if turn.Variant {
+		return c.AddMessages(userId, turn.Conversation.ConversationId, answer)
+	}
+	return c.AddMessages(userId, turn.Conversation.ConversationId, turn.Prompt, answer)
+}
+
+// AddMessages persist messages of a conversation owned by the user
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param messages
+//	@return error
+func (c *Conversation) AddMessages(userId int, convId string, messages ...model.ConversationMessage) error {
+	if _, err := c.Find(userId, convId); err != nil {
+		return err
+	}
+	return c.container.AddMessages(userId, convId, messages...)
+}
+
+// BindUpstream remember the id the llm backend uses for the conversation
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param upstreamId
+//	@return error
+func (c *Conversation) BindUpstream(userId int, convId string, upstreamId string) error {
+	if _, err := c.Find(userId, convId); err != nil {
+		return err
+	}
+	return c.container.UpdateUpstreamId(convId, upstreamId)
+}
+
+// List conversations of the user, latest updated first
+//
+//	@receiver c
+//	@param userId
+//	@param archived list archived conversations instead of active ones
+//	@return []model.Conversation
+//	@return error
+func (c *Conversation) List(userId int, archived bool) ([]model.Conversation, error) {
+	out, err := c.container.ListConversations(userId, archived)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []model.Conversation{}
+	}
+	return out, nil
+}
+
+// Get conversation with its message tree
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@return *model.ConversationDetail
+//	@return error
+func (c *Conversation) Get(userId int, convId string) (*model.ConversationDetail, error) {
+	conv, err := c.Find(userId, convId)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := c.container.GetMessages(convId)
+	if err != nil {
+		return nil, err
+	}
+	out := &model.ConversationDetail{
+		Conversation: *conv,
+		Messages:     make([]model.MessageNode, 0, len(messages)),
+	}
+	index := make(map[string]int, len(messages))
+	for _, m := range messages {
+		index[m.MessageId] = len(out.Messages)
+		out.Messages = append(out.Messages, model.MessageNode{
+			ConversationMessage: m,
+			Children:            []string{},
+		})
+	}
+	for _, m := range messages {
+		if i, ok := index[m.ParentId]; ok {
+			out.Messages[i].Children = append(out.Messages[i].Children, m.MessageId)
+		}
+	}
+	return out, nil
+}
+
+// SwitchBranch make the branch through messageId current, the latest
+// answer under it becomes the current node
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param messageId
+//	@return string the new current node
+//	@return error
+func (c *Conversation) SwitchBranch(userId int, convId string, messageId string) (string, error) {
+	if _, err := c.Find(userId, convId); err != nil {
+		return "", err
+	}
+	messages, err := c.container.GetMessages(convId)
+	if err != nil {
+		return "", err
+	}
+	latest := make(map[string]string, len(messages))
+	var found bool
+	for _, m := range messages {
+		latest[m.ParentId] = m.MessageId
+		found = found || m.MessageId == messageId
+	}
+	if !found {
+		return "", errorcode.ErrNotFound
+	}
+	node := messageId
+	for {
+		child, ok := latest[node]
+		if !ok {
+			break
+		}
+		node = child
+	}
+	if err = c.container.UpdateCurrentNode(convId, node); err != nil {
+		return "", err
+	}
+	return node, nil
+}
+
+// Rename change the title of the conversation
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param title
+//	@return error
+func (c *Conversation) Rename(userId int, convId string, title string) error {
+	if _, err := c.Find(userId, convId); err != nil {
+		return err
+	}
+	return c.container.UpdateTitle(convId, title)
+}
+
+// Archive archived conversations are hidden from the default list
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@param archived false to restore
+//	@return error
+func (c *Conversation) Archive(userId int, convId string, archived bool) error {
+	if _, err := c.Find(userId, convId); err != nil {
+		return err
+	}
+	return c.container.UpdateArchived(convId, archived)
+}
+
+// Delete delete the conversation with all its messages
+//
+//	@receiver c
+//	@param userId
+//	@param convId
+//	@return error
+func (c *Conversation) Delete(userId int, convId string) error {
+	if _, err := c.Find(userId, convId); err != nil {
+		return err
+	}
+	return c.container.DeleteConversation(convId)
 }
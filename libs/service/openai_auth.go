@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -10,14 +11,48 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/errorcode"
 	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/pkg/singleflight"
+	"github.com/LSDXXX/libs/repo"
 	http "github.com/bogdanfinn/fhttp"
 	tlsClient "github.com/bogdanfinn/tls-client"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	defaultRefreshBefore = 10 * time.Minute
+	refreshRetry         = time.Minute
+	sessionCookieName    = "__Secure-next-auth.session-token"
+)
+
+// OpenAIAuthOption opts
+type OpenAIAuthOption func(*OpenAIAuth)
+
+// WithTokenStore cache the tokens in store, cached tokens are restored
+// on creation and saved after every login
+func WithTokenStore(store repo.TokenStore) OpenAIAuthOption {
+	return func(o *OpenAIAuth) {
+		o.store = store
+	}
+}
+
+// WithRefreshBefore how long before expiry KeepFresh renews the access token
+func WithRefreshBefore(d time.Duration) OpenAIAuthOption {
+	return func(o *OpenAIAuth) {
+		if d > 0 {
+			o.refreshBefore = d
+		}
+	}
+}
+
+// OpenAIAuth web session of one account. The access token is renewed with
+// the session token while the session lives, the full login only runs when
+// there is no usable session.
 type OpenAIAuth struct {
 	Email    string
 	Password string
@@ -25,10 +60,18 @@ type OpenAIAuth struct {
 
 	client        tlsClient.HttpClient
 	userAgent     string
+	store         repo.TokenStore
+	refreshBefore time.Duration
+	group         singleflight.Group
+	// login and refresh are replaced in tests
+	login   func() error
+	refresh func() error
+
+	mu            sync.RWMutex
 	sessionToken  string
+	sessionExpire time.Time
 	accessToken   string
-	sessionCookie *http.Cookie
-	loginLock     sync.Mutex
+	accessExpire  time.Time
 }
 
 func newTLSClient(proxy string) tlsClient.HttpClient {
@@ -51,23 +94,60 @@ func newTLSClient(proxy string) tlsClient.HttpClient {
 	return client
 }
 
-func NewOpenAIAuth(email, password, proxy string) *OpenAIAuth {
+func NewOpenAIAuth(email, password, proxy string, opts ...OpenAIAuthOption) *OpenAIAuth {
 	out := &OpenAIAuth{
-		Email:     email,
-		Password:  password,
-		Proxy:     proxy,
-		userAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36",
-	}
+		Email:         email,
+		Password:      password,
+		Proxy:         proxy,
+		userAgent:     "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36",
+		refreshBefore: defaultRefreshBefore,
+	}
+	out.login = out.fullLogin
+	out.refresh = out.getAccessToken
+	for _, opt := range opts {
+		opt(out)
+	}
+	out.restore()
 	return out
 }
 
+// Login renew the access token, with the session token when the session
+// is still valid, otherwise by logging in with the password. Concurrent
+// calls share one renewal.
+//
+//	@receiver o
+//	@return error
 func (o *OpenAIAuth) Login() error {
+	_, err, _ := o.group.Do(o.Email, func() (interface{}, error) {
+		return nil, o.renew()
+	})
+	return err
+}
+
+func (o *OpenAIAuth) renew() error {
+	o.mu.RLock()
+	hasSession := len(o.sessionToken) > 0 && !expired(o.sessionExpire, 0)
+	o.mu.RUnlock()
+	if hasSession {
+		err := o.refresh()
+		if err == nil {
+			o.save()
+			return nil
+		}
+		log.WithContext(context.Background()).Warnf("refresh access token of %s: %s", o.Email, err.Error())
+	}
+	if err := o.login(); err != nil {
+		return err
+	}
+	o.save()
+	return nil
+}
 
+// fullLogin login with the password, sets both tokens
+func (o *OpenAIAuth) fullLogin() error {
 	if len(o.Email) == 0 || len(o.Password) == 0 {
 		return errors.New("email and password is required")
 	}
-	o.loginLock.Lock()
-	defer o.loginLock.Unlock()
 	o.client = newTLSClient(o.Proxy)
 	logrus.Debugf("start login ---")
 	url := "https://explorer.api.openai.com/"
@@ -410,23 +490,31 @@ func (o *OpenAIAuth) step9(redirectUrl, previousUrl string) error {
 		return errors.New("step 9 error")
 	}
 
-	cookies := res.Cookies()
-	var sessionToken string
-	for _, cookie := range cookies {
-		if cookie.Name == "__Secure-next-auth.session-token" {
-			sessionToken = cookie.Value
-			o.sessionCookie = cookie
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == sessionCookieName {
+			expire := cookie.Expires
+			if cookie.MaxAge > 0 {
+				expire = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+			}
+			o.setSession(cookie.Value, expire)
 			break
 		}
 	}
-	o.sessionToken = sessionToken
 	return o.getAccessToken()
 }
 
+// getAccessToken fetch a new access token with the session token
 func (o *OpenAIAuth) getAccessToken() error {
+	if o.client == nil {
+		o.client = newTLSClient(o.Proxy)
+	}
+	o.mu.RLock()
+	cookie := &http.Cookie{Name: sessionCookieName, Value: o.sessionToken, Path: "/", Secure: true}
+	o.mu.RUnlock()
 	o.client.SetCookies(&url.URL{
-		Host: "auth0.openai.com",
-	}, []*http.Cookie{o.sessionCookie})
+		Scheme: "https",
+		Host:   "explorer.api.openai.com",
+	}, []*http.Cookie{cookie})
 
 	res, err := o.client.Get("https://explorer.api.openai.com/api/auth/session")
 	if err != nil {
@@ -435,31 +523,171 @@ func (o *OpenAIAuth) getAccessToken() error {
 	data, _ := ioutil.ReadAll(res.Body)
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
-		if res.StatusCode != 200 {
-			logrus.Errorf("getAccessToken status code: %d, content: %s", res.StatusCode, string(data))
-			return errors.New("getAccessToken error")
-		}
+		logrus.Errorf("getAccessToken status code: %d, content: %s", res.StatusCode, string(data))
+		return errors.New("getAccessToken error")
 	}
 	var m map[string]interface{}
 	err = json.Unmarshal(data, &m)
 	if err != nil {
 		return errors.Wrap(err, "json unmarshal")
 	}
-	token, ok := m["accessToken"]
-	if !ok {
-		return errors.New("empty csrf token")
+	token, ok := m["accessToken"].(string)
+	if !ok || len(token) == 0 {
+		return errors.New("empty access token")
 	}
-	o.accessToken = token.(string)
-	logrus.Debugf("access token: %s", o.accessToken)
+	o.SetAccessToken(token)
+	logrus.Debugf("access token: %s", token)
 	return nil
 }
 
 func (o *OpenAIAuth) AccessToken() string {
-	o.loginLock.Lock()
-	defer o.loginLock.Unlock()
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 	return o.accessToken
 }
 
+// SetAccessToken use an already issued access token, Login is still
+// available to renew it
+func (o *OpenAIAuth) SetAccessToken(token string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.accessToken = token
+	o.accessExpire = jwtExpire(token)
+}
+
 func (o *OpenAIAuth) SessionToken() string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 	return o.sessionToken
 }
+
+func (o *OpenAIAuth) setSession(token string, expire time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sessionToken = token
+	o.sessionExpire = expire
+}
+
+// KeepFresh renew the access token before it expires until ctx is done,
+// tokens without a known expiry are left alone
+//
+//	@receiver o
+//	@param ctx
+func (o *OpenAIAuth) KeepFresh(ctx context.Context) {
+	for {
+		o.mu.RLock()
+		expire := o.accessExpire
+		o.mu.RUnlock()
+		if expire.IsZero() {
+			// an access token may be set or restored later
+			if !sleep(ctx, refreshRetry) {
+				return
+			}
+			continue
+		}
+		if !sleep(ctx, time.Until(expire)-o.refreshBefore) {
+			return
+		}
+		if err := o.Login(); err != nil {
+			log.WithContext(ctx).Errorf("refresh tokens of %s: %s", o.Email, err.Error())
+			if !sleep(ctx, refreshRetry) {
+				return
+			}
+		}
+	}
+}
+
+// restore load the cached tokens that are not expired yet
+func (o *OpenAIAuth) restore() {
+	if o.store == nil {
+		return
+	}
+	token, err := o.store.GetToken(o.Email)
+	if err != nil {
+		if !errors.Is(err, errorcode.ErrNotFound) {
+			log.WithContext(context.Background()).Errorf("restore tokens of %s: %s", o.Email, err.Error())
+		}
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if expire := unixTime(token.SessionExpire); !expired(expire, 0) {
+		o.sessionToken, o.sessionExpire = token.SessionToken, expire
+	}
+	if expire := unixTime(token.AccessExpire); !expired(expire, 0) {
+		o.accessToken, o.accessExpire = token.AccessToken, expire
+	}
+}
+
+// save cache the tokens, a failure only costs a login after restart
+func (o *OpenAIAuth) save() {
+	if o.store == nil {
+		return
+	}
+	o.mu.RLock()
+	token := model.AuthToken{
+		Account:       o.Email,
+		SessionToken:  o.sessionToken,
+		SessionExpire: unix(o.sessionExpire),
+		AccessToken:   o.accessToken,
+		AccessExpire:  unix(o.accessExpire),
+	}
+	o.mu.RUnlock()
+	if err := o.store.SaveToken(token); err != nil {
+		log.WithContext(context.Background()).Errorf("save tokens of %s: %s", o.Email, err.Error())
+	}
+}
+
+// jwtExpire exp claim of a jwt, the signature is not verified since the
+// token is only passed on upstream. Zero when the token is no jwt.
+func jwtExpire(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(data, &claims) != nil {
+		return time.Time{}
+	}
+	return unixTime(claims.Exp)
+}
+
+// expired whether the token expires within margin, unknown expiry never does
+func expired(expire time.Time, margin time.Duration) bool {
+	return !expire.IsZero() && time.Until(expire) <= margin
+}
+
+func unixTime(sec int64) time.Time {
+	if sec <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// sleep wait d, false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LSDXXX/libs/infra"
+)
+
+func fakeJWT(expire time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expire.Unix())))
+	return "e30." + payload + ".sig"
+}
+
+// stubAuth auth whose login and refresh only count and issue tokens
+// valid for ttl
+func stubAuth(auth *OpenAIAuth, ttl time.Duration, logins, refreshes *int32) {
+	auth.login = func() error {
+		atomic.AddInt32(logins, 1)
+		time.Sleep(20 * time.Millisecond)
+		auth.setSession("session", time.Now().Add(time.Hour))
+		auth.SetAccessToken(fakeJWT(time.Now().Add(ttl)))
+		return nil
+	}
+	auth.refresh = func() error {
+		atomic.AddInt32(refreshes, 1)
+		auth.SetAccessToken(fakeJWT(time.Now().Add(ttl)))
+		return nil
+	}
+}
+
+func TestJWTExpire(t *testing.T) {
+	expire := time.Now().Add(time.Hour).Truncate(time.Second)
+	if got := jwtExpire(fakeJWT(expire)); !got.Equal(expire) {
+		t.Fatalf("expect %v, got %v", expire, got)
+	}
+	if got := jwtExpire("not-a-jwt"); !got.IsZero() {
+		t.Fatalf("expect zero, got %v", got)
+	}
+}
+
+func TestOpenAIAuthCache(t *testing.T) {
+	store := infra.NewTokenStoreFileImp(filepath.Join(t.TempDir(), "tokens.json"))
+	var logins, refreshes int32
+	auth := NewOpenAIAuth("a@b.c", "pwd", "", WithTokenStore(store))
+	stubAuth(auth, time.Hour, &logins, &refreshes)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := auth.Login(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if logins != 1 {
+		t.Fatalf("concurrent logins should be shared, got %d", logins)
+	}
+
+	// a restart restores the tokens without logging in
+	restored := NewOpenAIAuth("a@b.c", "pwd", "", WithTokenStore(store))
+	if restored.AccessToken() != auth.AccessToken() || restored.SessionToken() != "session" {
+		t.Fatalf("tokens not restored: %q", restored.AccessToken())
+	}
+
+	// a rejected access token is renewed with the session
+	stubAuth(restored, time.Hour, &logins, &refreshes)
+	if err := restored.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 1 || refreshes != 1 {
+		t.Fatalf("expect a refresh without login, logins: %d, refreshes: %d", logins, refreshes)
+	}
+}
+
+func TestOpenAIAuthKeepFresh(t *testing.T) {
+	var logins, refreshes int32
+	auth := NewOpenAIAuth("a@b.c", "pwd", "", WithRefreshBefore(time.Hour-100*time.Millisecond))
+	stubAuth(auth, time.Hour, &logins, &refreshes)
+	if err := auth.Login(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		auth.KeepFresh(ctx)
+	}()
+	time.Sleep(250 * time.Millisecond)
+	cancel()
+	<-done
+	if logins != 1 || atomic.LoadInt32(&refreshes) < 1 {
+		t.Fatalf("expect refreshes before expiry, logins: %d, refreshes: %d", logins, refreshes)
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LSDXXX/libs/config"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/pkg/errors"
+)
+
+// defaultStreamTTL StreamTTL of a config without one
+const defaultStreamTTL = 10 * time.Minute
+
+// Release end of a request admitted by RateLimiter.Acquire, used is
+// charged to the daily quota
+type Release func(used int64)
+
+// RateLimiter per user limits of chat requests: requests per minute,
+// concurrent answers and a daily quota of characters
+type RateLimiter struct {
+	conf  config.RateLimitConfig
+	store repo.RateLimitStore `container:"type"`
+	ctx   context.Context
+}
+
+func NewRateLimiter(conf config.RateLimitConfig) *RateLimiter {
+	if conf.ConcurrentStreams > 0 && conf.StreamTTL <= 0 {
+		// the slots would expire at once and the cap never apply
+		log.WithContext(context.Background()).Warnf("rate limit stream_ttl %s is not positive, using %s", conf.StreamTTL, defaultStreamTTL)
+		conf.StreamTTL = defaultStreamTTL
+	}
+	out := RateLimiter{
+		conf: conf,
+		ctx:  context.Background(),
+	}
+	util.PanicWhenError(container.Fill(&out))
+	return &out
+}
+
+func (l *RateLimiter) WithContext(ctx context.Context) *RateLimiter {
+	out := *l
+	out.ctx = ctx
+	return &out
+}
+
+// Usage characters a prompt and its answer are charged
+//
+//	@param texts
+//	@return int64
+func Usage(texts ...string) int64 {
+	var out int64
+	for _, text := range texts {
+		out += int64(utf8.RuneCountInString(text))
+	}
+	return out
+}
+
+// Acquire admit a chat request of the user
+//
+//	@receiver l
+//	@param userId
+//	@return Release must be called once the answer is done
+//	@return error errorcode.ErrTooManyRequests or errorcode.ErrQuotaExceeded,
+//	with a retry hint when it is known
+func (l *RateLimiter) Acquire(userId int) (Release, error) {
+	now := time.Now()
+	quotaKey := fmt.Sprintf("rate_limit:quota:%d:%s", userId, now.Format("20060102"))
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	// kept a bit longer than the day, so answers finishing after
+	// midnight are still charged
+	quotaTTL := tomorrow.Sub(now) + time.Hour
+	if l.conf.DailyQuota > 0 {
+		used, _, err := l.store.Incr(quotaKey, 0, quotaTTL)
+		if err != nil {
+			return nil, err
+		}
+		if used >= l.conf.DailyQuota {
+			return nil, errorcode.WithRetryAfter(errorcode.ErrQuotaExceeded, tomorrow.Sub(now))
+		}
+	}
+	if l.conf.RequestsPerMinute > 0 {
+		window := now.Truncate(time.Minute)
+		key := fmt.Sprintf("rate_limit:requests:%d:%d", userId, window.Unix())
+		n, ttl, err := l.store.Incr(key, 1, window.Add(time.Minute).Sub(now))
+		if err != nil {
+			return nil, err
+		}
+		if n > int64(l.conf.RequestsPerMinute) {
+			return nil, errorcode.WithRetryAfter(errorcode.ErrTooManyRequests, ttl)
+		}
+	}
+	streamKey := fmt.Sprintf("rate_limit:streams:%d", userId)
+	if l.conf.ConcurrentStreams > 0 {
+		// the ttl restarts on every change, so the counter only expires
+		// once no stream of the user has started or ended for StreamTTL
+		n, err := l.store.IncrExpire(streamKey, 1, l.conf.StreamTTL)
+		if err != nil {
+			return nil, err
+		}
+		if n > int64(l.conf.ConcurrentStreams) {
+			l.releaseStream(streamKey)
+			return nil, errors.Wrapf(errorcode.ErrTooManyRequests,
+				"at most %d answers at the same time", l.conf.ConcurrentStreams)
+		}
+	}
+
+	var once sync.Once
+	return func(used int64) {
+		once.Do(func() {
+			if l.conf.ConcurrentStreams > 0 {
+				l.releaseStream(streamKey)
+			}
+			if l.conf.DailyQuota > 0 && used > 0 {
+				if _, _, err := l.store.Incr(quotaKey, used, quotaTTL); err != nil {
+					log.WithContext(l.ctx).Errorf("charge quota of %d: %s", userId, err.Error())
+				}
+			}
+		})
+	}, nil
+}
+
+func (l *RateLimiter) releaseStream(key string) {
+	n, err := l.store.IncrExpire(key, -1, l.conf.StreamTTL)
+	if err != nil {
+		log.WithContext(l.ctx).Errorf("release stream %s: %s", key, err.Error())
+		return
+	}
+	// the counter expired while the stream was running
+	if n < 0 {
+		_, _ = l.store.IncrExpire(key, -n, l.conf.StreamTTL)
+	}
+}
@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LSDXXX/libs/config"
+	"github.com/LSDXXX/libs/infra"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/service"
+)
+
+func init() {
+	_ = container.Singleton(infra.NewRateLimitStoreImp)
+}
+
+func TestRateLimiterRequests(t *testing.T) {
+	limiter := service.NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 2})
+	for i := 0; i < 2; i++ {
+		release, err := limiter.Acquire(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release(0)
+	}
+	_, err := limiter.Acquire(1)
+	if errorcode.Code(err) != errorcode.Code(errorcode.ErrTooManyRequests) {
+		t.Fatalf("expect too many requests, got %v", err)
+	}
+	var retry *errorcode.RetryError
+	if !errors.As(err, &retry) || retry.RetryAfter <= 0 || retry.RetryAfter > time.Minute {
+		t.Fatalf("unexpected retry hint: %v", err)
+	}
+	if _, err = limiter.Acquire(2); err != nil {
+		t.Fatalf("other users are not limited: %v", err)
+	}
+}
+
+func TestRateLimiterStreams(t *testing.T) {
+	limiter := service.NewRateLimiter(config.RateLimitConfig{ConcurrentStreams: 1, StreamTTL: time.Minute})
+	release, err := limiter.Acquire(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = limiter.Acquire(3); errorcode.Code(err) != errorcode.Code(errorcode.ErrTooManyRequests) {
+		t.Fatalf("expect too many requests, got %v", err)
+	}
+	release(0)
+	release(0)
+	release, err = limiter.Acquire(3)
+	if err != nil {
+		t.Fatalf("slot not released: %v", err)
+	}
+	release(0)
+}
+
+func TestRateLimiterStreamTTL(t *testing.T) {
+	// a zero ttl would expire the slots at once
+	limiter := service.NewRateLimiter(config.RateLimitConfig{ConcurrentStreams: 1})
+	release, err := limiter.Acquire(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = limiter.Acquire(5); errorcode.Code(err) != errorcode.Code(errorcode.ErrTooManyRequests) {
+		t.Fatalf("expect too many requests, got %v", err)
+	}
+	release(0)
+
+	// overlapping streams keep the counter alive past the ttl
+	limiter = service.NewRateLimiter(config.RateLimitConfig{ConcurrentStreams: 2, StreamTTL: 100 * time.Millisecond})
+	first, err := limiter.Acquire(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(70 * time.Millisecond)
+	second, err := limiter.Acquire(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(70 * time.Millisecond)
+	if _, err = limiter.Acquire(6); errorcode.Code(err) != errorcode.Code(errorcode.ErrTooManyRequests) {
+		t.Fatalf("expect too many requests, got %v", err)
+	}
+	first(0)
+	second(0)
+}
+
+func TestRateLimiterQuota(t *testing.T) {
+	limiter := service.NewRateLimiter(config.RateLimitConfig{DailyQuota: 10})
+	release, err := limiter.Acquire(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(service.Usage("hello", "world!"))
+	_, err = limiter.Acquire(4)
+	if errorcode.Code(err) != errorcode.Code(errorcode.ErrQuotaExceeded) {
+		t.Fatalf("expect quota exceeded, got %v", err)
+	}
+	res := model.NewResponse(model.WithError(err))
+	hint, ok := res.ErrData.(map[string]int64)
+	if !ok || hint["retry_after"] <= 0 || hint["retry_after"] > 24*3600 {
+		t.Fatalf("unexpected error data: %+v", res.ErrData)
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/pkg/password"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+func init() {
+	util.PanicWhenError(container.Singleton(NewUser))
+}
+
+// User accounts of the chat users, passwords are stored as argon2id hashes
+type User struct {
+	mapper  repo.UserMapper       `container:"type"`
+	invites repo.InviteCodeMapper `container:"type"`
+	ctx     context.Context
+	// dummyHash verified for unknown users, so the response time does
+	// not tell whether a user exists
+	dummyHash string
+}
+
+func NewUser() *User {
+	out := User{ctx: context.Background()}
+	util.PanicWhenError(container.Fill(&out))
+	hash, err := password.Hash("")
+	util.PanicWhenError(err)
+	out.dummyHash = hash
+	return &out
+}
+
+func (u *User) WithContext(ctx context.Context) *User {
+	out := *u
+	out.ctx = ctx
+	return &out
+}
+
+// Authenticate check the password of the user, a legacy plain text
+// password or an outdated hash is hashed again on success
+//
+//	@receiver u
+//	@param name
+//	@param plain
+//	@return model.User
+//	@return error errorcode.ErrInvalidCredentials on unknown user or wrong password,
+//	errorcode.ErrUserDisabled on a disabled user
+func (u *User) Authenticate(name, plain string) (model.User, error) {
+	user, err := u.mapper.GetByUserName(name)
+	if notFound(err) {
+		_, _ = password.Verify(u.dummyHash, plain)
+		return model.User{}, errorcode.ErrInvalidCredentials
+	}
+	if err != nil {
+		return model.User{}, errors.Wrap(err, "get user")
+	}
+	if !u.verify(user, plain) {
+		return model.User{}, errorcode.ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return model.User{}, errorcode.ErrUserDisabled
+	}
+	if user.PasswordLegacy || password.NeedsRehash(user.Password) {
+		if err = u.SetPassword(user.Id, plain); err != nil {
+			// the login is still valid, the next one tries again
+			log.WithContext(u.ctx).Errorf("rehash password of user %d: %s", user.Id, err.Error())
+		}
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// SetPassword hash and store a new password
+//
+//	@receiver u
+//	@param userId
+//	@param plain
+//	@return error
+func (u *User) SetPassword(userId int, plain string) error {
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(u.mapper.SetPassword(userId, hash), "set password")
+}
+
+// Register create a user with the default role, the invite code is
+// consumed when not empty
+//
+//	@receiver u
+//	@param name
+//	@param plain
+//	@param inviteCode
+//	@return model.User
+//	@return error errorcode.ErrUserExists, errorcode.ErrInvalidInviteCode
+func (u *User) Register(name, plain, inviteCode string) (model.User, error) {
+	_, err := u.mapper.GetByUserName(name)
+	if err == nil {
+		return model.User{}, errorcode.ErrUserExists
+	}
+	if !notFound(err) {
+		return model.User{}, errors.Wrap(err, "get user")
+	}
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return model.User{}, err
+	}
+	user := model.User{
+		UserName: name,
+		Password: hash,
+		Role:     model.RoleUser,
+	}
+	// the invite code is only used up when the user is created
+	err = u.mapper.DB().Transaction(func(tx *gorm.DB) error {
+		if len(inviteCode) > 0 {
+			n, err := u.invites.WithDB(tx).UseCode(inviteCode)
+			if err != nil {
+				return errors.Wrap(err, "use invite code")
+			}
+			if n == 0 {
+				return errorcode.ErrInvalidInviteCode
+			}
+		}
+		err := u.mapper.WithDB(tx).Insert(&user)
+		if duplicateKey(err) {
+			// registered concurrently since the name was checked
+			return errorcode.ErrUserExists
+		}
+		return errors.Wrap(err, "insert user")
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// Get user by id
+//
+//	@receiver u
+//	@param userId
+//	@return model.User
+//	@return error errorcode.ErrNotFound
+func (u *User) Get(userId int) (model.User, error) {
+	user, err := u.mapper.GetById(userId)
+	if notFound(err) {
+		return model.User{}, errorcode.ErrNotFound
+	}
+	if err != nil {
+		return model.User{}, errors.Wrap(err, "get user")
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// UpdateProfile update the editable fields of the profile
+//
+//	@receiver u
+//	@param userId
+//	@param nickname
+//	@param email
+//	@return error
+func (u *User) UpdateProfile(userId int, nickname, email string) error {
+	return errors.Wrap(u.mapper.UpdateProfile(userId, nickname, email), "update profile")
+}
+
+// ChangePassword replace the password after checking the old one
+//
+//	@receiver u
+//	@param userId
+//	@param old
+//	@param plain
+//	@return error errorcode.ErrInvalidCredentials on a wrong old password
+func (u *User) ChangePassword(userId int, old, plain string) error {
+	user, err := u.mapper.GetById(userId)
+	if notFound(err) {
+		return errorcode.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "get user")
+	}
+	if !u.verify(user, old) {
+		return errorcode.ErrInvalidCredentials
+	}
+	return u.SetPassword(userId, plain)
+}
+
+// List users ordered by id
+//
+//	@receiver u
+//	@param page starts from 1
+//	@param pageSize
+//	@return model.UserPage
+//	@return error
+func (u *User) List(page, pageSize int) (model.UserPage, error) {
+	users, total, err := u.mapper.Page(page, pageSize, "id")
+	if err != nil {
+		return model.UserPage{}, errors.Wrap(err, "list users")
+	}
+	for i := range users {
+		users[i].Password = ""
+	}
+	return model.UserPage{Total: total, Users: users}, nil
+}
+
+// SetDisabled disable or enable a user, a disabled user cannot login
+//
+//	@receiver u
+//	@param userId
+//	@param disabled
+//	@return error
+func (u *User) SetDisabled(userId int, disabled bool) error {
+	if _, err := u.Get(userId); err != nil {
+		return err
+	}
+	return errors.Wrap(u.mapper.UpdateDisabled(userId, disabled), "update disabled")
+}
+
+// Delete delete a user, the conversations of the user are kept
+//
+//	@receiver u
+//	@param userId
+//	@return error errorcode.ErrNotFound
+func (u *User) Delete(userId int) error {
+	// a zero id is no condition of gorm, the delete would have no where clause
+	if userId <= 0 {
+		return errorcode.ErrParameterInvalid
+	}
+	n, err := u.mapper.Delete(model.User{Id: userId})
+	if err != nil {
+		return errors.Wrap(err, "delete user")
+	}
+	if n == 0 {
+		return errorcode.ErrNotFound
+	}
+	return nil
+}
+
+// CreateInviteCode new invite code allowing maxUses sign ups
+//
+//	@receiver u
+//	@param createdBy
+//	@param maxUses
+//	@return model.InviteCode
+//	@return error
+func (u *User) CreateInviteCode(createdBy, maxUses int) (model.InviteCode, error) {
+	if maxUses <= 0 {
+		maxUses = 1
+	}
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return model.InviteCode{}, errors.Wrap(err, "generate invite code")
+	}
+	code := model.InviteCode{
+		Code:      hex.EncodeToString(buf),
+		CreatedBy: createdBy,
+		MaxUses:   maxUses,
+	}
+	if err := u.invites.Insert(&code); err != nil {
+		return model.InviteCode{}, errors.Wrap(err, "insert invite code")
+	}
+	return code, nil
+}
+
+// verify compare the password, legacy plain text in constant time
+func (u *User) verify(user model.User, plain string) bool {
+	if user.PasswordLegacy {
+		return password.VerifyLegacy(user.Password, plain)
+	}
+	ok, err := password.Verify(user.Password, plain)
+	if err != nil {
+		log.WithContext(u.ctx).Errorf("verify password of user %d: %s", user.Id, err.Error())
+	}
+	return ok
+}
+
+func notFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errorcode.ErrNotFound)
+}
+
+// duplicateKey mysql error of an insert violating a unique key
+func duplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,272 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/LSDXXX/libs/service"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// fakeDB gorm db of the fake mappers, a rolled back transaction runs the
+// undo funcs the mappers registered in it
+var fakeDB, _ = gorm.Open(nil, &gorm.Config{ConnPool: fakePool{}})
+
+type fakePool struct {
+	gorm.ConnPool
+}
+
+func (fakePool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return &fakeTx{}, nil
+}
+
+type fakeTx struct {
+	gorm.ConnPool
+	undo []func()
+}
+
+func (tx *fakeTx) Commit() error {
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	return nil
+}
+
+// onRollback register undo in the transaction of db, if any
+func onRollback(db *gorm.DB, undo func()) {
+	if db == nil {
+		return
+	}
+	if tx, ok := db.Statement.ConnPool.(*fakeTx); ok {
+		tx.undo = append(tx.undo, undo)
+	}
+}
+
+type fakeUserMapper struct {
+	repo.UserMapper
+	mu    sync.Mutex
+	users map[string]model.User
+	// insertErr returned by the next Insert
+	insertErr error
+}
+
+func (m *fakeUserMapper) DB() *gorm.DB {
+	return fakeDB
+}
+
+func (m *fakeUserMapper) WithDB(*gorm.DB) repo.UserMapper {
+	return m
+}
+
+func (m *fakeUserMapper) GetByUserName(name string) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[name]
+	if !ok {
+		return model.User{}, errorcode.ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *fakeUserMapper) GetById(id int) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Id == id {
+			return user, nil
+		}
+	}
+	return model.User{}, errorcode.ErrNotFound
+}
+
+func (m *fakeUserMapper) update(id int, fn func(*model.User)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, user := range m.users {
+		if user.Id == id {
+			fn(&user)
+			m.users[name] = user
+		}
+	}
+}
+
+func (m *fakeUserMapper) SetPassword(id int, password string) error {
+	m.update(id, func(user *model.User) {
+		user.Password, user.PasswordLegacy = password, false
+	})
+	return nil
+}
+
+func (m *fakeUserMapper) UpdateDisabled(id int, disabled bool) error {
+	m.update(id, func(user *model.User) {
+		user.Disabled = disabled
+	})
+	return nil
+}
+
+func (m *fakeUserMapper) Insert(items ...*model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.insertErr; err != nil {
+		m.insertErr = nil
+		return err
+	}
+	for _, item := range items {
+		item.Id = len(m.users) + 1
+		m.users[item.UserName] = *item
+	}
+	return nil
+}
+
+func (m *fakeUserMapper) Delete(conds model.User) (int64, error) {
+	if conds.Id == 0 {
+		return 0, gorm.ErrMissingWhereClause
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for name, user := range m.users {
+		if user.Id == conds.Id {
+			delete(m.users, name)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type fakeInviteCodeMapper struct {
+	repo.InviteCodeMapper
+	mu    *sync.Mutex
+	codes map[string]int
+	db    *gorm.DB
+}
+
+func (m *fakeInviteCodeMapper) WithDB(db *gorm.DB) repo.InviteCodeMapper {
+	out := *m
+	out.db = db
+	return &out
+}
+
+func (m *fakeInviteCodeMapper) UseCode(code string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.codes[code] <= 0 {
+		return 0, nil
+	}
+	m.codes[code]--
+	onRollback(m.db, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.codes[code]++
+	})
+	return 1, nil
+}
+
+var users = &fakeUserMapper{users: map[string]model.User{
+	"alice": {Id: 1, UserName: "alice", Password: "secret", PasswordLegacy: true},
+}}
+
+func init() {
+	_ = container.Singleton(func() repo.UserMapper {
+		return users
+	})
+	_ = container.Singleton(func() repo.InviteCodeMapper {
+		return &fakeInviteCodeMapper{mu: &sync.Mutex{}, codes: map[string]int{"welcome": 1, "again": 1}}
+	})
+}
+
+func TestUserAuthenticate(t *testing.T) {
+	svc := service.NewUser()
+	if _, err := svc.Authenticate("alice", "wrong"); errorcode.Code(err) != errorcode.Code(errorcode.ErrInvalidCredentials) {
+		t.Fatalf("expect invalid credentials, got %v", err)
+	}
+	if _, err := svc.Authenticate("nobody", "secret"); errorcode.Code(err) != errorcode.Code(errorcode.ErrInvalidCredentials) {
+		t.Fatalf("expect invalid credentials, got %v", err)
+	}
+
+	// the legacy password is hashed on the first successful login
+	user, err := svc.Authenticate("alice", "secret")
+	if err != nil || user.Id != 1 {
+		t.Fatalf("unexpected login: %+v, %v", user, err)
+	}
+	stored, _ := users.GetByUserName("alice")
+	if stored.PasswordLegacy || !strings.HasPrefix(stored.Password, "$argon2id$") {
+		t.Fatalf("password not rehashed: %+v", stored)
+	}
+	if _, err = svc.Authenticate("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = svc.SetPassword(1, "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = svc.Authenticate("alice", "secret"); err == nil {
+		t.Fatal("old password should be rejected")
+	}
+	if _, err = svc.Authenticate("alice", "changed"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserRegister(t *testing.T) {
+	svc := service.NewUser()
+	if _, err := svc.Register("alice", "password", ""); errorcode.Code(err) != errorcode.Code(errorcode.ErrUserExists) {
+		t.Fatalf("expect user exists, got %v", err)
+	}
+	if _, err := svc.Register("carol", "password", "unknown"); errorcode.Code(err) != errorcode.Code(errorcode.ErrInvalidInviteCode) {
+		t.Fatalf("expect invalid invite code, got %v", err)
+	}
+	user, err := svc.Register("carol", "password", "welcome")
+	if err != nil || user.Role != model.RoleUser || len(user.Password) > 0 {
+		t.Fatalf("unexpected user: %+v, %v", user, err)
+	}
+	if _, err = svc.Register("dave", "password", "welcome"); errorcode.Code(err) != errorcode.Code(errorcode.ErrInvalidInviteCode) {
+		t.Fatalf("invite code should be used up, got %v", err)
+	}
+	if _, err = svc.Authenticate("carol", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a concurrent registration of the same name keeps the invite code
+	users.insertErr = &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'erin'"}
+	if _, err = svc.Register("erin", "password", "again"); errorcode.Code(err) != errorcode.Code(errorcode.ErrUserExists) {
+		t.Fatalf("expect user exists, got %v", err)
+	}
+	if _, err = svc.Register("erin", "password", "again"); err != nil {
+		t.Fatalf("invite code should be kept, got %v", err)
+	}
+
+	if err = svc.ChangePassword(user.Id, "wrong", "changed"); errorcode.Code(err) != errorcode.Code(errorcode.ErrInvalidCredentials) {
+		t.Fatalf("expect invalid credentials, got %v", err)
+	}
+	if err = svc.SetDisabled(user.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = svc.Authenticate("carol", "password"); errorcode.Code(err) != errorcode.Code(errorcode.ErrUserDisabled) {
+		t.Fatalf("expect user disabled, got %v", err)
+	}
+}
+
+func TestUserDelete(t *testing.T) {
+	svc := service.NewUser()
+	for _, id := range []int{0, -1} {
+		if err := svc.Delete(id); errorcode.Code(err) != errorcode.Code(errorcode.ErrParameterInvalid) {
+			t.Fatalf("delete %d: expect parameter invalid, got %v", id, err)
+		}
+	}
+	if err := svc.Delete(1000); errorcode.Code(err) != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("expect not found, got %v", err)
+	}
+}
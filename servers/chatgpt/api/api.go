@@ -1,12 +1,21 @@
 package api
 
 import (
+	"context"
+
 	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
 	"github.com/LSDXXX/libs/pkg/container"
 	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/service"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/admin"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/apikey"
 	"github.com/LSDXXX/servers/chatgpt/api/handlers/auth"
 	"github.com/LSDXXX/servers/chatgpt/api/handlers/chat"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/completions"
 	"github.com/LSDXXX/servers/chatgpt/api/handlers/conversation"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/signup"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/user"
 	"github.com/LSDXXX/servers/chatgpt/bot"
 	"github.com/LSDXXX/servers/chatgpt/config"
 	"github.com/gin-contrib/static"
@@ -26,19 +35,43 @@ func Init() {
 
 	conf := config.ServerConfig()
 
-	chatbot := bot.NewChatbot(conf.Logic.Email, conf.Logic.Password, conf.Logic.Proxy)
-	util.PanicWhenError(container.Singleton(func() *bot.Chatbot {
-		return chatbot
+	// the openai backend has no web accounts, its pool stays empty
+	pool := bot.NewAccountPool()
+	if conf.Logic.Backend != bot.BackendOpenAI {
+		var err error
+		pool, err = bot.NewAccountPoolByConfig(conf.Logic)
+		if err != nil {
+			panic(err)
+		}
+		pool.KeepFresh(context.Background())
+	}
+	util.PanicWhenError(container.Singleton(func() *bot.AccountPool {
+		return pool
+	}))
+	backend, err := bot.NewBackend(conf.Logic, pool)
+	if err != nil {
+		panic(err)
+	}
+	util.PanicWhenError(container.Singleton(func() bot.Backend {
+		return backend
+	}))
+	util.PanicWhenError(container.Singleton(func() *service.RateLimiter {
+		return service.NewRateLimiter(conf.Logic.RateLimit)
 	}))
-	auth, err := auth.NewAuthHandler()
+	authHandler, err := auth.NewAuthHandler()
 	if err != nil {
 		panic(err)
 	}
-	api.RegisterHttpRouter(auth)
+	api.RegisterHttpRouter(authHandler)
 	api.RegisterHttpRouter(&staticFileHandler{
 		path: "../../frontend/dist",
 	})
 
-	conversation.Register(auth.Middleware())
-	chat.Register(auth.Middleware())
+	conversation.Register(authHandler.Middleware())
+	admin.Register(authHandler.Middleware())
+	user.Register(authHandler.Middleware(), auth.RequireSession())
+	apikey.Register(authHandler.Middleware(), auth.RequireSession())
+	signup.Register()
+	chat.Register(authHandler.Middleware(), auth.RequirePermission(model.PermChatWS))
+	completions.Register(authHandler.Middleware(), auth.RequirePermission(model.PermChat))
 }
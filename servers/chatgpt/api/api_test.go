@@ -0,0 +1,1576 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	commonapi "github.com/LSDXXX/libs/api"
+	libsconfig "github.com/LSDXXX/libs/config"
+	"github.com/LSDXXX/libs/infra"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/LSDXXX/servers/chatgpt/api"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/chat"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/completions"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/conversation"
+	"github.com/LSDXXX/servers/chatgpt/bot"
+	"github.com/LSDXXX/servers/chatgpt/bot/bottest"
+	serverconfig "github.com/LSDXXX/servers/chatgpt/config"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+var (
+	fake   *bottest.Server
+	server *httptest.Server
+)
+
+// fakeDB gorm db of the fake mappers, its transactions do nothing
+var fakeDB, _ = gorm.Open(nil, &gorm.Config{ConnPool: fakePool{}})
+
+type fakePool struct {
+	gorm.ConnPool
+}
+
+func (fakePool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return &fakeTx{}, nil
+}
+
+type fakeTx struct {
+	gorm.ConnPool
+}
+
+func (*fakeTx) Commit() error {
+	return nil
+}
+
+func (*fakeTx) Rollback() error {
+	return nil
+}
+
+// fakeUserMapper users with legacy plain text passwords, hashed on their first login
+type fakeUserMapper struct {
+	repo.UserMapper
+	mu     sync.Mutex
+	users  map[string]model.User
+	nextId int
+}
+
+func (m *fakeUserMapper) DB() *gorm.DB {
+	return fakeDB
+}
+
+func (m *fakeUserMapper) WithDB(*gorm.DB) repo.UserMapper {
+	return m
+}
+
+func (m *fakeUserMapper) GetByUserName(name string) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[name]
+	if !ok {
+		return model.User{}, errorcode.ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *fakeUserMapper) GetById(id int) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Id == id {
+			return user, nil
+		}
+	}
+	return model.User{}, errorcode.ErrNotFound
+}
+
+func (m *fakeUserMapper) update(id int, fn func(*model.User)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, user := range m.users {
+		if user.Id == id {
+			fn(&user)
+			m.users[name] = user
+		}
+	}
+}
+
+func (m *fakeUserMapper) SetPassword(id int, password string) error {
+	m.update(id, func(user *model.User) {
+		user.Password, user.PasswordLegacy = password, false
+	})
+	return nil
+}
+
+func (m *fakeUserMapper) UpdateProfile(id int, nickname, email string) error {
+	m.update(id, func(user *model.User) {
+		user.Nickname, user.Email = nickname, email
+	})
+	return nil
+}
+
+func (m *fakeUserMapper) UpdateDisabled(id int, disabled bool) error {
+	m.update(id, func(user *model.User) {
+		user.Disabled = disabled
+	})
+	return nil
+}
+
+func (m *fakeUserMapper) Insert(items ...*model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range items {
+		m.nextId++
+		item.Id = m.nextId
+		m.users[item.UserName] = *item
+	}
+	return nil
+}
+
+func (m *fakeUserMapper) Delete(conds model.User) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, user := range m.users {
+		if user.Id == conds.Id {
+			delete(m.users, name)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// Page all users on one page
+func (m *fakeUserMapper) Page(page, pageSize int, order string, conds ...model.User) ([]model.User, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.User
+	for _, user := range m.users {
+		out = append(out, user)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Id < out[j].Id })
+	return out, int64(len(out)), nil
+}
+
+type fakeInviteCodeMapper struct {
+	repo.InviteCodeMapper
+	mu    sync.Mutex
+	codes map[string]int
+}
+
+func (m *fakeInviteCodeMapper) WithDB(*gorm.DB) repo.InviteCodeMapper {
+	return m
+}
+
+func (m *fakeInviteCodeMapper) Insert(items ...*model.InviteCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range items {
+		m.codes[item.Code] = item.MaxUses
+	}
+	return nil
+}
+
+func (m *fakeInviteCodeMapper) UseCode(code string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.codes[code] <= 0 {
+		return 0, nil
+	}
+	m.codes[code]--
+	return 1, nil
+}
+
+type fakeApiKeyMapper struct {
+	repo.ApiKeyMapper
+	mu   sync.Mutex
+	keys []model.ApiKey
+}
+
+func (m *fakeApiKeyMapper) Insert(items ...*model.ApiKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range items {
+		item.Id = len(m.keys) + 1
+		m.keys = append(m.keys, *item)
+	}
+	return nil
+}
+
+func (m *fakeApiKeyMapper) find(fn func(model.ApiKey) bool) []model.ApiKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.ApiKey
+	for _, key := range m.keys {
+		if fn(key) {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+func (m *fakeApiKeyMapper) GetByHash(keyHash string) (model.ApiKey, error) {
+	keys := m.find(func(key model.ApiKey) bool { return key.KeyHash == keyHash })
+	if len(keys) == 0 {
+		return model.ApiKey{}, errorcode.ErrNotFound
+	}
+	return keys[0], nil
+}
+
+func (m *fakeApiKeyMapper) ListByUserId(userId int) ([]model.ApiKey, error) {
+	return m.find(func(key model.ApiKey) bool { return key.UserId == userId }), nil
+}
+
+func (m *fakeApiKeyMapper) UpdateLastUsed(id int, lastUsed time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keys {
+		if m.keys[i].Id == id {
+			m.keys[i].LastUsedTime = &lastUsed
+		}
+	}
+	return nil
+}
+
+func (m *fakeApiKeyMapper) Delete(conds model.ApiKey) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, key := range m.keys {
+		if key.Id == conds.Id && key.UserId == conds.UserId {
+			m.keys[i].KeyHash = ""
+			m.keys[i].UserId = 0
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+var users = &fakeUserMapper{users: map[string]model.User{
+	"alice": {Id: 1, UserName: "alice", Password: "secret", PasswordLegacy: true},
+	"bob":   {Id: 2, UserName: "bob", Password: "secret", PasswordLegacy: true},
+	"dave":  {Id: 3, UserName: "dave", Password: "secret", PasswordLegacy: true, Role: model.RoleAdmin},
+	// frank role without any permission
+	"frank": {Id: 4, UserName: "frank", Password: "secret", PasswordLegacy: true, Role: "guest"},
+}, nextId: 4}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "chatgpt-api-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	fake = bottest.NewServer()
+	defer fake.Close()
+
+	var conf serverconfig.Config
+	conf.Common.GinLog.Level = "error"
+	conf.Common.GinLog.Output.Filename = path.Join(dir, "gin.log")
+	conf.Logic = serverconfig.LogicConfig{
+		Backend:     bot.BackendWeb,
+		BaseURL:     fake.URL,
+		AccessToken: fake.AccessToken(),
+		Admins:      []string{"alice"},
+		SignUp:      serverconfig.SignUpInvite,
+		RateLimit: libsconfig.RateLimitConfig{
+			ConcurrentStreams: 2,
+			StreamTTL:         time.Minute,
+		},
+	}
+	conf.JWT = serverconfig.JWTConfig{
+		Algorithm:      serverconfig.JWTHS256,
+		Keys:           []serverconfig.JWTKeyConfig{{Id: "test", Secret: "test secret"}},
+		Timeout:        time.Hour,
+		RefreshTimeout: time.Hour,
+	}
+	serverconfig.SetServerConfig(&conf)
+	_ = container.Singleton(func() *serverconfig.Config {
+		return &conf
+	})
+	_ = container.Singleton(func() *libsconfig.Config {
+		return &conf.Common
+	})
+	_ = container.Singleton(func() repo.UserMapper {
+		return users
+	})
+	_ = container.Singleton(func() repo.InviteCodeMapper {
+		return &fakeInviteCodeMapper{codes: make(map[string]int)}
+	})
+	_ = container.Singleton(func() repo.ApiKeyMapper {
+		return &fakeApiKeyMapper{}
+	})
+	_ = container.Singleton(infra.NewConversationHandlerImp)
+	_ = container.Singleton(infra.NewRateLimitStoreImp)
+	_ = container.Singleton(infra.NewTokenDenylistImp)
+
+	if err = commonapi.Init("test"); err != nil {
+		panic(err)
+	}
+	api.Init()
+	engine := commonapi.DefaultEngine(&conf.Common.GinLog)
+	for _, router := range commonapi.GetHttpRouters() {
+		router.Use(engine)
+	}
+	server = httptest.NewServer(engine)
+	defer server.Close()
+
+	m.Run()
+}
+
+func login(t *testing.T) string {
+	t.Helper()
+	return loginAs(t, "alice")
+}
+
+func loginAs(t *testing.T, name string) string {
+	t.Helper()
+	return loginWith(t, name, "secret")
+}
+
+func loginWith(t *testing.T, name, password string) string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"username": name, "password": password})
+	res, err := http.Post(server.URL+"/login", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&out); err != nil || len(out.Token) == 0 {
+		t.Fatalf("login failed: %d, %v", res.StatusCode, err)
+	}
+	return out.Token
+}
+
+func TestLoginPassword(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"username": "alice", "password": "wrong"})
+	res, err := http.Post(server.URL+"/login", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect 401 on a wrong password, got %d", res.StatusCode)
+	}
+
+	login(t)
+	stored, _ := users.GetByUserName("alice")
+	if stored.PasswordLegacy || !strings.HasPrefix(stored.Password, "$argon2id$") {
+		t.Fatalf("legacy password not rehashed: %+v", stored)
+	}
+	login(t)
+}
+
+// requestJSON send v as json body if not nil, and decode the data of the response into data
+func requestJSON(t *testing.T, method, token, url string, v, data interface{}) *model.Response {
+	t.Helper()
+	var body io.Reader
+	if v != nil {
+		raw, _ := json.Marshal(v)
+		body = bytes.NewBuffer(raw)
+	}
+	req, _ := http.NewRequest(method, server.URL+url, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := model.ReadFromBody(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != nil && out.Data != nil {
+		raw, _ := json.Marshal(out.Data)
+		if err = json.Unmarshal(raw, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+func postJSON(t *testing.T, token, url string, v interface{}) *model.Response {
+	t.Helper()
+	return requestJSON(t, http.MethodPost, token, url, v, nil)
+}
+
+func getJSON(t *testing.T, token, url string, data interface{}) *model.Response {
+	t.Helper()
+	return requestJSON(t, http.MethodGet, token, url, nil, data)
+}
+
+type sseEvent struct {
+	name string
+	data conversation.AskEvent
+}
+
+func askStream(t *testing.T, token string, v interface{}) []sseEvent {
+	t.Helper()
+	return postStream(t, token, "/api/ask/stream", v)
+}
+
+func postStream(t *testing.T, token, url string, v interface{}) []sseEvent {
+	t.Helper()
+	body, _ := json.Marshal(v)
+	req, _ := http.NewRequest(http.MethodPost, server.URL+url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+	var out []sseEvent
+	var event sseEvent
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event.name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event.data); err != nil {
+				t.Fatal(err)
+			}
+		case len(line) == 0:
+			out = append(out, event)
+			event = sseEvent{}
+		}
+	}
+	return out
+}
+
+func TestAskUnauthorized(t *testing.T) {
+	res, err := http.Post(server.URL+"/api/ask", "application/json",
+		strings.NewReader(`{"content":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect 401, got %d", res.StatusCode)
+	}
+}
+
+func TestAsk(t *testing.T) {
+	token := login(t)
+	fake.Reply(bottest.Reply{Parts: []string{"fine", ", thanks"}})
+	res := postJSON(t, token, "/api/ask", map[string]string{"content": "how are you"})
+	if res.Code != 0 || res.Data != "fine, thanks" {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+
+	fake.Reply(bottest.Reply{Error: "overloaded"})
+	res = postJSON(t, token, "/api/ask", map[string]string{"content": "again"})
+	if res.Code == 0 {
+		t.Fatalf("expect error response, got %+v", res)
+	}
+
+	res = postJSON(t, token, "/api/ask", map[string]string{})
+	if res.Code != errorcode.Code(errorcode.ErrParameterInvalid) {
+		t.Fatalf("expect parameter error, got %+v", res)
+	}
+}
+
+// dialChat open the chat websocket
+func dialChat(t *testing.T, token string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat"
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{
+		"Authorization": {"Bearer " + token},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func sendFrame(t *testing.T, conn *websocket.Conn, frame chat.Frame) {
+	t.Helper()
+	frame.V = chat.ProtocolVersion
+	if err := conn.WriteJSON(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readUntil read frames until one of the type
+func readUntil(t *testing.T, conn *websocket.Conn, typ string) ([]chat.Frame, chat.Frame) {
+	t.Helper()
+	var frames []chat.Frame
+	for {
+		var frame chat.Frame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+		if frame.V != chat.ProtocolVersion {
+			t.Fatalf("unexpected version: %+v", frame)
+		}
+		if frame.Type == typ {
+			return frames, frame
+		}
+		if frame.Type == chat.TypeError {
+			t.Fatalf("unexpected error: %+v", frame.Error)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestChatWebSocket(t *testing.T) {
+	conn := dialChat(t, login(t))
+	defer conn.Close()
+
+	fake.Reply(bottest.Reply{Parts: []string{"one", " two", " three"}, Delay: time.Millisecond})
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeAsk, Id: "1", Content: "count"})
+	deltas, done := readUntil(t, conn, chat.TypeDone)
+	var text string
+	for _, delta := range deltas {
+		if delta.Type != chat.TypeDelta || delta.Id != "1" {
+			t.Fatalf("unexpected frame: %+v", delta)
+		}
+		text += delta.Content
+	}
+	if text != "one two three" || len(deltas) != 3 {
+		t.Fatalf("unexpected deltas: %+v", deltas)
+	}
+	if done.Id != "1" || done.Reason != chat.DoneStop || len(done.ConversationId) == 0 || len(done.MessageId) == 0 {
+		t.Fatalf("unexpected done: %+v", done)
+	}
+	reqs := fake.Requests()
+	if last := reqs[len(reqs)-1]; last.Content != "count" {
+		t.Fatalf("unexpected upstream request: %+v", last)
+	}
+
+	// continue the conversation explicitly
+	fake.Reply(bottest.Reply{Parts: []string{"four"}})
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeAsk, Id: "2", ConversationId: done.ConversationId, Content: "more"})
+	_, next := readUntil(t, conn, chat.TypeDone)
+	if next.Id != "2" || next.ConversationId != done.ConversationId {
+		t.Fatalf("unexpected done: %+v", next)
+	}
+	reqs = fake.Requests()
+	if last := reqs[len(reqs)-1]; last.ParentMessageId != done.MessageId {
+		t.Fatalf("expect parent %s, got %+v", done.MessageId, last)
+	}
+}
+
+func TestChatWebSocketUpstreamError(t *testing.T) {
+	token := login(t)
+	conn := dialChat(t, token)
+	defer conn.Close()
+
+	fake.Reply(bottest.Reply{Parts: []string{"first"}})
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeAsk, Id: "1", Content: "hi"})
+	_, done := readUntil(t, conn, chat.TypeDone)
+
+	fake.Reply(bottest.Reply{Parts: []string{"partial"}, Error: "overloaded"})
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeAsk, Id: "2", ConversationId: done.ConversationId, Content: "again"})
+	var frame chat.Frame
+	for frame.Type != chat.TypeError {
+		frame = chat.Frame{}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+		if frame.Type == chat.TypeDone {
+			t.Fatalf("unexpected done: %+v", frame)
+		}
+	}
+	if frame.Id != "2" || frame.ConversationId != done.ConversationId {
+		t.Fatalf("unexpected error frame: %+v", frame)
+	}
+
+	// the truncated answer is not saved
+	var detail model.ConversationDetail
+	getJSON(t, token, "/api/conversation/"+done.ConversationId, &detail)
+	if len(detail.Messages) != 2 || detail.CurrentNode != done.MessageId {
+		t.Fatalf("truncated answer saved: %+v", detail)
+	}
+}
+
+func TestChatWebSocketProtocol(t *testing.T) {
+	conn := dialChat(t, login(t))
+	defer conn.Close()
+
+	sendFrame(t, conn, chat.Frame{Type: chat.TypePing, Id: "p"})
+	if _, pong := readUntil(t, conn, chat.TypePong); pong.Id != "p" {
+		t.Fatalf("unexpected pong: %+v", pong)
+	}
+
+	invalid := errorcode.Code(errorcode.ErrParameterInvalid)
+	cases := []struct {
+		name  string
+		frame string
+		code  int
+	}{
+		{"not json", "hello", invalid},
+		{"version", `{"v":2,"type":"ask","id":"x","content":"hi"}`, invalid},
+		{"type", `{"v":1,"type":"shout","id":"x"}`, invalid},
+		{"no content", `{"v":1,"type":"ask","id":"x"}`, invalid},
+		{"cancel unknown", `{"v":1,"type":"cancel","id":"x"}`, errorcode.Code(errorcode.ErrNotFound)},
+	}
+	for _, c := range cases {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(c.frame)); err != nil {
+			t.Fatal(err)
+		}
+		var frame chat.Frame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+		if frame.Type != chat.TypeError || frame.Error == nil || frame.Error.Code != c.code {
+			t.Fatalf("%s: unexpected frame: %+v", c.name, frame)
+		}
+	}
+}
+
+func TestChatWebSocketHandshake(t *testing.T) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat"
+	// browsers offer the token as a subprotocol, it is never selected
+	dialer := websocket.Dialer{Subprotocols: []string{chat.Subprotocol, "bearer." + login(t)}}
+	conn, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != chat.Subprotocol {
+		t.Fatalf("unexpected subprotocol %s", got)
+	}
+
+	_, resp, err = dialer.Dial(url, http.Header{"Origin": {"https://evil.example"}})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expect forbidden origin, got %v", err)
+	}
+	_, resp, err = websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect unauthorized, got %v", err)
+	}
+
+	// the subprotocol is only read from upgrade requests
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/user/profile", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "bearer."+login(t))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect unauthorized plain request, got %d", res.StatusCode)
+	}
+}
+
+func TestChatWebSocketCancel(t *testing.T) {
+	conn := dialChat(t, login(t))
+	defer conn.Close()
+
+	fake.Reply(slowReply())
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeAsk, Id: "slow", Content: "long story"})
+	var first chat.Frame
+	if err := conn.ReadJSON(&first); err != nil || first.Type != chat.TypeDelta {
+		t.Fatalf("unexpected frame: %+v, %v", first, err)
+	}
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeCancel, Id: "slow"})
+	_, done := readUntil(t, conn, chat.TypeDone)
+	if done.Id != "slow" || done.Reason != chat.DoneCancelled {
+		t.Fatalf("unexpected done: %+v", done)
+	}
+	waitUpstreamIdle(t)
+}
+
+func TestConversationHistory(t *testing.T) {
+	token := login(t)
+	fake.Reply(bottest.Reply{Parts: []string{"paris"}})
+	res := postJSON(t, token, "/api/ask", map[string]string{"content": "capital of france"})
+	if res.Code != 0 {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+
+	var convs []model.Conversation
+	getJSON(t, token, "/api/conversations", &convs)
+	var conv *model.Conversation
+	for i := range convs {
+		if convs[i].Title == "capital of france" {
+			conv = &convs[i]
+			break
+		}
+	}
+	if conv == nil || conv.UserId != 1 {
+		t.Fatalf("conversation not listed: %+v", convs)
+	}
+
+	fake.Reply(bottest.Reply{Parts: []string{"berlin"}, Model: "other-model"})
+	res = postJSON(t, token, "/api/ask", map[string]string{
+		"content":         "and germany",
+		"conversation_id": conv.ConversationId,
+	})
+	if res.Code != 0 || res.Data != "berlin" {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+
+	var detail model.ConversationDetail
+	getJSON(t, token, "/api/conversation/"+conv.ConversationId, &detail)
+	want := []struct{ role, content string }{
+		{"user", "capital of france"},
+		{"assistant", "paris"},
+		{"user", "and germany"},
+		{"assistant", "berlin"},
+	}
+	if len(detail.Messages) != len(want) {
+		t.Fatalf("unexpected messages: %+v", detail.Messages)
+	}
+	for i, m := range detail.Messages {
+		if m.Role != want[i].role || m.Content != want[i].content {
+			t.Fatalf("message %d: %+v", i, m)
+		}
+		if i > 0 && m.ParentId != detail.Messages[i-1].MessageId {
+			t.Fatalf("message %d is not linked to its parent: %+v", i, m)
+		}
+		if i < len(want)-1 && (len(m.Children) != 1 || m.Children[0] != detail.Messages[i+1].MessageId) {
+			t.Fatalf("message %d has unexpected children: %+v", i, m.Children)
+		}
+	}
+	if detail.Messages[3].ModelSlug != "other-model" || detail.Messages[3].FinishReason != "stop" {
+		t.Fatalf("unexpected metadata: %+v", detail.Messages[3])
+	}
+	if detail.CurrentNode != detail.Messages[3].MessageId {
+		t.Fatalf("unexpected current node: %s", detail.CurrentNode)
+	}
+
+	res = getJSON(t, token, "/api/conversation/not-exist", nil)
+	if res.Code != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("expect not found, got %+v", res)
+	}
+}
+
+func TestConversationOwnership(t *testing.T) {
+	alice, bob := login(t), loginAs(t, "bob")
+
+	var conv model.Conversation
+	res := requestJSON(t, http.MethodPost, alice, "/api/conversation",
+		map[string]string{"title": "private"}, &conv)
+	if res.Code != 0 || len(conv.ConversationId) == 0 || conv.Title != "private" {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+	path := "/api/conversation/" + conv.ConversationId
+	forbidden := errorcode.Code(errorcode.ErrForbidden)
+
+	if res = getJSON(t, bob, path, nil); res.Code != forbidden {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+	res = postJSON(t, bob, "/api/ask", map[string]string{
+		"content":         "let me in",
+		"conversation_id": conv.ConversationId,
+	})
+	if res.Code != forbidden {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+	res = requestJSON(t, http.MethodPut, bob, path+"/title", map[string]string{"title": "mine"}, nil)
+	if res.Code != forbidden {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+	if res = requestJSON(t, http.MethodDelete, bob, path, nil, nil); res.Code != forbidden {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+	var convs []model.Conversation
+	getJSON(t, bob, "/api/conversations", &convs)
+	for _, c := range convs {
+		if c.UserId != 2 {
+			t.Fatalf("foreign conversation listed: %+v", c)
+		}
+	}
+
+	res = requestJSON(t, http.MethodPut, alice, path+"/title", map[string]string{"title": "renamed"}, nil)
+	if res.Code != 0 {
+		t.Fatalf("rename failed: %+v", res)
+	}
+	res = requestJSON(t, http.MethodPut, alice, path+"/archive", map[string]bool{"archived": true}, nil)
+	if res.Code != 0 {
+		t.Fatalf("archive failed: %+v", res)
+	}
+	listed := func(archived string) *model.Conversation {
+		var convs []model.Conversation
+		getJSON(t, alice, "/api/conversations?archived="+archived, &convs)
+		for i := range convs {
+			if convs[i].ConversationId == conv.ConversationId {
+				return &convs[i]
+			}
+		}
+		return nil
+	}
+	if listed("false") != nil {
+		t.Fatal("archived conversation listed")
+	}
+	if c := listed("true"); c == nil || c.Title != "renamed" || !c.Archived {
+		t.Fatalf("unexpected archived conversation: %+v", c)
+	}
+
+	if res = requestJSON(t, http.MethodDelete, alice, path, nil, nil); res.Code != 0 {
+		t.Fatalf("delete failed: %+v", res)
+	}
+	if res = getJSON(t, alice, path, nil); res.Code != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("expect not found, got %+v", res)
+	}
+}
+
+// TestGeneratedClient call the api through the generated client
+func TestGeneratedClient(t *testing.T) {
+	token := login(t)
+	client := conversation.NewConversationHandlerClient(server.URL,
+		func(ctx context.Context, req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		})
+
+	conv, err := client.CreateConversation(conversation.CreateConversationReq{Title: "client"})
+	if err != nil || len(conv.ConversationId) == 0 {
+		t.Fatalf("create conversation: %+v, %v", conv, err)
+	}
+	err = client.RenameConversation(conv.ConversationId, conversation.RenameConversationReq{Title: "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	convs, err := client.ListConversations(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, c := range convs {
+		found = found || c.ConversationId == conv.ConversationId && c.Title == "renamed"
+	}
+	if !found {
+		t.Fatalf("conversation not listed: %+v", convs)
+	}
+
+	_, err = client.GetConversation("not-exist")
+	if !errors.Is(err, errorcode.ErrNotFound) || errorcode.Code(err) != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("expect not found, got %v", err)
+	}
+	err = client.RenameConversation(conv.ConversationId, conversation.RenameConversationReq{})
+	if !errors.Is(err, errorcode.ErrParameterInvalid) {
+		t.Fatalf("expect parameter error, got %v", err)
+	}
+
+	fake.Reply(bottest.Reply{Parts: []string{"one", " two"}, Delay: time.Millisecond})
+	events, err := client.AskStream(conversation.AskReq{ConversationId: conv.ConversationId, Content: "count"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last conversation.AskEvent
+	var n int
+	for e := range events {
+		last = e
+		n++
+	}
+	if n != 3 || last.ConversationId != conv.ConversationId || len(last.ParentId) == 0 {
+		t.Fatalf("unexpected events: %d, %+v", n, last)
+	}
+
+	_, err = conversation.NewConversationHandlerClient(server.URL).ListModels()
+	if err == nil {
+		t.Fatal("expect unauthorized")
+	}
+}
+
+// TestRouterGroup the wrapper middlewares are chained by gin, so they see
+// the answer after c.Next
+func TestRouterGroup(t *testing.T) {
+	var written []bool
+	engine := gin.New()
+	conversation.NewConversationHandlerWrapper([]gin.HandlerFunc{func(c *gin.Context) {
+		c.Next()
+		written = append(written, c.Writer.Written())
+	}}).Group(engine.Group("/v2"))
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/api/models", nil))
+	res, err := model.ReadFromBody(io.NopCloser(rec.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != errorcode.Code(errorcode.ErrUnauthorized) || len(written) != 1 || !written[0] {
+		t.Fatalf("unexpected answer: %+v, %v", res, written)
+	}
+}
+
+func TestAskStream(t *testing.T) {
+	token := login(t)
+	fake.Reply(bottest.Reply{Parts: []string{"one", " two", " three"}, Delay: time.Millisecond})
+	events := askStream(t, token, map[string]string{"content": "count"})
+	if len(events) != 4 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	for _, e := range events[:3] {
+		if e.name != conversation.AskEventMessage || len(e.data.MessageId) == 0 {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	}
+	done := events[3]
+	if events[2].data.Content != "one two three" || done.name != conversation.AskEventDone {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if len(done.data.ConversationId) == 0 || done.data.ParentId != events[2].data.MessageId {
+		t.Fatalf("unexpected done event: %+v", done)
+	}
+
+	var detail model.ConversationDetail
+	getJSON(t, token, "/api/conversation/"+done.data.ConversationId, &detail)
+	if len(detail.Messages) != 2 || detail.CurrentNode != done.data.ParentId {
+		t.Fatalf("answer not saved: %+v", detail)
+	}
+
+	fake.Reply(bottest.Reply{Parts: []string{"partial"}, Error: "overloaded"})
+	events = askStream(t, token, map[string]string{
+		"content":         "again",
+		"conversation_id": done.data.ConversationId,
+	})
+	// a single terminal error, the truncated answer is not saved
+	terminal := events[len(events)-1]
+	if terminal.name != conversation.AskEventError || terminal.data.Error != "overloaded" ||
+		terminal.data.ParentId != done.data.ParentId || terminal.data.ConversationId != done.data.ConversationId {
+		t.Fatalf("expect terminal error event: %+v", events)
+	}
+	for _, e := range events[:len(events)-1] {
+		if e.name != conversation.AskEventMessage {
+			t.Fatalf("unexpected event before the end: %+v", events)
+		}
+	}
+	reqs := fake.Requests()
+	if last := reqs[len(reqs)-1]; last.ParentMessageId != done.data.ParentId {
+		t.Fatalf("unexpected upstream parent: %+v", last)
+	}
+	getJSON(t, token, "/api/conversation/"+done.data.ConversationId, &detail)
+	if len(detail.Messages) != 2 || detail.CurrentNode != done.data.ParentId {
+		t.Fatalf("truncated answer saved: %+v", detail)
+	}
+
+	// an upstream closing without any answer still ends the stream
+	fake.Reply(bottest.Reply{})
+	events = askStream(t, token, map[string]string{
+		"content":         "again",
+		"conversation_id": done.data.ConversationId,
+	})
+	if len(events) != 1 || events[0].name != conversation.AskEventError || events[0].data.ParentId != done.data.ParentId {
+		t.Fatalf("expect terminal error event: %+v", events)
+	}
+}
+
+// waitUpstreamIdle wait until the fake has stopped streaming
+func waitUpstreamIdle(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for fake.Active() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("upstream still streaming: %d", fake.Active())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func slowReply() bottest.Reply {
+	return bottest.Reply{Parts: strings.Split(strings.Repeat("x", 200), ""), Delay: 20 * time.Millisecond}
+}
+
+// openStream start a slow answer and wait for its first event, cancel
+// disconnects
+func openStream(t *testing.T, token string) context.CancelFunc {
+	t.Helper()
+	fake.Reply(slowReply())
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/ask/stream",
+		strings.NewReader(`{"content":"long story"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bufio.NewReader(res.Body).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		cancel()
+		res.Body.Close()
+	}
+}
+
+func TestAskStreamDisconnect(t *testing.T) {
+	cancel := openStream(t, login(t))
+	cancel()
+	waitUpstreamIdle(t)
+}
+
+func TestChatWebSocketDisconnect(t *testing.T) {
+	conn := dialChat(t, login(t))
+	defer conn.Close()
+
+	fake.Reply(slowReply())
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeAsk, Id: "1", Content: "long story"})
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	waitUpstreamIdle(t)
+}
+
+// doneEvent the done event of a stream
+func doneEvent(t *testing.T, events []sseEvent) conversation.AskEvent {
+	t.Helper()
+	if len(events) == 0 || events[len(events)-1].name != conversation.AskEventDone {
+		t.Fatalf("stream not done: %+v", events)
+	}
+	return events[len(events)-1].data
+}
+
+func TestConversationBranches(t *testing.T) {
+	token := loginAs(t, "alice")
+	fake.Reply(bottest.Reply{Parts: []string{"a1"}}, bottest.Reply{Parts: []string{"a2"}})
+	first := doneEvent(t, askStream(t, token, map[string]string{"content": "q1"}))
+	convId := first.ConversationId
+	second := doneEvent(t, askStream(t, token, map[string]string{"content": "q2", "conversation_id": convId}))
+	base := "/api/conversation/" + convId
+
+	detail := func() (*model.ConversationDetail, map[string]model.MessageNode) {
+		var detail model.ConversationDetail
+		getJSON(t, token, base, &detail)
+		nodes := make(map[string]model.MessageNode)
+		for _, m := range detail.Messages {
+			nodes[m.MessageId] = m
+		}
+		return &detail, nodes
+	}
+	_, nodes := detail()
+	q2 := nodes[second.ParentId].ParentId
+
+	// regenerate answers the same prompt again
+	fake.Reply(bottest.Reply{Parts: []string{"a2", " again"}})
+	regenerated := doneEvent(t, postStream(t, token, base+"/regenerate", map[string]string{}))
+	reqs := fake.Requests()
+	if last := reqs[len(reqs)-1]; last.Action != bot.ActionVariant || last.MessageId != q2 ||
+		last.ParentMessageId != first.ParentId || last.Content != "q2" {
+		t.Fatalf("unexpected regenerate request: %+v", last)
+	}
+	conv, nodes := detail()
+	if len(nodes[q2].Children) != 2 || conv.CurrentNode != regenerated.ParentId {
+		t.Fatalf("unexpected tree after regenerate: %+v", conv)
+	}
+
+	// editing q2 forks a branch under a1
+	fake.Reply(bottest.Reply{Parts: []string{"a3"}})
+	edited := doneEvent(t, postStream(t, token, base+"/edit", map[string]string{
+		"message_id": q2,
+		"content":    "q2 edited",
+	}))
+	reqs = fake.Requests()
+	if last := reqs[len(reqs)-1]; last.Action != bot.ActionNext || last.ParentMessageId != first.ParentId ||
+		last.Content != "q2 edited" {
+		t.Fatalf("unexpected edit request: %+v", last)
+	}
+	conv, nodes = detail()
+	if len(nodes[first.ParentId].Children) != 2 || conv.CurrentNode != edited.ParentId {
+		t.Fatalf("unexpected tree after edit: %+v", conv)
+	}
+
+	// switching back to q2 lands on its latest answer
+	var node string
+	res := requestJSON(t, http.MethodPut, token, base+"/current_node", map[string]string{"message_id": q2}, &node)
+	if res.Code != 0 || node != regenerated.ParentId {
+		t.Fatalf("unexpected switch: %+v, %s", res, node)
+	}
+	fake.Reply(bottest.Reply{Parts: []string{"a4"}})
+	askStream(t, token, map[string]string{"content": "q3", "conversation_id": convId})
+	reqs = fake.Requests()
+	if last := reqs[len(reqs)-1]; last.ParentMessageId != regenerated.ParentId {
+		t.Fatalf("ask did not follow the switched branch: %+v", last)
+	}
+
+	res = postJSON(t, token, base+"/regenerate", map[string]string{"message_id": q2})
+	if res.Code != errorcode.Code(errorcode.ErrParameterInvalid) {
+		t.Fatalf("expect parameter error, got %+v", res)
+	}
+	res = postJSON(t, token, base+"/edit", map[string]string{"message_id": first.ParentId, "content": "x"})
+	if res.Code != errorcode.Code(errorcode.ErrParameterInvalid) {
+		t.Fatalf("expect parameter error, got %+v", res)
+	}
+	res = requestJSON(t, http.MethodPut, token, base+"/current_node", map[string]string{"message_id": "missing"}, nil)
+	if res.Code != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("expect not found, got %+v", res)
+	}
+	bob := loginAs(t, "bob")
+	res = postJSON(t, bob, base+"/regenerate", map[string]string{})
+	if res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	token := loginAs(t, "bob")
+	first, second := openStream(t, token), openStream(t, token)
+
+	res := postJSON(t, token, "/api/ask", map[string]string{"content": "one more"})
+	if res.Code != errorcode.Code(errorcode.ErrTooManyRequests) {
+		t.Fatalf("expect too many requests, got %+v", res)
+	}
+
+	conn := dialChat(t, token)
+	defer conn.Close()
+	sendFrame(t, conn, chat.Frame{Type: chat.TypeAsk, Id: "1", Content: "one more"})
+	var frame chat.Frame
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Type != chat.TypeError || frame.Id != "1" || frame.Error.Code != errorcode.Code(errorcode.ErrTooManyRequests) {
+		t.Fatalf("expect too many requests, got %+v", frame)
+	}
+
+	first()
+	second()
+	waitUpstreamIdle(t)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res = postJSON(t, token, "/api/ask", map[string]string{"content": "one more"})
+		if res.Code == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slots not released: %+v", res)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminAccounts(t *testing.T) {
+	var accounts []bot.AccountStatus
+	res := getJSON(t, loginAs(t, "alice"), "/api/admin/accounts", &accounts)
+	if res.Code != 0 || len(accounts) != 1 || !accounts[0].Healthy || accounts[0].Requests == 0 {
+		t.Fatalf("unexpected accounts: %+v, %+v", res, accounts)
+	}
+	res = getJSON(t, loginAs(t, "bob"), "/api/admin/accounts", nil)
+	if res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	token := loginAs(t, "frank")
+	res := getJSON(t, token, "/api/models", nil)
+	if res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{
+		"Authorization": {"Bearer " + token},
+	})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expect websocket upgrade forbidden, got %v", err)
+	}
+
+	// logic.admins are admins whatever their role
+	res = getJSON(t, loginAs(t, "alice"), "/api/admin/users", nil)
+	if res.Code != 0 {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+}
+
+// TestSignUpStatus sign up answers http statuses and the failed fields
+func TestSignUpStatus(t *testing.T) {
+	post := func(body string) (int, *model.Response) {
+		t.Helper()
+		res, err := http.Post(server.URL+"/api/register", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := model.ReadFromBody(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, out
+	}
+	status, res := post(`{"username":"frank","password":"short"}`)
+	if status != http.StatusBadRequest || res.Code != errorcode.Code(errorcode.ErrParameterInvalid) {
+		t.Fatalf("expect 400, got %d: %+v", status, res)
+	}
+	raw, _ := json.Marshal(res.ErrData)
+	if string(raw) != `[{"field":"password","param":"8","tag":"min"}]` {
+		t.Fatalf("unexpected failed fields: %s", raw)
+	}
+	status, res = post(fmt.Sprintf(`{"username":"signup%d","password":"password1","invite_code":"unknown"}`,
+		time.Now().UnixNano()))
+	if status != http.StatusForbidden || res.Code != errorcode.Code(errorcode.ErrInvalidInviteCode) {
+		t.Fatalf("expect 403, got %d: %+v", status, res)
+	}
+	status, res = post(`{"username":"alice","password":"password1","invite_code":"unknown"}`)
+	if status != http.StatusConflict || res.Code != errorcode.Code(errorcode.ErrUserExists) {
+		t.Fatalf("expect 409, got %d: %+v", status, res)
+	}
+}
+
+func TestUserManagement(t *testing.T) {
+	// sign up needs an invite code created by an admin
+	reg := map[string]string{"username": "carol", "password": "password1"}
+	res := requestJSON(t, http.MethodPost, "", "/api/register", reg, nil)
+	if res.Code != errorcode.Code(errorcode.ErrInvalidInviteCode) {
+		t.Fatalf("expect invite code required, got %+v", res)
+	}
+	var code model.InviteCode
+	res = requestJSON(t, http.MethodPost, loginAs(t, "bob"), "/api/admin/invite_codes", map[string]int{}, nil)
+	if res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect forbidden, got %+v", res)
+	}
+	admin := loginAs(t, "dave")
+	res = requestJSON(t, http.MethodPost, admin, "/api/admin/invite_codes", map[string]int{"max_uses": 1}, &code)
+	if res.Code != 0 || len(code.Code) == 0 {
+		t.Fatalf("create invite code: %+v", res)
+	}
+	reg["invite_code"] = code.Code
+	var carol model.User
+	res = requestJSON(t, http.MethodPost, "", "/api/register", reg, &carol)
+	if res.Code != 0 || carol.Id == 0 || carol.Role != model.RoleUser {
+		t.Fatalf("register: %+v, %+v", res, carol)
+	}
+	res = requestJSON(t, http.MethodPost, "", "/api/register",
+		map[string]string{"username": "erin", "password": "password1", "invite_code": code.Code}, nil)
+	if res.Code != errorcode.Code(errorcode.ErrInvalidInviteCode) {
+		t.Fatalf("invite code should be used up, got %+v", res)
+	}
+
+	// profile and password of the user
+	token := loginWith(t, "carol", "password1")
+	res = requestJSON(t, http.MethodPut, token, "/api/user/profile",
+		map[string]string{"nickname": "Carol", "email": "carol@example.com"}, nil)
+	if res.Code != 0 {
+		t.Fatalf("update profile: %+v", res)
+	}
+	var profile model.User
+	if res = getJSON(t, token, "/api/user/profile", &profile); res.Code != 0 || profile.Nickname != "Carol" {
+		t.Fatalf("unexpected profile: %+v, %+v", res, profile)
+	}
+	res = requestJSON(t, http.MethodPut, token, "/api/user/password",
+		map[string]string{"old_password": "wrong", "new_password": "password2"}, nil)
+	if res.Code != errorcode.Code(errorcode.ErrInvalidCredentials) {
+		t.Fatalf("expect invalid credentials, got %+v", res)
+	}
+	res = requestJSON(t, http.MethodPut, token, "/api/user/password",
+		map[string]string{"old_password": "password1", "new_password": "password2"}, nil)
+	if res.Code != 0 {
+		t.Fatalf("change password: %+v", res)
+	}
+	loginWith(t, "carol", "password2")
+
+	// admin management
+	var page model.UserPage
+	if res = getJSON(t, admin, "/api/admin/users?page=1&page_size=10", &page); res.Code != 0 || page.Total < 4 {
+		t.Fatalf("list users: %+v, %+v", res, page)
+	}
+	userURL := fmt.Sprintf("/api/admin/user/%d", carol.Id)
+	if res = requestJSON(t, http.MethodPut, admin, userURL+"/disabled", map[string]bool{"disabled": true}, nil); res.Code != 0 {
+		t.Fatalf("disable user: %+v", res)
+	}
+	body, _ := json.Marshal(map[string]string{"username": "carol", "password": "password2"})
+	httpRes, err := http.Post(server.URL+"/login", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("disabled user logged in: %d", httpRes.StatusCode)
+	}
+	// tokens issued before are rejected too
+	if status := profileStatus(t, token); status != http.StatusUnauthorized {
+		t.Fatalf("disabled user kept access: %d", status)
+	}
+	requestJSON(t, http.MethodPut, admin, userURL+"/disabled", map[string]bool{"disabled": false}, nil)
+	if status := profileStatus(t, token); status != http.StatusOK {
+		t.Fatalf("enabled user rejected: %d", status)
+	}
+	if res = requestJSON(t, http.MethodPut, admin, userURL+"/password", map[string]string{"password": "password3"}, nil); res.Code != 0 {
+		t.Fatalf("reset password: %+v", res)
+	}
+	loginWith(t, "carol", "password3")
+	if res = requestJSON(t, http.MethodDelete, admin, "/api/admin/user/3", nil, nil); res.Code != errorcode.Code(errorcode.ErrParameterInvalid) {
+		t.Fatalf("admin should not delete itself, got %+v", res)
+	}
+	if res = requestJSON(t, http.MethodDelete, admin, userURL, nil, nil); res.Code != 0 {
+		t.Fatalf("delete user: %+v", res)
+	}
+	if res = requestJSON(t, http.MethodDelete, admin, userURL, nil, nil); res.Code != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("expect not found, got %+v", res)
+	}
+	if status := profileStatus(t, token); status != http.StatusUnauthorized {
+		t.Fatalf("deleted user kept access: %d", status)
+	}
+}
+
+// profileStatus http status of the profile of the token's user
+func profileStatus(t *testing.T, token string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/user/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+type tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func postTokens(t *testing.T, path, access string, v interface{}) (int, tokens) {
+	t.Helper()
+	body, _ := json.Marshal(v)
+	req, _ := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	if len(access) > 0 {
+		req.Header.Set("Authorization", "Bearer "+access)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out tokens
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	return res.StatusCode, out
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	status, first := postTokens(t, "/login", "", map[string]string{"username": "bob", "password": "secret"})
+	if status != http.StatusOK || len(first.RefreshToken) == 0 {
+		t.Fatalf("login: %d, %+v", status, first)
+	}
+	// an access token cannot refresh
+	if status, _ = postTokens(t, "/refresh_token", "", map[string]string{"refresh_token": first.Token}); status != http.StatusUnauthorized {
+		t.Fatalf("expect 401 refreshing with an access token, got %d", status)
+	}
+	status, second := postTokens(t, "/refresh_token", "", map[string]string{"refresh_token": first.RefreshToken})
+	if status != http.StatusOK || len(second.Token) == 0 || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh: %d, %+v", status, second)
+	}
+	// refresh tokens are single use
+	if status, _ = postTokens(t, "/refresh_token", "", map[string]string{"refresh_token": first.RefreshToken}); status != http.StatusUnauthorized {
+		t.Fatalf("expect 401 reusing a refresh token, got %d", status)
+	}
+	if res := getJSON(t, second.Token, "/api/user/profile", nil); res.Code != 0 {
+		t.Fatalf("refreshed token rejected: %+v", res)
+	}
+
+	if status, _ = postTokens(t, "/logout", second.Token, map[string]string{"refresh_token": second.RefreshToken}); status != http.StatusOK {
+		t.Fatalf("logout: %d", status)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/user/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+second.Token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect revoked access token, got %d", res.StatusCode)
+	}
+	if status, _ = postTokens(t, "/refresh_token", "", map[string]string{"refresh_token": second.RefreshToken}); status != http.StatusUnauthorized {
+		t.Fatalf("expect revoked refresh token, got %d", status)
+	}
+}
+
+func TestRefreshConcurrent(t *testing.T) {
+	status, login := postTokens(t, "/login", "", map[string]string{"username": "bob", "password": "secret"})
+	if status != http.StatusOK {
+		t.Fatalf("login: %d", status)
+	}
+	// only one of the refreshes racing with the same token gets new tokens
+	body, _ := json.Marshal(map[string]string{"refresh_token": login.RefreshToken})
+	statuses := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := http.Post(server.URL+"/refresh_token", "application/json", bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			res.Body.Close()
+			statuses[i] = res.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	var ok int
+	for _, status := range statuses {
+		if status == http.StatusOK {
+			ok++
+		} else if status != http.StatusUnauthorized {
+			t.Fatalf("unexpected status %d", status)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("expect a single refresh, got %v", statuses)
+	}
+}
+
+func createApiKey(t *testing.T, token string, scopes ...string) string {
+	t.Helper()
+	var out struct {
+		Key string `json:"key"`
+	}
+	res := requestJSON(t, http.MethodPost, token, "/api/api_keys",
+		map[string]interface{}{"name": "script", "scopes": scopes}, &out)
+	if res.Code != 0 || !strings.HasPrefix(out.Key, model.ApiKeyPrefix) {
+		t.Fatalf("create api key: %+v", res)
+	}
+	return out.Key
+}
+
+func TestApiKeys(t *testing.T) {
+	session := loginAs(t, "bob")
+	res := requestJSON(t, http.MethodPost, session, "/api/api_keys",
+		map[string]interface{}{"scopes": []string{model.ScopeAdmin}}, nil)
+	if res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect admin scope forbidden, got %+v", res)
+	}
+	key := createApiKey(t, session, model.ScopeAsk)
+
+	if res = getJSON(t, key, "/api/models", nil); res.Code != 0 {
+		t.Fatalf("api key rejected: %+v", res)
+	}
+	// the key has no chat scope and cannot manage the account
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + key}})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expect websocket upgrade forbidden, got %v", err)
+	}
+	if res = getJSON(t, key, "/api/api_keys", nil); res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect key management forbidden, got %+v", res)
+	}
+	if res = getJSON(t, key, "/api/user/profile", nil); res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect profile forbidden, got %+v", res)
+	}
+
+	var keys []model.ApiKey
+	if res = getJSON(t, session, "/api/api_keys", &keys); res.Code != 0 || len(keys) != 1 || keys[0].LastUsedTime == nil {
+		t.Fatalf("unexpected keys: %+v, %+v", res, keys)
+	}
+	if res = requestJSON(t, http.MethodDelete, loginAs(t, "alice"), fmt.Sprintf("/api/api_keys/%d", keys[0].Id), nil, nil); res.Code != errorcode.Code(errorcode.ErrNotFound) {
+		t.Fatalf("revoked the key of another user: %+v", res)
+	}
+	if res = requestJSON(t, http.MethodDelete, session, fmt.Sprintf("/api/api_keys/%d", keys[0].Id), nil, nil); res.Code != 0 {
+		t.Fatalf("revoke: %+v", res)
+	}
+	if res = getJSON(t, key, "/api/models", nil); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expect revoked key rejected, got %+v", res)
+	}
+
+	// admins need the admin scope to use the admin api with a key
+	admin := loginAs(t, "dave")
+	if res = getJSON(t, createApiKey(t, admin, model.ScopeAsk), "/api/admin/users", nil); res.Code != errorcode.Code(errorcode.ErrForbidden) {
+		t.Fatalf("expect admin api forbidden, got %+v", res)
+	}
+	if res = getJSON(t, createApiKey(t, admin, model.ScopeAdmin), "/api/admin/users", nil); res.Code != 0 {
+		t.Fatalf("admin key rejected: %+v", res)
+	}
+}
+
+func postCompletions(t *testing.T, key string, v interface{}) *http.Response {
+	t.Helper()
+	body, _ := json.Marshal(v)
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestChatCompletions(t *testing.T) {
+	key := createApiKey(t, login(t), model.ScopeAsk)
+	messages := []map[string]string{
+		{"role": "system", "content": "be brief"},
+		{"role": "user", "content": "hi"},
+	}
+	fake.Reply(bottest.Reply{Parts: []string{"hello", " there"}})
+	res := postCompletions(t, key, map[string]interface{}{"model": "gpt-3.5-turbo", "messages": messages})
+	var out completions.ChatCompletion
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(out.Choices) != 1 || out.Choices[0].Message.Content != "hello there" ||
+		out.Usage == nil || out.Usage.TotalTokens == 0 {
+		t.Fatalf("unexpected completion: %d, %+v", res.StatusCode, out)
+	}
+	reqs := fake.Requests()
+	first := reqs[len(reqs)-1]
+	if first.Content != "system: be brief\n\nuser: hi" || len(first.ConversationId) > 0 {
+		t.Fatalf("unexpected upstream request: %+v", first)
+	}
+
+	// the history answered before continues its conversation
+	messages = append(messages,
+		map[string]string{"role": "assistant", "content": "hello there"},
+		map[string]string{"role": "user", "content": "more"})
+	fake.Reply(bottest.Reply{Parts: []string{"one", " two"}})
+	res = postCompletions(t, key, map[string]interface{}{
+		"messages":       messages,
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	})
+	defer res.Body.Close()
+	var text string
+	var done, withUsage bool
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "data: ")
+		if len(line) == 0 {
+			continue
+		}
+		if line == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk completions.ChatCompletion
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", line, err)
+		}
+		if chunk.Usage != nil {
+			withUsage = true
+		}
+		for _, choice := range chunk.Choices {
+			text += choice.Delta.Content
+		}
+	}
+	if !done || !withUsage || text != "one two" {
+		t.Fatalf("unexpected stream: %q, done %v, usage %v", text, done, withUsage)
+	}
+	reqs = fake.Requests()
+	if last := reqs[len(reqs)-1]; last.Content != "more" || len(last.ConversationId) == 0 {
+		t.Fatalf("history not continued: %+v", last)
+	}
+
+	res = postCompletions(t, key, map[string]interface{}{"messages": messages[:3]})
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect 400 without a trailing user message, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,87 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package admin
+
+import (
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/servers/chatgpt/bot"
+)
+
+// AdminHandlerClient AdminHandler over http
+type AdminHandlerClient struct {
+	client   *helper.Client
+	rootPath string
+	ctx      context.Context
+}
+
+var _ AdminHandler = (*AdminHandlerClient)(nil)
+
+func NewAdminHandlerClient(baseURL string, opts ...helper.RequestOption) *AdminHandlerClient {
+	return &AdminHandlerClient{
+		client:   helper.NewClient(baseURL, opts...),
+		rootPath: "/api/admin",
+		ctx:      context.Background(),
+	}
+}
+
+// NewAdminHandlerDiscoveryClient client of the service registered as name
+func NewAdminHandlerDiscoveryClient(name string, opts ...helper.RequestOption) *AdminHandlerClient {
+	return NewAdminHandlerClient("http://"+name,
+		append([]helper.RequestOption{api.WithDiscovery(name)}, opts...)...)
+}
+
+func (cli *AdminHandlerClient) WithContext(ctx context.Context) *AdminHandlerClient {
+	out := *cli
+	out.ctx = ctx
+	return &out
+}
+
+func (cli *AdminHandlerClient) ListAccounts() ([]bot.AccountStatus, error) {
+	_req := helper.NewClientRequest("GET", cli.rootPath+"/accounts")
+	var _res []bot.AccountStatus
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *AdminHandlerClient) ListUsers(page int, pageSize int) (*model.UserPage, error) {
+	_req := helper.NewClientRequest("GET", cli.rootPath+"/users")
+	_req.RequestParam("page", page)
+	_req.RequestParam("page_size", pageSize)
+	var _res *model.UserPage
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *AdminHandlerClient) SetUserDisabled(userId int, req SetUserDisabledReq) error {
+	_req := helper.NewClientRequest("PUT", cli.rootPath+"/user/:id/disabled")
+	_req.PathVariable("id", userId)
+	_req.Body = req
+	return cli.client.Do(cli.ctx, _req, nil)
+}
+
+func (cli *AdminHandlerClient) ResetPassword(userId int, req ResetPasswordReq) error {
+	_req := helper.NewClientRequest("PUT", cli.rootPath+"/user/:id/password")
+	_req.PathVariable("id", userId)
+	_req.Body = req
+	return cli.client.Do(cli.ctx, _req, nil)
+}
+
+func (cli *AdminHandlerClient) DeleteUser(userId int) error {
+	_req := helper.NewClientRequest("DELETE", cli.rootPath+"/user/:id")
+	_req.PathVariable("id", userId)
+	return cli.client.Do(cli.ctx, _req, nil)
+}
+
+func (cli *AdminHandlerClient) CreateInviteCode(req CreateInviteCodeReq) (*model.InviteCode, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/invite_codes")
+	_req.Body = req
+	var _res *model.InviteCode
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/auth"
+	"github.com/LSDXXX/servers/chatgpt/bot"
+	"github.com/pkg/errors"
+)
+
+const defaultPageSize = 20
+
+// adminId id of the calling admin, the wrapper already checked the role
+func (imp *AdminHandlerImp) adminId() (int, error) {
+	info, ok := auth.GetIdentity(imp.ctx)
+	if !ok {
+		return 0, errorcode.ErrUnauthorized
+	}
+	return info.Id, nil
+}
+
+// checkOther admins may not lock themselves out
+func (imp *AdminHandlerImp) checkOther(userId int) error {
+	adminId, err := imp.adminId()
+	if err != nil {
+		return err
+	}
+	if adminId == userId {
+		return errors.Wrap(errorcode.ErrParameterInvalid, "cannot change the own account")
+	}
+	return nil
+}
+
+func (imp *AdminHandlerImp) ListAccounts() ([]bot.AccountStatus, error) {
+	var pool *bot.AccountPool
+	if err := container.Resolve(&pool); err != nil {
+		return nil, errors.Wrap(err, "resolve account pool")
+	}
+	return pool.Status(), nil
+}
+
+func (imp *AdminHandlerImp) ListUsers(page int, pageSize int) (*model.UserPage, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = defaultPageSize
+	}
+	out, err := imp.User.List(page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (imp *AdminHandlerImp) SetUserDisabled(userId int, req SetUserDisabledReq) error {
+	if err := imp.checkOther(userId); err != nil {
+		return err
+	}
+	return imp.User.SetDisabled(userId, req.Disabled)
+}
+
+func (imp *AdminHandlerImp) ResetPassword(userId int, req ResetPasswordReq) error {
+	if _, err := imp.User.Get(userId); err != nil {
+		return err
+	}
+	return imp.User.SetPassword(userId, req.Password)
+}
+
+func (imp *AdminHandlerImp) DeleteUser(userId int) error {
+	if err := imp.checkOther(userId); err != nil {
+		return err
+	}
+	return imp.User.Delete(userId)
+}
+
+func (imp *AdminHandlerImp) CreateInviteCode(req CreateInviteCodeReq) (*model.InviteCode, error) {
+	adminId, err := imp.adminId()
+	if err != nil {
+		return nil, err
+	}
+	code, err := imp.User.CreateInviteCode(adminId, req.MaxUses)
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
@@ -0,0 +1,302 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/libs/service"
+)
+
+func Register(mid ...gin.HandlerFunc) {
+	api.RegisterHttpRouter(NewAdminHandlerWrapper(mid))
+}
+
+type AdminHandlerWrapper struct {
+	handler     *AdminHandlerImp
+	rootPath    string
+	middleWares []gin.HandlerFunc
+}
+
+func NewAdminHandlerWrapper(mid []gin.HandlerFunc) *AdminHandlerWrapper {
+	out := &AdminHandlerWrapper{
+		rootPath:    "/api/admin",
+		handler:     NewAdminHandlerImp(),
+		middleWares: mid,
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (w *AdminHandlerWrapper) Use(e *gin.Engine) {
+	w.Group(&e.RouterGroup)
+}
+
+// Group register the routes in a group of g at the root path, the
+// middlewares of Register run for every route
+func (w *AdminHandlerWrapper) Group(g *gin.RouterGroup) {
+	r := g.Group(w.rootPath, w.middleWares...)
+
+	r.GET("/accounts", w.ListAccounts)
+	r.GET("/users", w.ListUsers)
+	r.PUT("/user/:id/disabled", w.SetUserDisabled)
+	r.PUT("/user/:id/password", w.ResetPassword)
+	r.DELETE("/user/:id", w.DeleteUser)
+	r.POST("/invite_codes", w.CreateInviteCode)
+}
+
+type AdminHandlerImp struct {
+	User *service.User `container:"type"`
+	ctx  context.Context
+}
+
+func NewAdminHandlerImp() *AdminHandlerImp {
+	out := &AdminHandlerImp{
+		ctx: context.Background(),
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (imp *AdminHandlerImp) WithContext(ctx context.Context) *AdminHandlerImp {
+	out := *imp
+
+	out.User = imp.User.WithContext(ctx)
+	out.ctx = ctx
+	return &out
+}
+
+func (w *AdminHandlerWrapper) ListAccounts(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequireRole(c, "admin"); err != nil {
+		fail(err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.ListAccounts()
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *AdminHandlerWrapper) ListUsers(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequireRole(c, "admin"); err != nil {
+		fail(err)
+		return
+	}
+
+	var page int
+	var pageSize int
+
+	_tmp = c.Query("page")
+
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &page)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "request param page"))
+			return
+		}
+	}
+
+	_tmp = c.Query("page_size")
+
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &pageSize)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "request param page_size"))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.ListUsers(page, pageSize)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *AdminHandlerWrapper) SetUserDisabled(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequireRole(c, "admin"); err != nil {
+		fail(err)
+		return
+	}
+
+	var userId int
+	var req SetUserDisabledReq
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &userId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.SetUserDisabled(userId, req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
+
+func (w *AdminHandlerWrapper) ResetPassword(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequireRole(c, "admin"); err != nil {
+		fail(err)
+		return
+	}
+
+	var userId int
+	var req ResetPasswordReq
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &userId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.ResetPassword(userId, req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
+
+func (w *AdminHandlerWrapper) DeleteUser(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequireRole(c, "admin"); err != nil {
+		fail(err)
+		return
+	}
+
+	var userId int
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &userId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.DeleteUser(userId)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
+
+func (w *AdminHandlerWrapper) CreateInviteCode(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequireRole(c, "admin"); err != nil {
+		fail(err)
+		return
+	}
+
+	var req CreateInviteCodeReq
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.CreateInviteCode(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
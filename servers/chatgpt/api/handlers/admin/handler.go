@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/libs/service"
+	"github.com/LSDXXX/servers/chatgpt/bot"
+)
+
+//@RequestMapping(/api/admin)
+//@RequireRole(admin)
+//go:generate handlergentool -f $GOFILE -op ./ -pkg $GOPACKAGE -openapi ../../openapi.yml
+type AdminHandler interface {
+	helper.InjectServices1[*service.User]
+
+	//@RequestMapping(/accounts, GET)
+	ListAccounts() ([]bot.AccountStatus, error)
+
+	//@RequestMapping(/users, GET)
+	//@RequestParam(page=@page, page_size=@pageSize)
+	ListUsers(page int, pageSize int) (*model.UserPage, error)
+
+	//@RequestMapping(/user/:id/disabled, PUT)
+	//@PathVariable(id=@userId)
+	//@BindBody(req)
+	SetUserDisabled(userId int, req SetUserDisabledReq) error
+
+	//@RequestMapping(/user/:id/password, PUT)
+	//@PathVariable(id=@userId)
+	//@BindBody(req)
+	ResetPassword(userId int, req ResetPasswordReq) error
+
+	//@RequestMapping(/user/:id, DELETE)
+	//@PathVariable(id=@userId)
+	DeleteUser(userId int) error
+
+	//@RequestMapping(/invite_codes, POST)
+	//@BindBody(req)
+	CreateInviteCode(req CreateInviteCodeReq) (*model.InviteCode, error)
+}
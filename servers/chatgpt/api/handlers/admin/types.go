@@ -0,0 +1,14 @@
+package admin
+
+type SetUserDisabledReq struct {
+	Disabled bool `json:"disabled"`
+}
+
+type ResetPasswordReq struct {
+	Password string `json:"password" binding:"required,min=8,max=128"`
+}
+
+type CreateInviteCodeReq struct {
+	// MaxUses sign ups allowed with the code, 1 when zero
+	MaxUses int `json:"max_uses" binding:"min=0"`
+}
@@ -0,0 +1,63 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package apikey
+
+import (
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+)
+
+// ApiKeyHandlerClient ApiKeyHandler over http
+type ApiKeyHandlerClient struct {
+	client   *helper.Client
+	rootPath string
+	ctx      context.Context
+}
+
+var _ ApiKeyHandler = (*ApiKeyHandlerClient)(nil)
+
+func NewApiKeyHandlerClient(baseURL string, opts ...helper.RequestOption) *ApiKeyHandlerClient {
+	return &ApiKeyHandlerClient{
+		client:   helper.NewClient(baseURL, opts...),
+		rootPath: "/api",
+		ctx:      context.Background(),
+	}
+}
+
+// NewApiKeyHandlerDiscoveryClient client of the service registered as name
+func NewApiKeyHandlerDiscoveryClient(name string, opts ...helper.RequestOption) *ApiKeyHandlerClient {
+	return NewApiKeyHandlerClient("http://"+name,
+		append([]helper.RequestOption{api.WithDiscovery(name)}, opts...)...)
+}
+
+func (cli *ApiKeyHandlerClient) WithContext(ctx context.Context) *ApiKeyHandlerClient {
+	out := *cli
+	out.ctx = ctx
+	return &out
+}
+
+func (cli *ApiKeyHandlerClient) ListApiKeys() ([]model.ApiKey, error) {
+	_req := helper.NewClientRequest("GET", cli.rootPath+"/api_keys")
+	var _res []model.ApiKey
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ApiKeyHandlerClient) CreateApiKey(req CreateApiKeyReq) (*CreateApiKeyResp, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/api_keys")
+	_req.Body = req
+	var _res *CreateApiKeyResp
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ApiKeyHandlerClient) RevokeApiKey(keyId int) error {
+	_req := helper.NewClientRequest("DELETE", cli.rootPath+"/api_keys/:id")
+	_req.PathVariable("id", keyId)
+	return cli.client.Do(cli.ctx, _req, nil)
+}
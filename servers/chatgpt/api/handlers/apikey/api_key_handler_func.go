@@ -0,0 +1,49 @@
+package apikey
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/auth"
+	"github.com/pkg/errors"
+)
+
+func (imp *ApiKeyHandlerImp) identity() (auth.IdentityInfo, error) {
+	info, ok := auth.GetIdentity(imp.ctx)
+	if !ok {
+		return auth.IdentityInfo{}, errorcode.ErrUnauthorized
+	}
+	return info, nil
+}
+
+func (imp *ApiKeyHandlerImp) ListApiKeys() ([]model.ApiKey, error) {
+	info, err := imp.identity()
+	if err != nil {
+		return nil, err
+	}
+	return imp.ApiKey.List(info.Id)
+}
+
+func (imp *ApiKeyHandlerImp) CreateApiKey(req CreateApiKeyReq) (*CreateApiKeyResp, error) {
+	info, err := imp.identity()
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range req.Scopes {
+		if scope == model.ScopeAdmin && !info.HasRole(model.RoleAdmin) {
+			return nil, errors.Wrap(errorcode.ErrForbidden, "admin scope requires the admin role")
+		}
+	}
+	item, key, err := imp.ApiKey.Create(info.Id, req.Name, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateApiKeyResp{ApiKey: item, Key: key}, nil
+}
+
+func (imp *ApiKeyHandlerImp) RevokeApiKey(keyId int) error {
+	info, err := imp.identity()
+	if err != nil {
+		return err
+	}
+	return imp.ApiKey.Revoke(info.Id, keyId)
+}
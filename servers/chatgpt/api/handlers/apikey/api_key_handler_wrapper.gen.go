@@ -0,0 +1,155 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package apikey
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/libs/service"
+)
+
+func Register(mid ...gin.HandlerFunc) {
+	api.RegisterHttpRouter(NewApiKeyHandlerWrapper(mid))
+}
+
+type ApiKeyHandlerWrapper struct {
+	handler     *ApiKeyHandlerImp
+	rootPath    string
+	middleWares []gin.HandlerFunc
+}
+
+func NewApiKeyHandlerWrapper(mid []gin.HandlerFunc) *ApiKeyHandlerWrapper {
+	out := &ApiKeyHandlerWrapper{
+		rootPath:    "/api",
+		handler:     NewApiKeyHandlerImp(),
+		middleWares: mid,
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (w *ApiKeyHandlerWrapper) Use(e *gin.Engine) {
+	w.Group(&e.RouterGroup)
+}
+
+// Group register the routes in a group of g at the root path, the
+// middlewares of Register run for every route
+func (w *ApiKeyHandlerWrapper) Group(g *gin.RouterGroup) {
+	r := g.Group(w.rootPath, w.middleWares...)
+
+	r.GET("/api_keys", w.ListApiKeys)
+	r.POST("/api_keys", w.CreateApiKey)
+	r.DELETE("/api_keys/:id", w.RevokeApiKey)
+}
+
+type ApiKeyHandlerImp struct {
+	ApiKey *service.ApiKey `container:"type"`
+	ctx    context.Context
+}
+
+func NewApiKeyHandlerImp() *ApiKeyHandlerImp {
+	out := &ApiKeyHandlerImp{
+		ctx: context.Background(),
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (imp *ApiKeyHandlerImp) WithContext(ctx context.Context) *ApiKeyHandlerImp {
+	out := *imp
+
+	out.ApiKey = imp.ApiKey.WithContext(ctx)
+	out.ctx = ctx
+	return &out
+}
+
+func (w *ApiKeyHandlerWrapper) ListApiKeys(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.ListApiKeys()
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *ApiKeyHandlerWrapper) CreateApiKey(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	var req CreateApiKeyReq
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.CreateApiKey(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *ApiKeyHandlerWrapper) RevokeApiKey(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	var keyId int
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &keyId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.RevokeApiKey(keyId)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
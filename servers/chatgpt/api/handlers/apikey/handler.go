@@ -0,0 +1,24 @@
+package apikey
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/libs/service"
+)
+
+//@RequestMapping(/api)
+//go:generate handlergentool -f $GOFILE -op ./ -pkg $GOPACKAGE -openapi ../../openapi.yml
+type ApiKeyHandler interface {
+	helper.InjectServices1[*service.ApiKey]
+
+	//@RequestMapping(/api_keys, GET)
+	ListApiKeys() ([]model.ApiKey, error)
+
+	//@RequestMapping(/api_keys, POST)
+	//@BindBody(req)
+	CreateApiKey(req CreateApiKeyReq) (*CreateApiKeyResp, error)
+
+	//@RequestMapping(/api_keys/:id, DELETE)
+	//@PathVariable(id=@keyId)
+	RevokeApiKey(keyId int) error
+}
@@ -0,0 +1,14 @@
+package apikey
+
+import "github.com/LSDXXX/libs/model"
+
+type CreateApiKeyReq struct {
+	Name   string   `json:"name" binding:"max=64"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+}
+
+// CreateApiKeyResp the key is only shown once
+type CreateApiKeyResp struct {
+	model.ApiKey
+	Key string `json:"key"`
+}
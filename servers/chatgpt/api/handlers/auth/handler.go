@@ -2,128 +2,437 @@ package auth
 
 import (
 	"context"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/LSDXXX/libs/constant"
 	"github.com/LSDXXX/libs/model"
 	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
 	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/pkg/servercontext"
 	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/pkg/wsmanager"
 	"github.com/LSDXXX/libs/repo"
-	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/LSDXXX/libs/service"
+	"github.com/LSDXXX/servers/chatgpt/config"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 	"github.com/spf13/cast"
 )
 
+const claimsKey = "JWT_PAYLOAD"
+
 type AuthHandler struct {
-	jwtMiddleware *jwt.GinJWTMiddleware
-	userMapper    repo.UserMapper `container:"type"`
+	conf     config.JWTConfig
+	admins   []string
+	keys     *keySet
+	users    *service.User      `container:"type"`
+	apiKeys  *service.ApiKey    `container:"type"`
+	denylist repo.TokenDenylist `container:"type"`
 }
 
 func NewAuthHandler() (*AuthHandler, error) {
-	out := AuthHandler{}
+	out := AuthHandler{
+		conf:   config.ServerConfig().JWT,
+		admins: config.ServerConfig().Logic.Admins,
+	}
 	util.PanicWhenError(container.Fill(&out))
-	auth, err := newJWTAuth(constant.JWTIdentityKey, out.userMapper)
+	keys, err := newKeySet(out.conf)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "load jwt keys")
+	}
+	out.keys = keys
+	if out.conf.Timeout <= 0 {
+		out.conf.Timeout = time.Hour
+	}
+	if out.conf.RefreshTimeout <= 0 {
+		out.conf.RefreshTimeout = 7 * 24 * time.Hour
 	}
-	out.jwtMiddleware = auth
 	return &out, nil
 }
 
+// Middleware reject requests without a valid access token or api key,
+// the identity is available through GetIdentity afterwards
 func (a *AuthHandler) Middleware() gin.HandlerFunc {
-	return a.jwtMiddleware.MiddlewareFunc()
+	return func(c *gin.Context) {
+		if key := bearerToken(c); strings.HasPrefix(key, model.ApiKeyPrefix) {
+			info, err := a.verifyApiKey(c, key)
+			if err != nil {
+				a.unauthorized(c, err)
+				return
+			}
+			c.Set(constant.JWTIdentityKey, info)
+			return
+		}
+		claims, err := a.verify(tokenAccess, a.lookupToken(c))
+		if err == nil {
+			_, err = a.activeUser(c, identityFromClaims(claims).Id)
+		}
+		if err != nil {
+			a.unauthorized(c, err)
+			return
+		}
+		c.Set(claimsKey, claims)
+		c.Set(constant.JWTIdentityKey, identityFromClaims(claims))
+	}
 }
 
 func (a *AuthHandler) Use(e *gin.Engine) {
-	e.POST("/login", a.jwtMiddleware.LoginHandler)
-	e.POST("/logout", a.jwtMiddleware.LogoutHandler)
+	e.POST("/login", a.Login)
+	e.POST("/logout", a.Logout)
+	e.POST("/refresh_token", a.RefreshToken)
 }
 
-func IdentityHandler(c *gin.Context, identityKey string) IdentityInfo {
-	claims := jwt.ExtractClaims(c)
-	info := claims[identityKey].(map[string]interface{})
-	return IdentityInfo{
-		Id:       cast.ToInt(info["id"]),
-		UserName: cast.ToString(info["user_name"]),
-		WSKey:    cast.ToString(info["ws_key"]),
-	}
-}
-
-func newJWTAuth(identityKey string, mapper repo.UserMapper) (*jwt.GinJWTMiddleware, error) {
-	middle, err := jwt.New(&jwt.GinJWTMiddleware{
-		Realm:       "login",
-		Key:         []byte("secret key"),
-		Timeout:     time.Hour,
-		MaxRefresh:  time.Hour,
-		IdentityKey: identityKey,
-		SendCookie:  true,
-		PayloadFunc: func(data interface{}) jwt.MapClaims {
-			log.WithContext(context.Background()).Debugf("payload : %+v", data)
-			if v, ok := data.(model.User); ok {
-				return jwt.MapClaims{
-					identityKey: map[string]interface{}{
-						"id":        v.Id,
-						"ws_key":    uuid.NewString(),
-						"user_name": v.UserName,
-					},
-				}
-			}
-			return jwt.MapClaims{}
-		},
-		IdentityHandler: func(c *gin.Context) interface{} {
-			return IdentityHandler(c, identityKey)
-		},
-		Authenticator: func(c *gin.Context) (interface{}, error) {
-			var loginVals Login
-			if err := c.ShouldBind(&loginVals); err != nil {
-				log.WithContext(c).Errorf("bind login val error: %s", err.Error())
-				return "", jwt.ErrMissingLoginValues
-			}
-			userID := loginVals.Username
-			password := loginVals.Password
+// Login exchange user name and password for an access and a refresh token
+func (a *AuthHandler) Login(c *gin.Context) {
+	var req Login
+	if err := c.ShouldBind(&req); err != nil {
+		log.WithContext(c).Errorf("bind login val error: %s", err.Error())
+		a.unauthorized(c, errors.New("missing Username or Password"))
+		return
+	}
+	user, err := a.users.WithContext(c).Authenticate(req.Username, req.Password)
+	if err != nil {
+		if !errors.Is(err, errorcode.ErrInvalidCredentials) && !errors.Is(err, errorcode.ErrUserDisabled) {
+			log.WithContext(c).Errorf("authenticate %s: %s", req.Username, err.Error())
+		}
+		a.unauthorized(c, errors.New("incorrect Username or Password"))
+		return
+	}
+	a.respondTokens(c, a.identityClaims(user))
+}
 
-			info, err := mapper.GetByUserName(userID)
-			if err != nil {
-				return nil, jwt.ErrFailedAuthentication
-			}
-			if info.Password != password {
-				return nil, jwt.ErrFailedAuthentication
-			}
+// RefreshToken exchange a refresh token for new tokens, the refresh token
+// can only be used once. Role and permissions are read again so changes
+// take effect on the next refresh
+func (a *AuthHandler) RefreshToken(c *gin.Context) {
+	claims, err := a.verify(tokenRefresh, a.lookupRefreshToken(c))
+	if err != nil {
+		a.unauthorized(c, err)
+		return
+	}
+	user, err := a.activeUser(c, identityFromClaims(claims).Id)
+	if err != nil {
+		a.unauthorized(c, err)
+		return
+	}
+	revoked, err := a.revoke(claims)
+	if err != nil {
+		log.WithContext(c).Errorf("revoke refresh token: %s", err.Error())
+		a.unauthorized(c, errors.New("cannot refresh token"))
+		return
+	}
+	if revoked {
+		// used by a concurrent refresh since it was verified
+		a.unauthorized(c, errors.New("token is revoked"))
+		return
+	}
+	a.respondTokens(c, a.identityClaims(user))
+}
 
-			return info, nil
-		},
-		Authorizator: func(data interface{}, c *gin.Context) bool {
-			log.WithContext(context.Background()).Debugf("authorizator : %+v", data)
-			if _, ok := data.(IdentityInfo); ok {
-				return true
-			}
-			// if v, ok := data.(*User); ok && v.UserName == "admin" {
-			// 	return true
-			// }
+// Logout revoke the access token and the refresh token of the request
+func (a *AuthHandler) Logout(c *gin.Context) {
+	for typ, token := range map[string]string{
+		tokenAccess:  a.lookupToken(c),
+		tokenRefresh: a.lookupRefreshToken(c),
+	} {
+		claims, err := a.verify(typ, token)
+		if err != nil {
+			continue
+		}
+		if _, err = a.revoke(claims); err != nil {
+			log.WithContext(c).Errorf("revoke %s token: %s", typ, err.Error())
+		}
+	}
+	if a.conf.Cookie.Enabled {
+		a.setCookie(c, a.conf.Cookie.Name, "", -1)
+		a.setCookie(c, a.refreshCookieName(), "", -1)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+	})
+}
 
-			return false
-		},
-		Unauthorized: func(c *gin.Context, code int, message string) {
-			c.JSON(code, gin.H{
-				"code":    code,
-				"message": message,
-			})
-		},
-		TokenLookup:   "header: Authorization, query: token, cookie: jwt",
-		TokenHeadName: "Bearer",
-		TimeFunc:      time.Now,
+func (a *AuthHandler) respondTokens(c *gin.Context, claims jwt.MapClaims) {
+	token, expire, err := a.keys.issue(tokenAccess, claims, a.conf.Timeout)
+	if err != nil {
+		log.WithContext(c).Errorf("issue access token: %s", err.Error())
+		a.unauthorized(c, errors.New("failed to create JWT Token"))
+		return
+	}
+	refresh, refreshExpire, err := a.keys.issue(tokenRefresh, claims, a.conf.RefreshTimeout)
+	if err != nil {
+		log.WithContext(c).Errorf("issue refresh token: %s", err.Error())
+		a.unauthorized(c, errors.New("failed to create JWT Token"))
+		return
+	}
+	if a.conf.Cookie.Enabled {
+		a.setCookie(c, a.conf.Cookie.Name, token, int(a.conf.Timeout.Seconds()))
+		a.setCookie(c, a.refreshCookieName(), refresh, int(a.conf.RefreshTimeout.Seconds()))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":           http.StatusOK,
+		"token":          token,
+		"expire":         expire.Format(time.RFC3339),
+		"refresh_token":  refresh,
+		"refresh_expire": refreshExpire.Format(time.RFC3339),
 	})
+}
 
+// verify parse the token and check it was not revoked
+func (a *AuthHandler) verify(typ, token string) (jwt.MapClaims, error) {
+	if len(token) == 0 {
+		return nil, errors.New("token is empty")
+	}
+	claims, err := a.keys.parse(typ, token)
 	if err != nil {
-		return nil, errors.Wrap(err, "create jwt middleware")
+		return nil, err
+	}
+	revoked, err := a.denylist.IsRevoked(claims["jti"].(string))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.New("token is revoked")
 	}
+	return claims, nil
+}
 
-	err = middle.MiddlewareInit()
+// verifyApiKey identity of an api key, its permissions are the ones of
+// the owner's role allowed by the scopes of the key
+func (a *AuthHandler) verifyApiKey(c *gin.Context, key string) (IdentityInfo, error) {
+	item, user, err := a.apiKeys.WithContext(c).Authenticate(key)
 	if err != nil {
-		return nil, errors.Wrap(err, "init jwt middleware")
+		if !errors.Is(err, errorcode.ErrInvalidCredentials) && !errors.Is(err, errorcode.ErrUserDisabled) {
+			log.WithContext(c).Errorf("authenticate api key: %s", err.Error())
+		}
+		return IdentityInfo{}, errors.New("invalid api key")
+	}
+	role := a.roleOf(user)
+	if role == model.RoleAdmin && !item.HasScope(model.ScopeAdmin) {
+		role = model.RoleUser
+	}
+	owner := IdentityInfo{Permissions: model.RolePermissions[role]}
+	var perms []string
+	for _, scope := range item.Scopes {
+		for _, perm := range model.ScopePermissions[scope] {
+			if owner.HasPermission(perm) {
+				perms = append(perms, perm)
+			}
+		}
+	}
+	return IdentityInfo{
+		Id:          user.Id,
+		WSKey:       uuid.NewString(),
+		UserName:    user.UserName,
+		Role:        role,
+		Permissions: perms,
+		ApiKeyId:    item.Id,
+	}, nil
+}
+
+// activeUser the user of a token, a disabled or deleted user loses access
+// before the token expires
+func (a *AuthHandler) activeUser(c *gin.Context, userId int) (model.User, error) {
+	user, err := a.users.WithContext(c).Get(userId)
+	if err == nil && user.Disabled {
+		err = errorcode.ErrUserDisabled
+	}
+	return user, err
+}
+
+func (a *AuthHandler) revoke(claims jwt.MapClaims) (bool, error) {
+	return a.denylist.Revoke(claims["jti"].(string), remaining(claims))
+}
+
+// lookupToken access token from the Authorization header, the websocket
+// subprotocol of an upgrade request, the token query or the cookie
+func (a *AuthHandler) lookupToken(c *gin.Context) string {
+	if token := bearerToken(c); len(token) > 0 {
+		return token
+	}
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		if token := wsmanager.SubprotocolToken(c.Request); len(token) > 0 {
+			return token
+		}
+	}
+	if token := c.Query("token"); len(token) > 0 {
+		return token
+	}
+	token, _ := c.Cookie(a.conf.Cookie.Name)
+	return token
+}
+
+// bearerToken token of the Authorization header, api keys are only
+// accepted there
+func bearerToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); len(header) > 0 {
+		if parts := strings.SplitN(header, " ", 2); len(parts) == 2 && parts[0] == "Bearer" {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// lookupRefreshToken refresh token from the json body or the cookie
+func (a *AuthHandler) lookupRefreshToken(c *gin.Context) string {
+	var req RefreshTokenReq
+	if err := c.ShouldBindJSON(&req); err == nil && len(req.RefreshToken) > 0 {
+		return req.RefreshToken
+	}
+	token, _ := c.Cookie(a.refreshCookieName())
+	return token
+}
+
+func (a *AuthHandler) refreshCookieName() string {
+	return a.conf.Cookie.Name + "_refresh"
+}
+
+func (a *AuthHandler) setCookie(c *gin.Context, name, value string, maxAge int) {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(a.conf.Cookie.SameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   a.conf.Cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   a.conf.Cookie.Secure,
+		HttpOnly: a.conf.Cookie.HTTPOnly,
+		SameSite: sameSite,
+	})
+}
+
+func (a *AuthHandler) unauthorized(c *gin.Context, err error) {
+	c.Header("WWW-Authenticate", `JWT realm="login"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"code":    http.StatusUnauthorized,
+		"message": err.Error(),
+	})
+}
+
+// roleOf users listed in logic.admins are admins whatever their role
+func (a *AuthHandler) roleOf(user model.User) string {
+	for _, name := range a.admins {
+		if name == user.UserName {
+			return model.RoleAdmin
+		}
+	}
+	if len(user.Role) == 0 {
+		return model.RoleUser
+	}
+	return user.Role
+}
+
+func (a *AuthHandler) identityClaims(user model.User) jwt.MapClaims {
+	role := a.roleOf(user)
+	return jwt.MapClaims{
+		constant.JWTIdentityKey: map[string]interface{}{
+			"id":          user.Id,
+			"ws_key":      uuid.NewString(),
+			"user_name":   user.UserName,
+			"role":        role,
+			"permissions": model.RolePermissions[role],
+		},
+	}
+}
+
+func identityFromClaims(claims jwt.MapClaims) IdentityInfo {
+	info, _ := claims[constant.JWTIdentityKey].(map[string]interface{})
+	return IdentityInfo{
+		Id:          cast.ToInt(info["id"]),
+		UserName:    cast.ToString(info["user_name"]),
+		WSKey:       cast.ToString(info["ws_key"]),
+		Role:        cast.ToString(info["role"]),
+		Permissions: cast.ToStringSlice(info["permissions"]),
+	}
+}
+
+// RequireRole middleware for hand written routers, rejects callers without
+// any of the roles. Must run after Middleware
+//
+//	@param roles
+//	@return gin.HandlerFunc
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abortUnless(c, helper.RequireRole(c, roles...))
+	}
+}
+
+// RequirePermission middleware for hand written routers, rejects callers
+// without any of the permissions. Must run after Middleware
+//
+//	@param perms
+//	@return gin.HandlerFunc
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abortUnless(c, helper.RequirePermission(c, perms...))
+	}
+}
+
+// RequireSession middleware rejecting requests authenticated with an api
+// key, for endpoints managing the account itself. Must run after Middleware
+//
+//	@return gin.HandlerFunc
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var err error
+		if p, ok := helper.GetPrincipal(c); !ok {
+			err = errorcode.ErrUnauthorized
+		} else if info, _ := p.(IdentityInfo); info.ApiKeyId != 0 {
+			err = errors.Wrap(errorcode.ErrForbidden, "not allowed with an api key")
+		}
+		abortUnless(c, err)
+	}
+}
+
+func abortUnless(c *gin.Context, err error) {
+	if err == nil {
+		return
+	}
+	status := http.StatusForbidden
+	if errors.Is(err, errorcode.ErrUnauthorized) {
+		status = http.StatusUnauthorized
+	}
+	c.AbortWithStatusJSON(status, model.NewResponse(model.WithError(err)))
+}
+
+// IdentityHandler identity set by the middleware
+//
+//	@param c
+//	@param identityKey
+//	@return IdentityInfo
+func IdentityHandler(c *gin.Context, identityKey string) IdentityInfo {
+	v, _ := c.Get(identityKey)
+	info, _ := v.(IdentityInfo)
+	return info
+}
+
+// GetIdentity identity of the logged in user, set by the jwt middleware
+//
+//	@param ctx request context carrying the gin context
+//	@return IdentityInfo
+//	@return bool false if not logged in
+func GetIdentity(ctx context.Context) (IdentityInfo, bool) {
+	c := servercontext.GetGinContext(ctx)
+	if c == nil {
+		return IdentityInfo{}, false
+	}
+	v, ok := c.Get(constant.JWTIdentityKey)
+	if !ok {
+		return IdentityInfo{}, false
 	}
-	return middle, nil
+	info, ok := v.(IdentityInfo)
+	return info, ok
 }
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/servers/chatgpt/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	tokenAccess  = "access"
+	tokenRefresh = "refresh"
+)
+
+// verifyKey key verifying the tokens of one kid, only with its algorithm
+type verifyKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// keySet signing key and verification keys by kid
+type keySet struct {
+	method  jwt.SigningMethod
+	signKid string
+	signKey interface{}
+	verify  map[string]verifyKey
+}
+
+func newKeySet(conf config.JWTConfig) (*keySet, error) {
+	out := &keySet{verify: make(map[string]verifyKey)}
+	switch conf.Algorithm {
+	case config.JWTHS256, "":
+		out.method = jwt.SigningMethodHS256
+	case config.JWTRS256:
+		out.method = jwt.SigningMethodRS256
+	case config.JWTEdDSA:
+		out.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.Errorf("unsupported jwt algorithm: %s", conf.Algorithm)
+	}
+	if len(conf.Keys) == 0 {
+		if out.method != jwt.SigningMethodHS256 {
+			return nil, errors.Errorf("jwt keys are required for %s", conf.Algorithm)
+		}
+		// tokens do not survive a restart, fine for development only
+		log.WithContext(context.Background()).Warnf("no jwt key configured, using a random secret")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, errors.Wrap(err, "generate jwt secret")
+		}
+		out.signKey = secret
+		out.verify[""] = verifyKey{method: out.method, key: secret}
+		return out, nil
+	}
+	for i, key := range conf.Keys {
+		if _, ok := out.verify[key.Id]; ok {
+			return nil, errors.Errorf("duplicate jwt key id: %s", key.Id)
+		}
+		sign, verify, err := loadKey(out.method, key, i == 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "jwt key %s", key.Id)
+		}
+		if i == 0 {
+			out.signKid, out.signKey = key.Id, sign
+		}
+		out.verify[key.Id] = verifyKey{method: out.method, key: verify}
+	}
+	return out, nil
+}
+
+// loadKey signing and verification key, the signing key only when sign
+func loadKey(method jwt.SigningMethod, key config.JWTKeyConfig, sign bool) (interface{}, interface{}, error) {
+	if method == jwt.SigningMethodHS256 {
+		if len(key.Secret) == 0 {
+			return nil, nil, errors.New("secret is required")
+		}
+		return []byte(key.Secret), []byte(key.Secret), nil
+	}
+	pub, err := ioutil.ReadFile(key.PublicKeyFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read public key")
+	}
+	var priv []byte
+	if sign {
+		if priv, err = ioutil.ReadFile(key.PrivateKeyFile); err != nil {
+			return nil, nil, errors.Wrap(err, "read private key")
+		}
+	}
+	if method == jwt.SigningMethodRS256 {
+		verify, err := jwt.ParseRSAPublicKeyFromPEM(pub)
+		if err != nil || !sign {
+			return nil, verify, errors.Wrap(err, "parse public key")
+		}
+		signKey, err := jwt.ParseRSAPrivateKeyFromPEM(priv)
+		return signKey, verify, errors.Wrap(err, "parse private key")
+	}
+	verify, err := jwt.ParseEdPublicKeyFromPEM(pub)
+	if err != nil || !sign {
+		return nil, verify, errors.Wrap(err, "parse public key")
+	}
+	signKey, err := jwt.ParseEdPrivateKeyFromPEM(priv)
+	return signKey, verify, errors.Wrap(err, "parse private key")
+}
+
+// issue sign a token of typ carrying the claims, returns the token and
+// its expiry
+func (k *keySet) issue(typ string, claims jwt.MapClaims, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expire := now.Add(ttl)
+	out := jwt.MapClaims{}
+	for key, v := range claims {
+		out[key] = v
+	}
+	out["typ"] = typ
+	out["jti"] = uuid.NewString()
+	out["iat"] = now.Unix()
+	out["exp"] = expire.Unix()
+	token := jwt.NewWithClaims(k.method, out)
+	if len(k.signKid) > 0 {
+		token.Header["kid"] = k.signKid
+	}
+	signed, err := token.SignedString(k.signKey)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "sign token")
+	}
+	return signed, expire, nil
+}
+
+// lookup verification key named by the kid of the token, a token signed
+// with another algorithm than the key's is rejected, so a public key is
+// never taken as an hmac secret
+func (k *keySet) lookup(t *jwt.Token) (interface{}, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok && t.Header["kid"] != nil {
+		return nil, errors.New("invalid key id")
+	}
+	key, ok := k.verify[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown key id: %s", kid)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, errors.Errorf("unexpected signing algorithm: %s", t.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// parse verify a token of typ with the key named by its kid
+func (k *keySet) parse(typ, token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, k.lookup, jwt.WithValidMethods([]string{k.method.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims["typ"] != typ {
+		return nil, errors.Errorf("not an %s token", typ)
+	}
+	if _, ok := claims["jti"].(string); !ok {
+		return nil, errors.New("token without id")
+	}
+	return claims, nil
+}
+
+// remaining lifetime of the token
+func remaining(claims jwt.MapClaims) time.Duration {
+	exp, _ := claims["exp"].(float64)
+	return time.Until(time.Unix(int64(exp), 0))
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LSDXXX/servers/chatgpt/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writeKeyPair write a pem key pair of the algorithm, returns the key config
+func writeKeyPair(t *testing.T, alg, id string) config.JWTKeyConfig {
+	t.Helper()
+	var priv, pub interface{}
+	switch alg {
+	case config.JWTRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, pub = key, &key.PublicKey
+	case config.JWTEdDSA:
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, pub = privKey, pubKey
+	}
+	privDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	out := config.JWTKeyConfig{
+		Id:             id,
+		PrivateKeyFile: filepath.Join(dir, "private.pem"),
+		PublicKeyFile:  filepath.Join(dir, "public.pem"),
+	}
+	_ = os.WriteFile(out.PrivateKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer}), 0600)
+	_ = os.WriteFile(out.PublicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}), 0600)
+	return out
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys := map[string][]config.JWTKeyConfig{
+		config.JWTHS256: {{Id: "old", Secret: "old secret"}, {Id: "new", Secret: "new secret"}},
+		config.JWTRS256: {writeKeyPair(t, config.JWTRS256, "old"), writeKeyPair(t, config.JWTRS256, "new")},
+		config.JWTEdDSA: {writeKeyPair(t, config.JWTEdDSA, "old"), writeKeyPair(t, config.JWTEdDSA, "new")},
+	}
+	for alg, pair := range keys {
+		t.Run(alg, func(t *testing.T) {
+			old, err := newKeySet(config.JWTConfig{Algorithm: alg, Keys: pair[:1]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, _, err := old.issue(tokenAccess, jwt.MapClaims{"sub": "alice"}, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the new key signs, the old one still verifies
+			rotated, err := newKeySet(config.JWTConfig{Algorithm: alg, Keys: []config.JWTKeyConfig{pair[1], pair[0]}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := rotated.parse(tokenAccess, token)
+			if err != nil || claims["sub"] != "alice" {
+				t.Fatalf("old token rejected after rotation: %v, %v", claims, err)
+			}
+			if _, err = rotated.parse(tokenRefresh, token); err == nil {
+				t.Fatal("access token accepted as refresh token")
+			}
+			fresh, _, _ := rotated.issue(tokenAccess, jwt.MapClaims{}, time.Minute)
+			if _, err = old.parse(tokenAccess, fresh); err == nil {
+				t.Fatal("token of an unknown key accepted")
+			}
+
+			// dropping the old key logs its tokens out
+			dropped, err := newKeySet(config.JWTConfig{Algorithm: alg, Keys: pair[1:]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = dropped.parse(tokenAccess, token); err == nil {
+				t.Fatal("token of a dropped key accepted")
+			}
+		})
+	}
+
+	hs, _ := newKeySet(config.JWTConfig{Algorithm: config.JWTHS256, Keys: keys[config.JWTHS256][:1]})
+	expired, _, _ := hs.issue(tokenAccess, jwt.MapClaims{}, -time.Minute)
+	if _, err := hs.parse(tokenAccess, expired); err == nil {
+		t.Fatal("expired token accepted")
+	}
+}
+
+func TestKeySetRejects(t *testing.T) {
+	pair := writeKeyPair(t, config.JWTRS256, "rs")
+	rs, err := newKeySet(config.JWTConfig{Algorithm: config.JWTRS256, Keys: []config.JWTKeyConfig{pair}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs, err := newKeySet(config.JWTConfig{Algorithm: config.JWTHS256,
+		Keys: []config.JWTKeyConfig{{Id: "hs", Secret: "secret"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := mustRead(t, pair.PublicKeyFile)
+	priv, err := jwt.ParseRSAPrivateKeyFromPEM(mustRead(t, pair.PrivateKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid interface{}, key interface{}) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, jwt.MapClaims{
+			"typ": tokenAccess,
+			"jti": "id",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	cases := []struct {
+		name  string
+		keys  *keySet
+		token string
+	}{
+		// the rsa public key is known to everyone, it must not work as a secret
+		{"public key as hmac secret", rs, sign(jwt.SigningMethodHS256, "rs", pub)},
+		{"none algorithm", rs, sign(jwt.SigningMethodNone, "rs", jwt.UnsafeAllowNoneSignatureType)},
+		{"rsa token for hmac key", hs, sign(jwt.SigningMethodRS256, "hs", priv)},
+		{"unknown kid", rs, sign(jwt.SigningMethodRS256, "other", priv)},
+		{"missing kid", rs, sign(jwt.SigningMethodRS256, nil, priv)},
+		{"kid not a string", hs, sign(jwt.SigningMethodHS256, 1, []byte("secret"))},
+	}
+	for _, c := range cases {
+		if _, err := c.keys.parse(tokenAccess, c.token); err == nil {
+			t.Fatalf("%s: token accepted", c.name)
+		}
+	}
+	if _, err := rs.parse(tokenAccess, sign(jwt.SigningMethodRS256, "rs", priv)); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+}
+
+func mustRead(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
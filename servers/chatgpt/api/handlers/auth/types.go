@@ -13,7 +13,30 @@ type Login struct {
 }
 
 type IdentityInfo struct {
-	Id       int
-	WSKey    string
-	UserName string
+	Id          int
+	WSKey       string
+	UserName    string
+	Role        string
+	Permissions []string
+	// ApiKeyId key the request was authenticated with, 0 for a login session
+	ApiKeyId int
+}
+
+// HasRole implements helper.Principal
+func (i IdentityInfo) HasRole(role string) bool {
+	return i.Role == role
+}
+
+// HasPermission implements helper.Principal
+func (i IdentityInfo) HasPermission(perm string) bool {
+	for _, p := range i.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token"`
 }
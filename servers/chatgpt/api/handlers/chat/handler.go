@@ -3,13 +3,15 @@ package chat
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/LSDXXX/libs/api"
 	"github.com/LSDXXX/libs/constant"
+	"github.com/LSDXXX/libs/model"
 	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
 	"github.com/LSDXXX/libs/pkg/log"
 	"github.com/LSDXXX/libs/pkg/util"
 	"github.com/LSDXXX/libs/pkg/wsmanager"
@@ -17,14 +19,58 @@ import (
 	"github.com/LSDXXX/servers/chatgpt/api/handlers/auth"
 	"github.com/LSDXXX/servers/chatgpt/bot"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 )
 
+// clientState asks in flight of a connected client
+type clientState struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	// asks cancel of every ask in flight by request id
+	asks map[string]context.CancelFunc
+}
+
+// start register an ask, false if the id is already in flight
+func (s *clientState) start(id string) (context.Context, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.asks[id]; ok {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.asks[id] = cancel
+	return ctx, true
+}
+
+// stop cancel the ask, false if it is not in flight
+func (s *clientState) stop(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.asks[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (s *clientState) finish(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.asks[id]; ok {
+		cancel()
+		delete(s.asks, id)
+	}
+}
+
 type ChatHandler struct {
-	userMapper   sync.Map
+	// clients state of every connected client by client id
+	clients      sync.Map
 	manager      *wsmanager.WSManager  `container:"type"`
 	conversation *service.Conversation `container:"type"`
-	bot          *bot.Chatbot          `container:"type"`
+	limiter      *service.RateLimiter  `container:"type"`
+	bot          bot.Backend           `container:"type"`
 	mids         []gin.HandlerFunc
 }
 
@@ -45,6 +91,11 @@ func (ws *ChatHandler) Use(e *gin.Engine) {
 	e.GET("/api/chat", ws.manager.BuildHTTPHandler(ws))
 }
 
+// Subprotocols the client may offer Subprotocol
+func (ws *ChatHandler) Subprotocols() []string {
+	return []string{Subprotocol}
+}
+
 func (ws *ChatHandler) OnUpgrade(c *gin.Context, manager *wsmanager.WSManager) (groupID, clientID string, err error) {
 	log.WithContext(context.Background()).Debugf("mid: %d", len(ws.mids))
 	for _, mid := range ws.mids {
@@ -63,32 +114,178 @@ func (ws *ChatHandler) OnClientRegister(c *wsmanager.WSClient) {
 
 func (ws *ChatHandler) OnClientDeregister(c *wsmanager.WSClient) {
 	log.WithContext(context.Background()).Debugf("deRegister ws client: %s, ", c.Id)
+	// stop the answers still streaming to the client
+	if v, ok := ws.clients.LoadAndDelete(c.Id); ok {
+		v.(*clientState).cancel()
+	}
 }
 
+func (ws *ChatHandler) client(c *wsmanager.WSClient) *clientState {
+	if v, ok := ws.clients.Load(c.Id); ok {
+		return v.(*clientState)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	v, loaded := ws.clients.LoadOrStore(c.Id, &clientState{
+		ctx:    ctx,
+		cancel: cancel,
+		asks:   make(map[string]context.CancelFunc),
+	})
+	if loaded {
+		cancel()
+	}
+	return v.(*clientState)
+}
+
+// OnClientMessage handle a frame of the client, see protocol.go
 func (ws *ChatHandler) OnClientMessage(c *wsmanager.WSClient, message []byte) error {
-	var conversationId string
-	v, ok := ws.userMapper.Load(c.Group)
-	if ok {
-		conversationId = v.(string)
+	var frame Frame
+	if err := json.Unmarshal(message, &frame); err != nil {
+		err = errors.Wrap(errorcode.ErrParameterInvalid, "invalid frame")
+		ws.fail(c, frame, err)
+		return err
+	}
+	if frame.V != ProtocolVersion {
+		err := errors.Wrapf(errorcode.ErrParameterInvalid, "unsupported protocol version %d", frame.V)
+		ws.fail(c, frame, err)
+		return err
+	}
+	switch frame.Type {
+	case TypePing:
+		ws.send(c, Frame{Type: TypePong, Id: frame.Id})
+		return nil
+	case TypeAsk:
+		return ws.ask(c, frame)
+	case TypeCancel:
+		if !ws.client(c).stop(frame.Id) {
+			err := errors.Wrapf(errorcode.ErrNotFound, "no ask %s in flight", frame.Id)
+			ws.fail(c, frame, err)
+			return err
+		}
+		return nil
+	default:
+		err := errors.Wrapf(errorcode.ErrParameterInvalid, "unknown frame type %s", frame.Type)
+		ws.fail(c, frame, err)
+		return err
 	}
+}
 
-	parent, ok := ws.conversation.GetParentId(conversationId)
+// ask open the turn and stream the answer in the background, so the
+// client can cancel it or ask in other conversations meanwhile
+func (ws *ChatHandler) ask(c *wsmanager.WSClient, frame Frame) error {
+	if len(frame.Id) == 0 || len(frame.Content) == 0 {
+		err := errors.Wrap(errorcode.ErrParameterInvalid, "ask needs an id and content")
+		ws.fail(c, frame, err)
+		return err
+	}
+	state := ws.client(c)
+	ctx, ok := state.start(frame.Id)
 	if !ok {
-		parent = uuid.NewString()
+		err := errors.Wrapf(errorcode.ErrParameterInvalid, "ask %s already in flight", frame.Id)
+		ws.fail(c, frame, err)
+		return err
 	}
-	go func() {
-		ch, err := ws.bot.AskStream(string(message), conversationId, parent)
-		if err != nil {
-			log.WithContext(context.Background()).Errorf("ask stream error: %s", err.Error())
+	userId := cast.ToInt(c.Group)
+	release, err := ws.limiter.Acquire(userId)
+	if err != nil {
+		state.finish(frame.Id)
+		ws.fail(c, frame, err)
+		return err
+	}
+	turn, err := ws.conversation.Next(userId, frame.ConversationId, frame.Content)
+	if err != nil {
+		state.finish(frame.Id)
+		release(0)
+		log.WithContext(ctx).Errorf("open conversation error: %s", err.Error())
+		ws.fail(c, frame, err)
+		return err
+	}
+	go ws.answer(ctx, c, state, frame.Id, userId, turn, release)
+	return nil
+}
+
+// answer stream the answer as deltas, the answer is saved and charged
+// when the backend is done or the ask was cancelled, an answer broken by
+// an upstream error is charged only
+func (ws *ChatHandler) answer(ctx context.Context, c *wsmanager.WSClient, state *clientState,
+	id string, userId int, turn *model.ConversationTurn, release service.Release) {
+	defer state.finish(id)
+	conv := turn.Conversation
+	reply := Frame{Id: id, ConversationId: conv.ConversationId}
+	opts := []bot.AskOption{bot.WithMessageId(turn.Prompt.MessageId)}
+	ch, err := ws.bot.WithContext(ctx).AskStream(turn.Prompt.Content, conv.UpstreamId,
+		turn.Prompt.ParentId, opts...)
+	if err != nil {
+		release(0)
+		log.WithContext(ctx).Errorf("ask stream error: %s", err.Error())
+		ws.fail(c, reply, err)
+		return
+	}
+	var last *bot.ResponseMessage
+	var sent string
+	var upstreamErr error
+	for msg := range ch {
+		msg := msg
+		if msg.Error != nil {
+			upstreamErr = errors.Errorf("upstream error: %v", msg.Error)
+			continue
 		}
-		for msg := range ch {
-			parentId := msg.Message.ID
-			conversationId := msg.ConversationID
-			ws.conversation.SetParentId(conversationId, parentId)
-			ws.userMapper.Store(c.Group, conversationId)
-			data, _ := json.Marshal(msg)
-			ws.manager.Send(c.Id, c.Group, data)
+		last = &msg
+		// every message carries the whole answer so far
+		text := msg.Text()
+		if len(text) <= len(sent) || !strings.HasPrefix(text, sent) {
+			continue
 		}
-	}()
-	return nil
+		delta := reply
+		delta.Type, delta.MessageId, delta.Content = TypeDelta, msg.Message.ID, text[len(sent):]
+		ws.send(c, delta)
+		sent = text
+	}
+	if last == nil {
+		release(0)
+		if upstreamErr == nil {
+			upstreamErr = errors.New("empty answer")
+		}
+		ws.fail(c, reply, upstreamErr)
+		return
+	}
+	release(service.Usage(turn.Prompt.Content, last.Text()))
+	if upstreamErr != nil && ctx.Err() == nil {
+		// a broken answer is not saved
+		ws.fail(c, reply, upstreamErr)
+		return
+	}
+	if len(conv.UpstreamId) == 0 {
+		err = ws.conversation.BindUpstream(userId, conv.ConversationId, last.ConversationID)
+		if err != nil {
+			log.WithContext(ctx).Errorf("bind upstream error: %s", err.Error())
+			ws.fail(c, reply, err)
+			return
+		}
+	}
+	err = ws.conversation.SaveTurn(userId, turn, bot.AnswerMessage(last))
+	if err != nil {
+		log.WithContext(ctx).Errorf("save messages error: %s", err.Error())
+		ws.fail(c, reply, err)
+		return
+	}
+	done := reply
+	done.Type, done.MessageId, done.Reason = TypeDone, last.Message.ID, DoneStop
+	if ctx.Err() != nil {
+		done.Reason = DoneCancelled
+	}
+	ws.send(c, done)
+}
+
+func (ws *ChatHandler) send(c *wsmanager.WSClient, frame Frame) {
+	ws.manager.Send(c.Id, c.Group, frame.marshal())
+}
+
+// fail answer the frame with an error frame
+func (ws *ChatHandler) fail(c *wsmanager.WSClient, frame Frame, err error) {
+	ws.send(c, Frame{
+		Type:           TypeError,
+		Id:             frame.Id,
+		ConversationId: frame.ConversationId,
+		Error:          newFrameError(err),
+	})
 }
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"encoding/json"
+
+	"github.com/LSDXXX/libs/model"
+)
+
+// ProtocolVersion version of the frames, frames of other versions are rejected
+const ProtocolVersion = 1
+
+// Subprotocol websocket subprotocol of the frames
+const Subprotocol = "chat.v1"
+
+const (
+	// TypeAsk client asks, content is the prompt, an empty conversation id
+	// starts a new conversation
+	TypeAsk = "ask"
+	// TypeCancel client stops the ask with the id, the answer so far is saved
+	TypeCancel = "cancel"
+	// TypePing client checks the connection, answered with TypePong
+	TypePing = "ping"
+	TypePong = "pong"
+	// TypeDelta server sends the text added to the answer since the last delta
+	TypeDelta = "delta"
+	// TypeDone server finished the answer, message_id is the saved answer
+	TypeDone = "done"
+	// TypeError server failed the request with the id
+	TypeError = "error"
+)
+
+const (
+	// DoneStop answer complete
+	DoneStop = "stop"
+	// DoneCancelled answer stopped by a cancel frame
+	DoneCancelled = "cancelled"
+)
+
+// Frame envelope of every websocket message in both directions, the id is
+// chosen by the client and echoed in every frame answering the request
+type Frame struct {
+	V              int         `json:"v"`
+	Type           string      `json:"type"`
+	Id             string      `json:"id,omitempty"`
+	ConversationId string      `json:"conversation_id,omitempty"`
+	MessageId      string      `json:"message_id,omitempty"`
+	Content        string      `json:"content,omitempty"`
+	Reason         string      `json:"reason,omitempty"`
+	Error          *FrameError `json:"error,omitempty"`
+}
+
+// FrameError error of a TypeError frame, code and data like the http responses
+type FrameError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func newFrameError(err error) *FrameError {
+	res := model.NewResponse(model.WithError(err))
+	return &FrameError{
+		Code:    res.Code,
+		Message: res.Message,
+		Data:    res.ErrData,
+	}
+}
+
+func (f Frame) marshal() []byte {
+	f.V = ProtocolVersion
+	data, _ := json.Marshal(f)
+	return data
+}
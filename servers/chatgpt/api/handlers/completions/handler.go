@@ -0,0 +1,276 @@
+package completions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/constant"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/pkg/util"
+	"github.com/LSDXXX/libs/service"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/auth"
+	"github.com/LSDXXX/servers/chatgpt/bot"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// threadTTL how long a history can be continued in its upstream conversation
+const threadTTL = 2 * time.Hour
+
+const finishStop = "stop"
+
+// CompletionsHandler openai compatible chat completions api, so the
+// openai sdks can use the server. The answers are not saved in the
+// conversation history of the user
+type CompletionsHandler struct {
+	bot     bot.Backend          `container:"type"`
+	limiter *service.RateLimiter `container:"type"`
+	threads *threadCache
+	mids    []gin.HandlerFunc
+}
+
+func Register(mids ...gin.HandlerFunc) {
+	api.RegisterHttpRouter(NewCompletionsHandler(mids...))
+}
+
+func NewCompletionsHandler(mids ...gin.HandlerFunc) *CompletionsHandler {
+	out := CompletionsHandler{
+		threads: newThreadCache(threadTTL),
+		mids:    mids,
+	}
+	util.PanicWhenError(container.Fill(&out))
+	return &out
+}
+
+func (h *CompletionsHandler) Use(e *gin.Engine) {
+	e.POST("/v1/chat/completions", h.chain(h.ChatCompletions)...)
+	e.GET("/v1/models", h.chain(h.ListModels)...)
+}
+
+func (h *CompletionsHandler) chain(handler gin.HandlerFunc) []gin.HandlerFunc {
+	out := make([]gin.HandlerFunc, 0, len(h.mids)+1)
+	return append(append(out, h.mids...), handler)
+}
+
+// ChatCompletions answer the last user message of the history
+func (h *CompletionsHandler) ChatCompletions(c *gin.Context) {
+	var req ChatCompletionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+	if req.Messages[len(req.Messages)-1].Role != RoleUser {
+		h.fail(c, errors.Wrap(errorcode.ErrParameterInvalid, "the last message must be a user message"))
+		return
+	}
+	ctx := c.Request.Context()
+	info := auth.IdentityHandler(c, constant.JWTIdentityKey)
+	release, err := h.limiter.WithContext(ctx).Acquire(info.Id)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	prompt, convId, parentId := h.prompt(info.Id, req.Messages)
+	backend := h.bot.WithContext(ctx)
+	if req.Stream {
+		h.stream(c, &req, info.Id, backend, prompt, convId, parentId, release)
+		return
+	}
+
+	res, err := backend.Ask(prompt, convId, parentId)
+	if err != nil {
+		release(0)
+		h.fail(c, err)
+		return
+	}
+	answer := res.Text()
+	release(service.Usage(prompt, answer))
+	h.remember(info.Id, req.Messages, res)
+	finish := finishStop
+	c.JSON(http.StatusOK, ChatCompletion{
+		Id:      completionId(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   modelOf(&req, res),
+		Choices: []Choice{{
+			Message:      &ChatMessage{Role: RoleAssistant, Content: MessageContent(answer)},
+			FinishReason: &finish,
+		}},
+		Usage: usage(req.Messages, answer),
+	})
+}
+
+// stream send the answer as chunks of the text added by every upstream message
+func (h *CompletionsHandler) stream(c *gin.Context, req *ChatCompletionReq, userId int,
+	backend bot.Backend, prompt, convId, parentId string, release service.Release) {
+	ch, err := backend.AskStream(prompt, convId, parentId)
+	if err != nil {
+		release(0)
+		h.fail(c, err)
+		return
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	id, created := completionId(), time.Now().Unix()
+	chunk := func(delta *Delta, finish *string) ChatCompletion {
+		return ChatCompletion{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   req.Model,
+			Choices: []Choice{{Delta: delta, FinishReason: finish}},
+		}
+	}
+	write := func(v interface{}) bool {
+		data, _ := json.Marshal(v)
+		if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	var last *bot.ResponseMessage
+	var sent, upstreamErr string
+	ok := write(chunk(&Delta{Role: RoleAssistant}, nil))
+	for msg := range ch {
+		if !ok {
+			break
+		}
+		msg := msg
+		if msg.Error != nil {
+			upstreamErr = fmt.Sprint(msg.Error)
+			continue
+		}
+		last = &msg
+		// every message carries the whole answer so far
+		text := msg.Text()
+		if len(text) <= len(sent) || !strings.HasPrefix(text, sent) {
+			continue
+		}
+		ok = write(chunk(&Delta{Content: text[len(sent):]}, nil))
+		sent = text
+	}
+	// the backend closes ch soon after the request context ends
+	for range ch {
+	}
+	if last == nil {
+		release(0)
+	} else {
+		release(service.Usage(prompt, last.Text()))
+	}
+	if !ok {
+		return
+	}
+	switch {
+	case len(upstreamErr) > 0:
+		log.WithContext(c).Errorf("chat completions upstream error: %s", upstreamErr)
+		write(ErrorResponse{Error: ErrorBody{Message: upstreamErr, Type: "api_error"}})
+	case last != nil:
+		h.remember(userId, req.Messages, last)
+		finish := finishStop
+		write(chunk(&Delta{}, &finish))
+		if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+			final := chunk(nil, nil)
+			final.Choices = []Choice{}
+			final.Usage = usage(req.Messages, last.Text())
+			write(final)
+		}
+	}
+	_, _ = fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// ListModels models of the backend
+func (h *CompletionsHandler) ListModels(c *gin.Context) {
+	models, err := h.bot.WithContext(c.Request.Context()).ListModels()
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	out := ModelList{Object: "list", Data: []ModelItem{}}
+	for _, m := range models {
+		out.Data = append(out.Data, ModelItem{Id: m, Object: "model", OwnedBy: "chatgpt"})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// prompt what to send upstream, only the last message if the history was
+// answered here before, the whole history as a transcript otherwise
+func (h *CompletionsHandler) prompt(userId int, messages []ChatMessage) (prompt, convId, parentId string) {
+	last := messages[len(messages)-1]
+	if history := messages[:len(messages)-1]; len(history) > 0 {
+		if th, ok := h.threads.get(historyKey(userId, history)); ok {
+			return string(last.Content), th.convId, th.parentId
+		}
+	}
+	return transcript(messages), "", uuid.NewString()
+}
+
+// remember the conversation the answer was given in, for the request
+// continuing the history
+func (h *CompletionsHandler) remember(userId int, messages []ChatMessage, answer *bot.ResponseMessage) {
+	history := make([]ChatMessage, 0, len(messages)+1)
+	history = append(history, messages...)
+	history = append(history, ChatMessage{Role: RoleAssistant, Content: MessageContent(answer.Text())})
+	h.threads.put(historyKey(userId, history), answer.ConversationID, answer.Message.ID)
+}
+
+func (h *CompletionsHandler) fail(c *gin.Context, err error) {
+	status, typ := http.StatusInternalServerError, "api_error"
+	switch {
+	case errors.Is(err, errorcode.ErrParameterInvalid):
+		status, typ = http.StatusBadRequest, "invalid_request_error"
+	case errors.Is(err, errorcode.ErrQuotaExceeded):
+		status, typ = http.StatusTooManyRequests, "insufficient_quota"
+	case errors.Is(err, errorcode.ErrTooManyRequests):
+		status, typ = http.StatusTooManyRequests, "rate_limit_exceeded"
+	case errors.Is(err, errorcode.ErrServiceUnavailable):
+		status = http.StatusServiceUnavailable
+	default:
+		log.WithContext(c).Errorf("chat completions error: %s", err.Error())
+	}
+	var retry *errorcode.RetryError
+	if errors.As(err, &retry) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.RetryAfter.Seconds()))))
+	}
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: ErrorBody{Message: err.Error(), Type: typ}})
+}
+
+func completionId() string {
+	return "chatcmpl-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+func modelOf(req *ChatCompletionReq, res *bot.ResponseMessage) string {
+	if len(res.Message.Metadata.ModelSlug) > 0 {
+		return res.Message.Metadata.ModelSlug
+	}
+	return req.Model
+}
+
+// usage estimate, the backends do not report token counts
+func usage(messages []ChatMessage, answer string) *Usage {
+	var prompt int
+	for _, m := range messages {
+		prompt += estimateTokens(string(m.Content))
+	}
+	completion := estimateTokens(answer)
+	return &Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
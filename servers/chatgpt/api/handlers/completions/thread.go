@@ -0,0 +1,112 @@
+package completions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// thread upstream conversation a message history was answered in
+type thread struct {
+	convId   string
+	parentId string
+	expire   time.Time
+}
+
+// threadCache maps message histories to upstream conversations, so a
+// client sending back the whole history continues the conversation
+// instead of replaying it. Histories it does not know are sent as a
+// transcript in a new conversation
+type threadCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	threads map[string]thread
+}
+
+// threadSweepInterval how often the expired threads are dropped
+const threadSweepInterval = time.Minute
+
+func newThreadCache(ttl time.Duration) *threadCache {
+	out := &threadCache{
+		ttl:     ttl,
+		threads: make(map[string]thread),
+	}
+	go out.sweep(threadSweepInterval)
+	return out
+}
+
+// sweep drop the expired threads every interval, off the request path
+func (t *threadCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		t.mu.Lock()
+		for k, th := range t.threads {
+			if now.After(th.expire) {
+				delete(t.threads, k)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *threadCache) get(key string) (thread, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	th, ok := t.threads[key]
+	if !ok || time.Now().After(th.expire) {
+		return thread{}, false
+	}
+	return th, true
+}
+
+func (t *threadCache) put(key, convId, parentId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.threads[key] = thread{convId: convId, parentId: parentId, expire: time.Now().Add(t.ttl)}
+}
+
+// historyKey key of the messages of a user
+func historyKey(userId int, messages []ChatMessage) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d", userId)
+	for _, m := range messages {
+		fmt.Fprintf(h, "\x00%s\x00%s", m.Role, m.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// transcript messages as a single prompt for a new conversation
+func transcript(messages []ChatMessage) string {
+	if len(messages) == 1 {
+		return string(messages[0].Content)
+	}
+	var b strings.Builder
+	for i, m := range messages {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "%s: %s", m.Role, m.Content)
+	}
+	return b.String()
+}
+
+// estimateTokens rough token count, about four ascii characters per token
+// and one token per other character
+func estimateTokens(texts ...string) int {
+	var out, ascii int
+	for _, text := range texts {
+		for _, r := range text {
+			if r < utf8.RuneSelf {
+				ascii++
+			} else {
+				out++
+			}
+		}
+	}
+	return out + (ascii+3)/4
+}
@@ -0,0 +1,106 @@
+package completions
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// MessageContent text of a message, sent by clients either as a string
+// or as an array of content parts of which only the text is kept
+type MessageContent string
+
+func (m *MessageContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*m = MessageContent(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	*m = MessageContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+type ChatMessage struct {
+	Role    string         `json:"role" binding:"required"`
+	Content MessageContent `json:"content"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ChatCompletionReq struct {
+	Model         string         `json:"model"`
+	Messages      []ChatMessage  `json:"messages" binding:"required,min=1,dive"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *StreamOptions `json:"stream_options"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Delta piece of a streamed answer
+type Delta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type Choice struct {
+	Index        int          `json:"index"`
+	Message      *ChatMessage `json:"message,omitempty"`
+	Delta        *Delta       `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+// ChatCompletion response, or one chunk of a streamed response
+type ChatCompletion struct {
+	Id      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+}
+
+type ModelItem struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelItem `json:"data"`
+}
+
+type ErrorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// ErrorResponse error in the shape the openai sdks parse
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
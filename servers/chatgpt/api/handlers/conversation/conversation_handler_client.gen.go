@@ -0,0 +1,130 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package conversation
+
+import (
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+)
+
+// ConversationHandlerClient ConversationHandler over http
+type ConversationHandlerClient struct {
+	client   *helper.Client
+	rootPath string
+	ctx      context.Context
+}
+
+var _ ConversationHandler = (*ConversationHandlerClient)(nil)
+
+func NewConversationHandlerClient(baseURL string, opts ...helper.RequestOption) *ConversationHandlerClient {
+	return &ConversationHandlerClient{
+		client:   helper.NewClient(baseURL, opts...),
+		rootPath: "/api",
+		ctx:      context.Background(),
+	}
+}
+
+// NewConversationHandlerDiscoveryClient client of the service registered as name
+func NewConversationHandlerDiscoveryClient(name string, opts ...helper.RequestOption) *ConversationHandlerClient {
+	return NewConversationHandlerClient("http://"+name,
+		append([]helper.RequestOption{api.WithDiscovery(name)}, opts...)...)
+}
+
+func (cli *ConversationHandlerClient) WithContext(ctx context.Context) *ConversationHandlerClient {
+	out := *cli
+	out.ctx = ctx
+	return &out
+}
+
+func (cli *ConversationHandlerClient) Ask(req AskReq) (string, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/ask")
+	_req.Body = req
+	var _res string
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ConversationHandlerClient) AskStream(req AskReq) (<-chan AskEvent, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/ask/stream")
+	_req.Body = req
+	return helper.ClientStream[AskEvent](cli.ctx, cli.client, _req)
+}
+
+func (cli *ConversationHandlerClient) ListModels() ([]string, error) {
+	_req := helper.NewClientRequest("GET", cli.rootPath+"/models")
+	var _res []string
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ConversationHandlerClient) ListConversations(archived bool) ([]model.Conversation, error) {
+	_req := helper.NewClientRequest("GET", cli.rootPath+"/conversations")
+	_req.RequestParam("archived", archived)
+	var _res []model.Conversation
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ConversationHandlerClient) CreateConversation(req CreateConversationReq) (*model.Conversation, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/conversation")
+	_req.Body = req
+	var _res *model.Conversation
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ConversationHandlerClient) GetConversation(convId string) (*model.ConversationDetail, error) {
+	_req := helper.NewClientRequest("GET", cli.rootPath+"/conversation/:id")
+	_req.PathVariable("id", convId)
+	var _res *model.ConversationDetail
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ConversationHandlerClient) RenameConversation(convId string, req RenameConversationReq) error {
+	_req := helper.NewClientRequest("PUT", cli.rootPath+"/conversation/:id/title")
+	_req.PathVariable("id", convId)
+	_req.Body = req
+	return cli.client.Do(cli.ctx, _req, nil)
+}
+
+func (cli *ConversationHandlerClient) ArchiveConversation(convId string, req ArchiveConversationReq) error {
+	_req := helper.NewClientRequest("PUT", cli.rootPath+"/conversation/:id/archive")
+	_req.PathVariable("id", convId)
+	_req.Body = req
+	return cli.client.Do(cli.ctx, _req, nil)
+}
+
+func (cli *ConversationHandlerClient) Regenerate(convId string, req RegenerateReq) (<-chan AskEvent, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/conversation/:id/regenerate")
+	_req.PathVariable("id", convId)
+	_req.Body = req
+	return helper.ClientStream[AskEvent](cli.ctx, cli.client, _req)
+}
+
+func (cli *ConversationHandlerClient) EditMessage(convId string, req EditMessageReq) (<-chan AskEvent, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/conversation/:id/edit")
+	_req.PathVariable("id", convId)
+	_req.Body = req
+	return helper.ClientStream[AskEvent](cli.ctx, cli.client, _req)
+}
+
+func (cli *ConversationHandlerClient) SwitchBranch(convId string, req SwitchBranchReq) (string, error) {
+	_req := helper.NewClientRequest("PUT", cli.rootPath+"/conversation/:id/current_node")
+	_req.PathVariable("id", convId)
+	_req.Body = req
+	var _res string
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *ConversationHandlerClient) DeleteConversation(convId string) error {
+	_req := helper.NewClientRequest("DELETE", cli.rootPath+"/conversation/:id")
+	_req.PathVariable("id", convId)
+	return cli.client.Do(cli.ctx, _req, nil)
+}
@@ -1,18 +1,249 @@
 package conversation
 
-import "github.com/google/uuid"
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/LSDXXX/libs/service"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/auth"
+	"github.com/LSDXXX/servers/chatgpt/bot"
+	"github.com/pkg/errors"
+)
+
+func (imp *ConversationHandlerImp) userId() (int, error) {
+	info, ok := auth.GetIdentity(imp.ctx)
+	if !ok {
+		return 0, errorcode.ErrForbidden
+	}
+	return info.Id, nil
+}
+
+// askOptions backend options sending the prompt of the turn
+func askOptions(turn *model.ConversationTurn) []bot.AskOption {
+	opts := []bot.AskOption{bot.WithMessageId(turn.Prompt.MessageId)}
+	if turn.Variant {
+		opts = append(opts, bot.WithVariant())
+	}
+	return opts
+}
+
+// saveTurn persist the prompt and the answer
+func (imp *ConversationHandlerImp) saveTurn(userId int, turn *model.ConversationTurn, answer *bot.ResponseMessage) error {
+	conv := turn.Conversation
+	if len(conv.UpstreamId) == 0 {
+		err := imp.Conversation.BindUpstream(userId, conv.ConversationId, answer.ConversationID)
+		if err != nil {
+			return err
+		}
+	}
+	return imp.Conversation.SaveTurn(userId, turn, bot.AnswerMessage(answer))
+}
 
 func (imp *ConversationHandlerImp) Ask(req AskReq) (string, error) {
-	//TODO:
+	userId, err := imp.userId()
+	if err != nil {
+		return "", err
+	}
+	release, err := imp.RateLimiter.Acquire(userId)
+	if err != nil {
+		return "", err
+	}
+	var used int64
+	defer func() {
+		release(used)
+	}()
+	turn, err := imp.Conversation.Next(userId, req.ConversationId, req.Content)
+	if err != nil {
+		return "", err
+	}
+	res, err := imp.Backend.Ask(turn.Prompt.Content, turn.Conversation.UpstreamId,
+		turn.Prompt.ParentId, askOptions(turn)...)
+	if err != nil {
+		return "", err
+	}
+	used = service.Usage(turn.Prompt.Content, res.Text())
+	err = imp.saveTurn(userId, turn, res)
+	if err != nil {
+		return "", err
+	}
+	return res.Text(), nil
+}
 
-	parent, ok := imp.Conversation.GetParentId(req.ConversationId)
-	if !ok {
-		parent = uuid.NewString()
+func (imp *ConversationHandlerImp) AskStream(req AskReq) (<-chan AskEvent, error) {
+	userId, err := imp.userId()
+	if err != nil {
+		return nil, err
+	}
+	release, err := imp.RateLimiter.Acquire(userId)
+	if err != nil {
+		return nil, err
+	}
+	turn, err := imp.Conversation.Next(userId, req.ConversationId, req.Content)
+	if err != nil {
+		release(0)
+		return nil, err
+	}
+	return imp.stream(userId, turn, release)
+}
+
+func (imp *ConversationHandlerImp) Regenerate(convId string, req RegenerateReq) (<-chan AskEvent, error) {
+	userId, err := imp.userId()
+	if err != nil {
+		return nil, err
 	}
-	id, parentId, res, err := imp.Chatbot.Ask(req.Content, req.ConversationId, parent)
+	release, err := imp.RateLimiter.Acquire(userId)
+	if err != nil {
+		return nil, err
+	}
+	turn, err := imp.Conversation.Regenerate(userId, convId, req.MessageId)
+	if err != nil {
+		release(0)
+		return nil, err
+	}
+	return imp.stream(userId, turn, release)
+}
+
+func (imp *ConversationHandlerImp) EditMessage(convId string, req EditMessageReq) (<-chan AskEvent, error) {
+	userId, err := imp.userId()
+	if err != nil {
+		return nil, err
+	}
+	release, err := imp.RateLimiter.Acquire(userId)
+	if err != nil {
+		return nil, err
+	}
+	turn, err := imp.Conversation.Edit(userId, convId, req.MessageId, req.Content)
+	if err != nil {
+		release(0)
+		return nil, err
+	}
+	return imp.stream(userId, turn, release)
+}
+
+func (imp *ConversationHandlerImp) SwitchBranch(convId string, req SwitchBranchReq) (string, error) {
+	userId, err := imp.userId()
 	if err != nil {
 		return "", err
 	}
-	imp.Conversation.SetParentId(id, parentId)
-	return res, nil
+	return imp.Conversation.SwitchBranch(userId, convId, req.MessageId)
+}
+
+// stream send the prompt of the turn and stream the answer as events,
+// the answer is saved and charged when the backend is done
+func (imp *ConversationHandlerImp) stream(userId int, turn *model.ConversationTurn,
+	release service.Release) (<-chan AskEvent, error) {
+	conv := turn.Conversation
+	ch, err := imp.Backend.AskStream(turn.Prompt.Content, conv.UpstreamId,
+		turn.Prompt.ParentId, askOptions(turn)...)
+	if err != nil {
+		release(0)
+		return nil, err
+	}
+	out := make(chan AskEvent)
+	send := func(e AskEvent) bool {
+		e.ConversationId = conv.ConversationId
+		select {
+		case out <- e:
+			return true
+		case <-imp.ctx.Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(out)
+		var last *bot.ResponseMessage
+		var upstreamErr error
+		for msg := range ch {
+			msg := msg
+			if msg.Error != nil {
+				upstreamErr = errors.Errorf("%v", msg.Error)
+				continue
+			}
+			last = &msg
+			if !send(AskEvent{Event: AskEventMessage, MessageId: msg.Message.ID, Content: msg.Text()}) {
+				break
+			}
+		}
+		// the backend closes ch soon after the request context ends,
+		// what has been answered until then is saved
+		for range ch {
+		}
+		cancelled := imp.ctx.Err() != nil
+		fail := func(err error) {
+			send(AskEvent{Event: AskEventError, ParentId: turn.Prompt.ParentId, Error: err.Error()})
+		}
+		if last == nil {
+			release(0)
+			if upstreamErr == nil {
+				upstreamErr = errors.New("empty answer")
+			}
+			fail(upstreamErr)
+			return
+		}
+		release(service.Usage(turn.Prompt.Content, last.Text()))
+		// a truncated answer is not a turn to reply to
+		if upstreamErr != nil && !cancelled {
+			fail(upstreamErr)
+			return
+		}
+		if err := imp.saveTurn(userId, turn, last); err != nil {
+			log.WithContext(imp.ctx).Errorf("save messages error: %s", err.Error())
+			fail(err)
+			return
+		}
+		send(AskEvent{Event: AskEventDone, ParentId: last.Message.ID, Cancelled: cancelled})
+	}()
+	return out, nil
+}
+
+func (imp *ConversationHandlerImp) ListModels() ([]string, error) {
+	return imp.Backend.ListModels()
+}
+
+func (imp *ConversationHandlerImp) ListConversations(archived bool) ([]model.Conversation, error) {
+	userId, err := imp.userId()
+	if err != nil {
+		return nil, err
+	}
+	return imp.Conversation.List(userId, archived)
+}
+
+func (imp *ConversationHandlerImp) CreateConversation(req CreateConversationReq) (*model.Conversation, error) {
+	userId, err := imp.userId()
+	if err != nil {
+		return nil, err
+	}
+	return imp.Conversation.Create(userId, req.Title)
+}
+
+func (imp *ConversationHandlerImp) GetConversation(convId string) (*model.ConversationDetail, error) {
+	userId, err := imp.userId()
+	if err != nil {
+		return nil, err
+	}
+	return imp.Conversation.Get(userId, convId)
+}
+
+func (imp *ConversationHandlerImp) RenameConversation(convId string, req RenameConversationReq) error {
+	userId, err := imp.userId()
+	if err != nil {
+		return err
+	}
+	return imp.Conversation.Rename(userId, convId, req.Title)
+}
+
+func (imp *ConversationHandlerImp) ArchiveConversation(convId string, req ArchiveConversationReq) error {
+	userId, err := imp.userId()
+	if err != nil {
+		return err
+	}
+	return imp.Conversation.Archive(userId, convId, req.Archived)
+}
+
+func (imp *ConversationHandlerImp) DeleteConversation(convId string) error {
+	userId, err := imp.userId()
+	if err != nil {
+		return err
+	}
+	return imp.Conversation.Delete(userId, convId)
 }
@@ -5,6 +5,8 @@
 package conversation
 
 import (
+	"io"
+
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 
@@ -14,21 +16,22 @@ import (
 	"github.com/LSDXXX/libs/model"
 	"github.com/LSDXXX/libs/pkg/container"
 	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
 	"github.com/LSDXXX/libs/service"
 	"github.com/LSDXXX/servers/chatgpt/bot"
 )
 
-func Register(mid ...func(*gin.Context)) {
+func Register(mid ...gin.HandlerFunc) {
 	api.RegisterHttpRouter(NewConversationHandlerWrapper(mid))
 }
 
 type ConversationHandlerWrapper struct {
 	handler     *ConversationHandlerImp
 	rootPath    string
-	middleWares []func(*gin.Context)
+	middleWares []gin.HandlerFunc
 }
 
-func NewConversationHandlerWrapper(mid []func(*gin.Context)) *ConversationHandlerWrapper {
+func NewConversationHandlerWrapper(mid []gin.HandlerFunc) *ConversationHandlerWrapper {
 	out := &ConversationHandlerWrapper{
 		rootPath:    "/api",
 		handler:     NewConversationHandlerImp(),
@@ -42,13 +45,32 @@ func NewConversationHandlerWrapper(mid []func(*gin.Context)) *ConversationHandle
 }
 
 func (w *ConversationHandlerWrapper) Use(e *gin.Engine) {
+	w.Group(&e.RouterGroup)
+}
+
+// Group register the routes in a group of g at the root path, the
+// middlewares of Register run for every route
+func (w *ConversationHandlerWrapper) Group(g *gin.RouterGroup) {
+	r := g.Group(w.rootPath, w.middleWares...)
 
-	e.POST(w.rootPath+"/ask", w.Ask)
+	r.POST("/ask", w.Ask)
+	r.POST("/ask/stream", w.AskStream)
+	r.GET("/models", w.ListModels)
+	r.GET("/conversations", w.ListConversations)
+	r.POST("/conversation", w.CreateConversation)
+	r.GET("/conversation/:id", w.GetConversation)
+	r.PUT("/conversation/:id/title", w.RenameConversation)
+	r.PUT("/conversation/:id/archive", w.ArchiveConversation)
+	r.POST("/conversation/:id/regenerate", w.Regenerate)
+	r.POST("/conversation/:id/edit", w.EditMessage)
+	r.PUT("/conversation/:id/current_node", w.SwitchBranch)
+	r.DELETE("/conversation/:id", w.DeleteConversation)
 }
 
 type ConversationHandlerImp struct {
-	Chatbot      *bot.Chatbot          `container:"type"`
+	Backend      bot.Backend           `container:"type"`
 	Conversation *service.Conversation `container:"type"`
+	RateLimiter  *service.RateLimiter  `container:"type"`
 	ctx          context.Context
 }
 
@@ -66,39 +88,482 @@ func NewConversationHandlerImp() *ConversationHandlerImp {
 func (imp *ConversationHandlerImp) WithContext(ctx context.Context) *ConversationHandlerImp {
 	out := *imp
 
-	out.Chatbot = imp.Chatbot.WithContext(ctx)
+	out.Backend = imp.Backend.WithContext(ctx)
 	out.Conversation = imp.Conversation.WithContext(ctx)
+	out.RateLimiter = imp.RateLimiter.WithContext(ctx)
 	out.ctx = ctx
 	return &out
 }
 
 func (w *ConversationHandlerWrapper) Ask(c *gin.Context) {
-	for _, mid := range w.middleWares {
-		mid(c)
-		if c.IsAborted() {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var req AskReq
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.Ask(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *ConversationHandlerWrapper) AskStream(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var req AskReq
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.AskStream(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(_ io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case item, ok := <-res:
+			if !ok {
+				return false
+			}
+			c.SSEvent(helper.EventName(item), item)
+			return true
+		}
+	})
+}
+
+func (w *ConversationHandlerWrapper) ListModels(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.ListModels()
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *ConversationHandlerWrapper) ListConversations(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var archived bool
+
+	_tmp = c.Query("archived")
+
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &archived)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "request param archived"))
 			return
 		}
 	}
 
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.ListConversations(archived)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *ConversationHandlerWrapper) CreateConversation(c *gin.Context) {
 	var _tmp string
 	_ = _tmp
 	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
 
-	var req AskReq
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var req CreateConversationReq
 
 	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.CreateConversation(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *ConversationHandlerWrapper) GetConversation(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
 		c.JSON(200,
-			model.NewResponse(model.WithError(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))))
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
 		return
 	}
 
+	var convId string
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &convId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
 	ctx := c.Request.Context()
 	handler := w.handler.WithContext(ctx)
-	res, err := handler.Ask(req)
+	res, err := handler.GetConversation(convId)
 	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *ConversationHandlerWrapper) RenameConversation(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
 		c.JSON(200,
 			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var convId string
+	var req RenameConversationReq
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &convId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.RenameConversation(convId, req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
+
+func (w *ConversationHandlerWrapper) ArchiveConversation(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var convId string
+	var req ArchiveConversationReq
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &convId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.ArchiveConversation(convId, req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
+
+func (w *ConversationHandlerWrapper) Regenerate(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var convId string
+	var req RegenerateReq
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &convId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.Regenerate(convId, req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(_ io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case item, ok := <-res:
+			if !ok {
+				return false
+			}
+			c.SSEvent(helper.EventName(item), item)
+			return true
+		}
+	})
+}
+
+func (w *ConversationHandlerWrapper) EditMessage(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var convId string
+	var req EditMessageReq
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &convId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.EditMessage(convId, req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(_ io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case item, ok := <-res:
+			if !ok {
+				return false
+			}
+			c.SSEvent(helper.EventName(item), item)
+			return true
+		}
+	})
+}
+
+func (w *ConversationHandlerWrapper) SwitchBranch(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var convId string
+	var req SwitchBranchReq
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &convId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.SwitchBranch(convId, req)
+	if err != nil {
+		fail(err)
 		return
 	}
 	c.JSON(200, model.NewResponse(model.WithData(res)))
 }
+
+func (w *ConversationHandlerWrapper) DeleteConversation(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	if err = helper.RequirePermission(c, "chat"); err != nil {
+		fail(err)
+		return
+	}
+
+	var convId string
+
+	_tmp = c.Param("id")
+	if _tmp != "" {
+		err = helper.BindStringToObject(_tmp, &convId)
+		if err != nil {
+			fail(errors.Wrap(errorcode.ErrParameterInvalid, "path variable: id"))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.DeleteConversation(convId)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
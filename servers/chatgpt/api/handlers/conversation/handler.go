@@ -1,17 +1,70 @@
 package conversation
 
 import (
+	"github.com/LSDXXX/libs/model"
 	"github.com/LSDXXX/libs/pkg/handlergen/helper"
 	"github.com/LSDXXX/libs/service"
 	"github.com/LSDXXX/servers/chatgpt/bot"
 )
 
 //@RequestMapping(/api)
-//go:generate handlergentool -f $GOFILE -op ./ -pkg $GOPACKAGE
+//@RequirePermission(chat)
+//go:generate handlergentool -f $GOFILE -op ./ -pkg $GOPACKAGE -openapi ../../openapi.yml
 type ConversationHandler interface {
-	helper.InjectServices2[*bot.Chatbot, *service.Conversation]
+	helper.InjectServices3[bot.Backend, *service.Conversation, *service.RateLimiter]
 
 	//@RequestMapping(/ask, POST)
 	//@BindBody(req)
 	Ask(req AskReq) (string, error)
+
+	//@RequestMapping(/ask/stream, POST)
+	//@BindBody(req)
+	//@Stream
+	AskStream(req AskReq) (<-chan AskEvent, error)
+
+	//@RequestMapping(/models, GET)
+	ListModels() ([]string, error)
+
+	//@RequestMapping(/conversations, GET)
+	//@RequestParam(archived=@archived)
+	ListConversations(archived bool) ([]model.Conversation, error)
+
+	//@RequestMapping(/conversation, POST)
+	//@BindBody(req)
+	CreateConversation(req CreateConversationReq) (*model.Conversation, error)
+
+	//@RequestMapping(/conversation/:id, GET)
+	//@PathVariable(id=@convId)
+	GetConversation(convId string) (*model.ConversationDetail, error)
+
+	//@RequestMapping(/conversation/:id/title, PUT)
+	//@PathVariable(id=@convId)
+	//@BindBody(req)
+	RenameConversation(convId string, req RenameConversationReq) error
+
+	//@RequestMapping(/conversation/:id/archive, PUT)
+	//@PathVariable(id=@convId)
+	//@BindBody(req)
+	ArchiveConversation(convId string, req ArchiveConversationReq) error
+
+	//@RequestMapping(/conversation/:id/regenerate, POST)
+	//@PathVariable(id=@convId)
+	//@BindBody(req)
+	//@Stream
+	Regenerate(convId string, req RegenerateReq) (<-chan AskEvent, error)
+
+	//@RequestMapping(/conversation/:id/edit, POST)
+	//@PathVariable(id=@convId)
+	//@BindBody(req)
+	//@Stream
+	EditMessage(convId string, req EditMessageReq) (<-chan AskEvent, error)
+
+	//@RequestMapping(/conversation/:id/current_node, PUT)
+	//@PathVariable(id=@convId)
+	//@BindBody(req)
+	SwitchBranch(convId string, req SwitchBranchReq) (string, error)
+
+	//@RequestMapping(/conversation/:id, DELETE)
+	//@PathVariable(id=@convId)
+	DeleteConversation(convId string) error
 }
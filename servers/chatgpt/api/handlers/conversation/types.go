@@ -4,3 +4,58 @@ type AskReq struct {
 	ConversationId string `json:"conversation_id"`
 	Content        string `json:"content" binding:"required"`
 }
+
+type RegenerateReq struct {
+	// MessageId answer to regenerate, the current node when empty
+	MessageId string `json:"message_id"`
+}
+
+type EditMessageReq struct {
+	// MessageId user message to edit
+	MessageId string `json:"message_id" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+}
+
+type SwitchBranchReq struct {
+	// MessageId any message of the branch to switch to
+	MessageId string `json:"message_id" binding:"required"`
+}
+
+type CreateConversationReq struct {
+	Title string `json:"title"`
+}
+
+type RenameConversationReq struct {
+	Title string `json:"title" binding:"required"`
+}
+
+type ArchiveConversationReq struct {
+	Archived bool `json:"archived"`
+}
+
+const (
+	// AskEventMessage answer generated so far
+	AskEventMessage = "message"
+	// AskEventDone answer finished and saved, parent_id is the message to
+	// reply to, cancelled when the client went away before the end
+	AskEventDone = "done"
+	// AskEventError upstream or storage error, nothing was saved and
+	// parent_id is still the message to reply to
+	AskEventError = "error"
+)
+
+// AskEvent server sent event of /ask/stream, /conversation/:id/regenerate
+// and /conversation/:id/edit
+type AskEvent struct {
+	Event          string `json:"-"`
+	ConversationId string `json:"conversation_id"`
+	MessageId      string `json:"message_id,omitempty"`
+	ParentId       string `json:"parent_id,omitempty"`
+	Content        string `json:"content,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Cancelled      bool   `json:"cancelled,omitempty"`
+}
+
+func (e AskEvent) EventName() string {
+	return e.Event
+}
@@ -0,0 +1,20 @@
+package signup
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/libs/service"
+)
+
+//@RequestMapping(/api)
+//go:generate handlergentool -f $GOFILE -op ./ -pkg $GOPACKAGE -openapi ../../openapi.yml
+type SignUpHandler interface {
+	helper.InjectServices1[*service.User]
+
+	//@RequestMapping(/register, POST)
+	//@BindBody(req)
+	//@Validate
+	//@Status(201)
+	//@ErrorStatus(ErrParameterInvalid=400, ErrInvalidInviteCode=403, ErrUserExists=409)
+	Register(req RegisterReq) (*model.User, error)
+}
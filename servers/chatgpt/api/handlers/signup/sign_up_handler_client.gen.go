@@ -0,0 +1,50 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package signup
+
+import (
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+)
+
+// SignUpHandlerClient SignUpHandler over http
+type SignUpHandlerClient struct {
+	client   *helper.Client
+	rootPath string
+	ctx      context.Context
+}
+
+var _ SignUpHandler = (*SignUpHandlerClient)(nil)
+
+func NewSignUpHandlerClient(baseURL string, opts ...helper.RequestOption) *SignUpHandlerClient {
+	return &SignUpHandlerClient{
+		client:   helper.NewClient(baseURL, opts...),
+		rootPath: "/api",
+		ctx:      context.Background(),
+	}
+}
+
+// NewSignUpHandlerDiscoveryClient client of the service registered as name
+func NewSignUpHandlerDiscoveryClient(name string, opts ...helper.RequestOption) *SignUpHandlerClient {
+	return NewSignUpHandlerClient("http://"+name,
+		append([]helper.RequestOption{api.WithDiscovery(name)}, opts...)...)
+}
+
+func (cli *SignUpHandlerClient) WithContext(ctx context.Context) *SignUpHandlerClient {
+	out := *cli
+	out.ctx = ctx
+	return &out
+}
+
+func (cli *SignUpHandlerClient) Register(req RegisterReq) (*model.User, error) {
+	_req := helper.NewClientRequest("POST", cli.rootPath+"/register")
+	_req.Body = req
+	var _res *model.User
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
@@ -0,0 +1,25 @@
+package signup
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/servers/chatgpt/config"
+	"github.com/pkg/errors"
+)
+
+func (imp *SignUpHandlerImp) Register(req RegisterReq) (*model.User, error) {
+	switch config.ServerConfig().Logic.SignUp {
+	case config.SignUpOpen:
+	case config.SignUpInvite:
+		if len(req.InviteCode) == 0 {
+			return nil, errors.Wrap(errorcode.ErrInvalidInviteCode, "invite code is required")
+		}
+	default:
+		return nil, errors.Wrap(errorcode.ErrForbidden, "sign up is closed")
+	}
+	user, err := imp.User.Register(req.Username, req.Password, req.InviteCode)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
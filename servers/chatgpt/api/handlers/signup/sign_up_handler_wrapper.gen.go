@@ -0,0 +1,103 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package signup
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/libs/service"
+)
+
+func Register(mid ...gin.HandlerFunc) {
+	api.RegisterHttpRouter(NewSignUpHandlerWrapper(mid))
+}
+
+type SignUpHandlerWrapper struct {
+	handler     *SignUpHandlerImp
+	rootPath    string
+	middleWares []gin.HandlerFunc
+}
+
+func NewSignUpHandlerWrapper(mid []gin.HandlerFunc) *SignUpHandlerWrapper {
+	out := &SignUpHandlerWrapper{
+		rootPath:    "/api",
+		handler:     NewSignUpHandlerImp(),
+		middleWares: mid,
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (w *SignUpHandlerWrapper) Use(e *gin.Engine) {
+	w.Group(&e.RouterGroup)
+}
+
+// Group register the routes in a group of g at the root path, the
+// middlewares of Register run for every route
+func (w *SignUpHandlerWrapper) Group(g *gin.RouterGroup) {
+	r := g.Group(w.rootPath, w.middleWares...)
+
+	r.POST("/register", w.Register)
+}
+
+type SignUpHandlerImp struct {
+	User *service.User `container:"type"`
+	ctx  context.Context
+}
+
+func NewSignUpHandlerImp() *SignUpHandlerImp {
+	out := &SignUpHandlerImp{
+		ctx: context.Background(),
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (imp *SignUpHandlerImp) WithContext(ctx context.Context) *SignUpHandlerImp {
+	out := *imp
+
+	out.User = imp.User.WithContext(ctx)
+	out.ctx = ctx
+	return &out
+}
+
+func (w *SignUpHandlerWrapper) Register(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(helper.ErrorStatus(err, helper.Status{Err: errorcode.ErrParameterInvalid, Code: 400}, helper.Status{Err: errorcode.ErrInvalidInviteCode, Code: 403}, helper.Status{Err: errorcode.ErrUserExists, Code: 409}),
+			model.NewResponse(model.WithError(err)))
+	}
+
+	var req RegisterReq
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(helper.NewValidationError(err, &req))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.Register(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(201, model.NewResponse(model.WithData(res)))
+}
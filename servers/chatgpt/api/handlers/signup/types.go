@@ -0,0 +1,8 @@
+package signup
+
+type RegisterReq struct {
+	Username string `json:"username" binding:"required,max=64"`
+	Password string `json:"password" binding:"required,min=8,max=128"`
+	// InviteCode required when logic.sign_up is invite
+	InviteCode string `json:"invite_code"`
+}
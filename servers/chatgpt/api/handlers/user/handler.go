@@ -0,0 +1,24 @@
+package user
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+	"github.com/LSDXXX/libs/service"
+)
+
+//@RequestMapping(/api/user)
+//go:generate handlergentool -f $GOFILE -op ./ -pkg $GOPACKAGE -openapi ../../openapi.yml
+type UserHandler interface {
+	helper.InjectServices1[*service.User]
+
+	//@RequestMapping(/profile, GET)
+	GetProfile() (*model.User, error)
+
+	//@RequestMapping(/profile, PUT)
+	//@BindBody(req)
+	UpdateProfile(req UpdateProfileReq) error
+
+	//@RequestMapping(/password, PUT)
+	//@BindBody(req)
+	ChangePassword(req ChangePasswordReq) error
+}
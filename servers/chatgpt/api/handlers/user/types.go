@@ -0,0 +1,11 @@
+package user
+
+type UpdateProfileReq struct {
+	Nickname string `json:"nickname" binding:"max=64"`
+	Email    string `json:"email" binding:"omitempty,email,max=255"`
+}
+
+type ChangePasswordReq struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8,max=128"`
+}
@@ -0,0 +1,61 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package user
+
+import (
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/handlergen/helper"
+)
+
+// UserHandlerClient UserHandler over http
+type UserHandlerClient struct {
+	client   *helper.Client
+	rootPath string
+	ctx      context.Context
+}
+
+var _ UserHandler = (*UserHandlerClient)(nil)
+
+func NewUserHandlerClient(baseURL string, opts ...helper.RequestOption) *UserHandlerClient {
+	return &UserHandlerClient{
+		client:   helper.NewClient(baseURL, opts...),
+		rootPath: "/api/user",
+		ctx:      context.Background(),
+	}
+}
+
+// NewUserHandlerDiscoveryClient client of the service registered as name
+func NewUserHandlerDiscoveryClient(name string, opts ...helper.RequestOption) *UserHandlerClient {
+	return NewUserHandlerClient("http://"+name,
+		append([]helper.RequestOption{api.WithDiscovery(name)}, opts...)...)
+}
+
+func (cli *UserHandlerClient) WithContext(ctx context.Context) *UserHandlerClient {
+	out := *cli
+	out.ctx = ctx
+	return &out
+}
+
+func (cli *UserHandlerClient) GetProfile() (*model.User, error) {
+	_req := helper.NewClientRequest("GET", cli.rootPath+"/profile")
+	var _res *model.User
+	err := cli.client.Do(cli.ctx, _req, &_res)
+	return _res, err
+}
+
+func (cli *UserHandlerClient) UpdateProfile(req UpdateProfileReq) error {
+	_req := helper.NewClientRequest("PUT", cli.rootPath+"/profile")
+	_req.Body = req
+	return cli.client.Do(cli.ctx, _req, nil)
+}
+
+func (cli *UserHandlerClient) ChangePassword(req ChangePasswordReq) error {
+	_req := helper.NewClientRequest("PUT", cli.rootPath+"/password")
+	_req.Body = req
+	return cli.client.Do(cli.ctx, _req, nil)
+}
@@ -0,0 +1,43 @@
+package user
+
+import (
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/servers/chatgpt/api/handlers/auth"
+)
+
+func (imp *UserHandlerImp) userId() (int, error) {
+	info, ok := auth.GetIdentity(imp.ctx)
+	if !ok {
+		return 0, errorcode.ErrForbidden
+	}
+	return info.Id, nil
+}
+
+func (imp *UserHandlerImp) GetProfile() (*model.User, error) {
+	userId, err := imp.userId()
+	if err != nil {
+		return nil, err
+	}
+	user, err := imp.User.Get(userId)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (imp *UserHandlerImp) UpdateProfile(req UpdateProfileReq) error {
+	userId, err := imp.userId()
+	if err != nil {
+		return err
+	}
+	return imp.User.UpdateProfile(userId, req.Nickname, req.Email)
+}
+
+func (imp *UserHandlerImp) ChangePassword(req ChangePasswordReq) error {
+	userId, err := imp.userId()
+	if err != nil {
+		return err
+	}
+	return imp.User.ChangePassword(userId, req.OldPassword, req.NewPassword)
+}
@@ -0,0 +1,150 @@
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+// Code generated by handlergen DO NOT EDIT.
+
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"context"
+
+	"github.com/LSDXXX/libs/api"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/pkg/container"
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/service"
+)
+
+func Register(mid ...gin.HandlerFunc) {
+	api.RegisterHttpRouter(NewUserHandlerWrapper(mid))
+}
+
+type UserHandlerWrapper struct {
+	handler     *UserHandlerImp
+	rootPath    string
+	middleWares []gin.HandlerFunc
+}
+
+func NewUserHandlerWrapper(mid []gin.HandlerFunc) *UserHandlerWrapper {
+	out := &UserHandlerWrapper{
+		rootPath:    "/api/user",
+		handler:     NewUserHandlerImp(),
+		middleWares: mid,
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (w *UserHandlerWrapper) Use(e *gin.Engine) {
+	w.Group(&e.RouterGroup)
+}
+
+// Group register the routes in a group of g at the root path, the
+// middlewares of Register run for every route
+func (w *UserHandlerWrapper) Group(g *gin.RouterGroup) {
+	r := g.Group(w.rootPath, w.middleWares...)
+
+	r.GET("/profile", w.GetProfile)
+	r.PUT("/profile", w.UpdateProfile)
+	r.PUT("/password", w.ChangePassword)
+}
+
+type UserHandlerImp struct {
+	User *service.User `container:"type"`
+	ctx  context.Context
+}
+
+func NewUserHandlerImp() *UserHandlerImp {
+	out := &UserHandlerImp{
+		ctx: context.Background(),
+	}
+	err := container.Fill(out)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (imp *UserHandlerImp) WithContext(ctx context.Context) *UserHandlerImp {
+	out := *imp
+
+	out.User = imp.User.WithContext(ctx)
+	out.ctx = ctx
+	return &out
+}
+
+func (w *UserHandlerWrapper) GetProfile(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	res, err := handler.GetProfile()
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(res)))
+}
+
+func (w *UserHandlerWrapper) UpdateProfile(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	var req UpdateProfileReq
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.UpdateProfile(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
+
+func (w *UserHandlerWrapper) ChangePassword(c *gin.Context) {
+	var _tmp string
+	_ = _tmp
+	var err error
+	fail := func(err error) {
+		c.JSON(200,
+			model.NewResponse(model.WithError(err)))
+	}
+
+	var req ChangePasswordReq
+
+	if err = c.ShouldBindJSON(&req); err != nil {
+		fail(errors.Wrap(errorcode.ErrParameterInvalid, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	handler := w.handler.WithContext(ctx)
+	err = handler.ChangePassword(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	c.JSON(200, model.NewResponse(model.WithData(nil)))
+}
@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAccountCooldown = 5 * time.Minute
+	defaultMaxFailures     = 3
+)
+
+// AccountStatus health of one account of the pool
+type AccountStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Active requests being answered right now
+	Active   int   `json:"active"`
+	Requests int64 `json:"requests"`
+	// Failures consecutive failed requests
+	Failures int `json:"failures"`
+	// Conversations conversations routed to the account
+	Conversations int        `json:"conversations"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+type account struct {
+	name          string
+	auth          Authenticator
+	active        int
+	requests      int64
+	failures      int
+	cooldownUntil time.Time
+	lastError     string
+	lastUsed      time.Time
+}
+
+// AccountPoolOption opts
+type AccountPoolOption func(*AccountPool)
+
+// WithCooldown how long an account rests after it is rate limited,
+// fails to login or fails too often
+func WithCooldown(cooldown time.Duration) AccountPoolOption {
+	return func(p *AccountPool) {
+		if cooldown > 0 {
+			p.cooldown = cooldown
+		}
+	}
+}
+
+// AccountPool web accounts shared by all users. New conversations go to
+// the least loaded healthy account, later turns stick to the account that
+// created the conversation, because the upstream conversation only exists there.
+// Routes are kept in memory, a conversation created before a restart is
+// routed like a new one.
+type AccountPool struct {
+	mu          sync.Mutex
+	accounts    []*account
+	routes      map[string]*account
+	cooldown    time.Duration
+	maxFailures int
+}
+
+func NewAccountPool(opts ...AccountPoolOption) *AccountPool {
+	out := &AccountPool{
+		routes:      make(map[string]*account),
+		cooldown:    defaultAccountCooldown,
+		maxFailures: defaultMaxFailures,
+	}
+	for _, opt := range opts {
+		opt(out)
+	}
+	return out
+}
+
+// Add add an account, name identifies it in the status
+//
+//	@receiver p
+//	@param name
+//	@param auth
+func (p *AccountPool) Add(name string, auth Authenticator) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accounts = append(p.accounts, &account{name: name, auth: auth})
+}
+
+// Login login the accounts without an access token, an account failing
+// to login cools down
+//
+//	@receiver p
+//	@return error when no account is usable
+func (p *AccountPool) Login() error {
+	p.mu.Lock()
+	accounts := append([]*account(nil), p.accounts...)
+	p.mu.Unlock()
+	if len(accounts) == 0 {
+		return errors.New("no account configured")
+	}
+	var usable int
+	var lastErr error
+	for _, acc := range accounts {
+		if len(acc.auth.AccessToken()) > 0 {
+			usable++
+			continue
+		}
+		if err := acc.auth.Login(); err != nil {
+			lastErr = errors.Wrapf(err, "login %s", acc.name)
+			p.mu.Lock()
+			p.coolDown(acc, lastErr.Error())
+			p.mu.Unlock()
+			continue
+		}
+		usable++
+	}
+	if usable == 0 {
+		return lastErr
+	}
+	return nil
+}
+
+// KeepFresh renew the tokens of the accounts before they expire until
+// ctx is done, accounts without expiring tokens are skipped
+//
+//	@receiver p
+//	@param ctx
+func (p *AccountPool) KeepFresh(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, acc := range p.accounts {
+		if r, ok := acc.auth.(interface{ KeepFresh(context.Context) }); ok {
+			go r.KeepFresh(ctx)
+		}
+	}
+}
+
+// Status status of every account
+//
+//	@receiver p
+//	@return []AccountStatus
+func (p *AccountPool) Status() []AccountStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conversations := make(map[*account]int, len(p.accounts))
+	for _, acc := range p.routes {
+		conversations[acc]++
+	}
+	now := time.Now()
+	out := make([]AccountStatus, 0, len(p.accounts))
+	for _, acc := range p.accounts {
+		status := AccountStatus{
+			Name:          acc.name,
+			Healthy:       !now.Before(acc.cooldownUntil),
+			Active:        acc.active,
+			Requests:      acc.requests,
+			Failures:      acc.failures,
+			Conversations: conversations[acc],
+			LastError:     acc.lastError,
+		}
+		if !status.Healthy {
+			until := acc.cooldownUntil
+			status.CooldownUntil = &until
+		}
+		out = append(out, status)
+	}
+	return out
+}
+
+// acquire pick the account answering in the upstream conversation and
+// mark it busy, release or fail must follow
+func (p *AccountPool) acquire(convId string) (*account, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if acc, ok := p.routes[convId]; ok && len(convId) > 0 {
+		if now.Before(acc.cooldownUntil) {
+			return nil, errorcode.WithRetryAfter(errors.Wrap(errorcode.ErrServiceUnavailable,
+				"account of the conversation is cooling down"), acc.cooldownUntil.Sub(now))
+		}
+		p.use(acc, now)
+		return acc, nil
+	}
+	healthy := make([]*account, 0, len(p.accounts))
+	var wait time.Duration
+	for _, acc := range p.accounts {
+		if now.Before(acc.cooldownUntil) {
+			if left := acc.cooldownUntil.Sub(now); wait == 0 || left < wait {
+				wait = left
+			}
+			continue
+		}
+		healthy = append(healthy, acc)
+	}
+	if len(healthy) == 0 {
+		if len(p.accounts) == 0 {
+			return nil, errors.Wrap(errorcode.ErrServiceUnavailable, "no account configured")
+		}
+		return nil, errorcode.WithRetryAfter(errors.Wrap(errorcode.ErrServiceUnavailable,
+			"all accounts are cooling down"), wait)
+	}
+	// least loaded first, the least recently used among equals
+	sort.SliceStable(healthy, func(i, j int) bool {
+		if healthy[i].active != healthy[j].active {
+			return healthy[i].active < healthy[j].active
+		}
+		return healthy[i].lastUsed.Before(healthy[j].lastUsed)
+	})
+	p.use(healthy[0], now)
+	return healthy[0], nil
+}
+
+func (p *AccountPool) use(acc *account, now time.Time) {
+	acc.active++
+	acc.requests++
+	acc.lastUsed = now
+}
+
+// bind route later turns of the upstream conversation to the account
+func (p *AccountPool) bind(convId string, acc *account) {
+	if len(convId) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routes[convId] = acc
+}
+
+// release the request on the account succeeded
+func (p *AccountPool) release(acc *account) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	acc.active--
+	acc.failures = 0
+}
+
+// fail the request on the account was answered with status. The account
+// logs in again on 401 and 403, and cools down when it is rate limited,
+// cannot login or failed too often in a row
+func (p *AccountPool) fail(acc *account, status int, reason string) {
+	p.mu.Lock()
+	acc.active--
+	acc.failures++
+	acc.lastError = reason
+	if status == http.StatusTooManyRequests || acc.failures >= p.maxFailures {
+		p.coolDown(acc, reason)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	if status != http.StatusUnauthorized && status != http.StatusForbidden {
+		return
+	}
+	if err := acc.auth.Login(); err != nil {
+		log.WithContext(context.Background()).Errorf("login %s: %s", acc.name, err.Error())
+		p.mu.Lock()
+		p.coolDown(acc, errors.Wrap(err, "login").Error())
+		p.mu.Unlock()
+	}
+}
+
+func (p *AccountPool) coolDown(acc *account, reason string) {
+	acc.cooldownUntil = time.Now().Add(p.cooldown)
+	acc.lastError = reason
+	acc.failures = 0
+}
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LSDXXX/libs/infra"
+	"github.com/LSDXXX/libs/model"
+	"github.com/LSDXXX/libs/repo"
+	"github.com/LSDXXX/libs/service"
+	"github.com/LSDXXX/servers/chatgpt/config"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// BackendWeb chat.openai.com web session
+	BackendWeb = "web"
+	// BackendOpenAI official chat completions api
+	BackendOpenAI = "openai"
+)
+
+const (
+	// ActionNext ask a new prompt
+	ActionNext = "next"
+	// ActionVariant answer a prompt that was sent before again
+	ActionVariant = "variant"
+)
+
+// AskOptions options of one ask
+type AskOptions struct {
+	// Action ActionNext or ActionVariant
+	Action string
+	// MessageId id of the prompt, a variant must reuse the id of the prompt it answers again
+	MessageId string
+}
+
+// AskOption opts
+type AskOption func(*AskOptions)
+
+// WithMessageId id of the prompt, generated when empty
+func WithMessageId(id string) AskOption {
+	return func(o *AskOptions) {
+		o.MessageId = id
+	}
+}
+
+// WithVariant answer the prompt again instead of asking a new one
+func WithVariant() AskOption {
+	return func(o *AskOptions) {
+		o.Action = ActionVariant
+	}
+}
+
+func newAskOptions(opts []AskOption) AskOptions {
+	out := AskOptions{Action: ActionNext}
+	for _, opt := range opts {
+		opt(&out)
+	}
+	if len(out.MessageId) == 0 {
+		out.MessageId = uuid.NewString()
+	}
+	return out
+}
+
+// Backend llm provider used by the handlers
+type Backend interface {
+	WithContext(ctx context.Context) Backend
+
+	// Ask send content and wait for the whole answer, the last message is returned
+	Ask(content, convId, preConvId string, opts ...AskOption) (*ResponseMessage, error)
+
+	// AskStream send content, every message carries the full text generated so far
+	AskStream(content, convId, preConvId string, opts ...AskOption) (<-chan ResponseMessage, error)
+
+	// ListModels models the backend can serve
+	ListModels() ([]string, error)
+}
+
+const (
+	// TokenStoreFile tokens cached in a local json file
+	TokenStoreFile = "file"
+	// TokenStoreRedis tokens cached in redis
+	TokenStoreRedis = "redis"
+	// TokenStoreDB tokens cached in the auth_token table
+	TokenStoreDB = "db"
+)
+
+func newTokenStore(conf config.LogicConfig) (repo.TokenStore, error) {
+	switch conf.TokenStore {
+	case "":
+		return nil, nil
+	case TokenStoreFile:
+		return infra.NewTokenStoreFileImp(conf.TokenFile), nil
+	case TokenStoreRedis:
+		return infra.NewTokenStoreRedisImp(), nil
+	case TokenStoreDB:
+		return infra.NewTokenStoreDBImp(), nil
+	}
+	return nil, errors.Errorf("unknown token store: %s", conf.TokenStore)
+}
+
+// NewAccountPoolByConfig pool of the configured web accounts
+//
+//	@param conf
+//	@return *AccountPool
+//	@return error
+func NewAccountPoolByConfig(conf config.LogicConfig) (*AccountPool, error) {
+	store, err := newTokenStore(conf)
+	if err != nil {
+		return nil, err
+	}
+	authOpts := []service.OpenAIAuthOption{service.WithRefreshBefore(conf.TokenRefreshBefore)}
+	if store != nil {
+		authOpts = append(authOpts, service.WithTokenStore(store))
+	}
+	accounts := conf.Accounts
+	if len(accounts) == 0 {
+		accounts = []config.AccountConfig{{
+			Email:       conf.Email,
+			Password:    conf.Password,
+			Proxy:       conf.Proxy,
+			AccessToken: conf.AccessToken,
+		}}
+	}
+	pool := NewAccountPool(WithCooldown(conf.AccountCooldown))
+	for i, a := range accounts {
+		auth := service.NewOpenAIAuth(a.Email, a.Password, a.Proxy, authOpts...)
+		if len(a.AccessToken) > 0 {
+			auth.SetAccessToken(a.AccessToken)
+		}
+		name := a.Email
+		if len(name) == 0 {
+			name = fmt.Sprintf("account-%d", i)
+		}
+		pool.Add(name, auth)
+	}
+	return pool, nil
+}
+
+// NewBackend create backend by config, pool and opts apply to the web
+// backend
+//
+//	@param conf
+//	@param pool accounts of the web backend, the configured ones when nil
+//	@param opts
+//	@return Backend
+//	@return error
+func NewBackend(conf config.LogicConfig, pool *AccountPool, opts ...ChatbotOption) (Backend, error) {
+	switch conf.Backend {
+	case BackendWeb, "":
+		if pool == nil {
+			var err error
+			pool, err = NewAccountPoolByConfig(conf)
+			if err != nil {
+				return nil, err
+			}
+		}
+		opts = append([]ChatbotOption{WithAccountPool(pool),
+			WithModel(conf.Model), WithBaseURL(conf.BaseURL), WithTimeout(conf.Timeout)}, opts...)
+		chatbot, err := NewChatbot(conf.Email, conf.Password, conf.Proxy, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return chatbot, nil
+	case BackendOpenAI:
+		return NewOpenAIBot(conf.OpenAI.APIKey, conf.OpenAI.BaseURL, conf.OpenAI.Model,
+			WithOpenAITimeout(conf.Timeout),
+			WithOpenAIHistory(conf.OpenAI.HistoryTTL, conf.OpenAI.HistorySize)), nil
+	}
+	return nil, errors.Errorf("unknown backend: %s", conf.Backend)
+}
+
+// AnswerMessage assistant message ready to be persisted, the parent
+// is set when the turn is saved
+//
+//	@param answer last message of the answer
+//	@return model.ConversationMessage
+func AnswerMessage(answer *ResponseMessage) model.ConversationMessage {
+	return model.ConversationMessage{
+		MessageId:    answer.Message.ID,
+		Role:         "assistant",
+		Content:      answer.Text(),
+		ModelSlug:    answer.Message.Metadata.ModelSlug,
+		FinishReason: answer.Message.Metadata.FinishDetails.Type,
+	}
+}
@@ -0,0 +1,380 @@
+// Package bottest provides an in-process fake of the upstream llm apis,
+// so the chat service can be tested without real credentials.
+package bottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultModel model slug reported when the reply does not set one
+const DefaultModel = "fake-model"
+
+// Reply scripted upstream answer, replies are consumed in order
+type Reply struct {
+	// Parts text pieces, every event carries the text joined so far
+	Parts []string
+	// Error sent as the error field of an event after the parts
+	Error string
+	// Status respond with this http status instead of a stream
+	Status int
+	// Delay wait before every event
+	Delay time.Duration
+	Model string
+}
+
+// Request upstream request received by the server
+type Request struct {
+	Path          string
+	Authorization string
+	Action        string
+	// MessageId id of the prompt, web api only
+	MessageId       string
+	Content         string
+	ConversationId  string
+	ParentMessageId string
+	Model           string
+	// Messages chat completions history, role: content
+	Messages []string
+}
+
+type webReq struct {
+	Action   string `json:"action"`
+	Messages []struct {
+		Id      string `json:"id"`
+		Content struct {
+			Parts []string `json:"parts"`
+		} `json:"content"`
+	} `json:"messages"`
+	ConversationId  string `json:"conversation_id"`
+	ParentMessageId string `json:"parent_message_id"`
+	Model           string `json:"model"`
+}
+
+type completionReq struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Stream bool `json:"stream"`
+}
+
+// Server fake speaking the web conversation api and the
+// chat completions api on the same address.
+// It also implements bot.Authenticator, Login issues a new token
+// and requests with any other token are answered with 401.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+	token    string
+	expired  bool
+	logins   int
+	active   int
+}
+
+// NewServer start a fake server, Close it when done
+//
+//	@return *Server
+func NewServer() *Server {
+	s := &Server{
+		token: uuid.NewString(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/conversation", s.handleConversation)
+	mux.HandleFunc("/chat/completions", s.handleCompletions)
+	mux.HandleFunc("/models", s.handleModels)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Reply enqueue scripted replies, when the queue is empty the
+// server echoes the prompt
+func (s *Server) Reply(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Login issue a new access token, the old one is rejected from now on
+func (s *Server) Login() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = uuid.NewString()
+	s.expired = false
+	s.logins++
+	return nil
+}
+
+// AccessToken current valid token
+func (s *Server) AccessToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// Logins times Login was called
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// Active answers being streamed right now, an answer stops streaming
+// when all parts are sent or the client goes away
+func (s *Server) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+func (s *Server) track(delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active += delta
+}
+
+// Expire reject the current token until the next Login
+func (s *Server) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expired = true
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.expired && r.Header.Get("Authorization") == "Bearer "+s.token
+}
+
+func (s *Server) record(req Request) Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if len(s.replies) == 0 {
+		return Reply{Parts: []string{"echo: ", req.Content}}
+	}
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	return reply
+}
+
+func (s *Server) handleConversation(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, `{"detail":"token expired"}`, http.StatusUnauthorized)
+		return
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	var body webReq
+	if err := json.Unmarshal(data, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{
+		Path:            r.URL.Path,
+		Authorization:   r.Header.Get("Authorization"),
+		Action:          body.Action,
+		ConversationId:  body.ConversationId,
+		ParentMessageId: body.ParentMessageId,
+		Model:           body.Model,
+	}
+	if len(body.Messages) > 0 {
+		req.MessageId = body.Messages[0].Id
+		if len(body.Messages[0].Content.Parts) > 0 {
+			req.Content = body.Messages[0].Content.Parts[0]
+		}
+	}
+	reply := s.record(req)
+	if reply.Status != 0 && reply.Status != http.StatusOK {
+		http.Error(w, http.StatusText(reply.Status), reply.Status)
+		return
+	}
+
+	s.track(1)
+	defer s.track(-1)
+	convId := body.ConversationId
+	if len(convId) == 0 {
+		convId = uuid.NewString()
+	}
+	model := reply.Model
+	if len(model) == 0 {
+		model = DefaultModel
+	}
+	messageId := uuid.NewString()
+	w.Header().Set("Content-Type", "text/event-stream")
+	var text strings.Builder
+	for i, part := range reply.Parts {
+		text.WriteString(part)
+		var finish interface{}
+		if i == len(reply.Parts)-1 {
+			finish = map[string]string{"type": "stop"}
+		}
+		if !s.event(w, r, reply.Delay, map[string]interface{}{
+			"message": map[string]interface{}{
+				"id":   messageId,
+				"role": "assistant",
+				"content": map[string]interface{}{
+					"content_type": "text",
+					"parts":        []string{text.String()},
+				},
+				"metadata": map[string]interface{}{
+					"message_type":   "next",
+					"model_slug":     model,
+					"finish_details": finish,
+				},
+			},
+			"conversation_id": convId,
+			"error":           nil,
+		}) {
+			return
+		}
+	}
+	if len(reply.Error) > 0 {
+		if !s.event(w, r, reply.Delay, map[string]interface{}{
+			"message":         nil,
+			"conversation_id": convId,
+			"error":           reply.Error,
+		}) {
+			return
+		}
+	}
+	s.done(w)
+}
+
+func (s *Server) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, `{"error":{"message":"invalid api key"}}`, http.StatusUnauthorized)
+		return
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	var body completionReq
+	if err := json.Unmarshal(data, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{
+		Path:          r.URL.Path,
+		Authorization: r.Header.Get("Authorization"),
+		Model:         body.Model,
+	}
+	for _, m := range body.Messages {
+		req.Messages = append(req.Messages, m.Role+": "+m.Content)
+	}
+	if len(body.Messages) > 0 {
+		req.Content = body.Messages[len(body.Messages)-1].Content
+	}
+	reply := s.record(req)
+	if reply.Status != 0 && reply.Status != http.StatusOK {
+		http.Error(w, http.StatusText(reply.Status), reply.Status)
+		return
+	}
+	model := reply.Model
+	if len(model) == 0 {
+		model = DefaultModel
+	}
+	id := "chatcmpl-" + uuid.NewString()
+	s.track(1)
+	defer s.track(-1)
+
+	if !body.Stream {
+		if len(reply.Error) > 0 {
+			http.Error(w, reply.Error, http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(reply.Delay)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":    id,
+			"model": model,
+			"choices": []interface{}{map[string]interface{}{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": strings.Join(reply.Parts, "")},
+				"finish_reason": "stop",
+			}},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for i, part := range reply.Parts {
+		var finish interface{}
+		if i == len(reply.Parts)-1 {
+			finish = "stop"
+		}
+		if !s.event(w, r, reply.Delay, map[string]interface{}{
+			"id":    id,
+			"model": model,
+			"choices": []interface{}{map[string]interface{}{
+				"index":         0,
+				"delta":         map[string]string{"content": part},
+				"finish_reason": finish,
+			}},
+		}) {
+			return
+		}
+	}
+	if len(reply.Error) > 0 {
+		if !s.event(w, r, reply.Delay, map[string]interface{}{
+			"error": map[string]string{"message": reply.Error},
+		}) {
+			return
+		}
+	}
+	s.done(w)
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"models": []interface{}{map[string]string{"slug": DefaultModel}},
+		"data":   []interface{}{map[string]string{"id": DefaultModel}},
+	})
+}
+
+// event write one sse event, false if the client has gone away
+func (s *Server) event(w http.ResponseWriter, r *http.Request, delay time.Duration, v interface{}) bool {
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	data, _ := json.Marshal(v)
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return false
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return true
+}
+
+func (s *Server) done(w http.ResponseWriter) {
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
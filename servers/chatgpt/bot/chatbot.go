@@ -1,7 +1,6 @@
 package bot
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,51 +8,148 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/LSDXXX/libs/pkg/log"
 	"github.com/LSDXXX/libs/service"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
-var ConversationContainer Conversation
+const (
+	defaultWebBaseURL = "https://bypass.duti.tech/api"
+	defaultWebModel   = "text-davinci-002-render-sha"
+)
+
+var _ Backend = new(Chatbot)
+
+// Authenticator provides the access token of the web session
+type Authenticator interface {
+	Login() error
+	AccessToken() string
+}
+
+// ChatbotOption opts
+type ChatbotOption func(*Chatbot)
 
+// WithBaseURL web api address, e.g. https://bypass.duti.tech/api
+func WithBaseURL(url string) ChatbotOption {
+	return func(c *Chatbot) {
+		if len(url) > 0 {
+			c.baseURL = strings.TrimSuffix(url, "/")
+		}
+	}
+}
+
+// WithAuth replace the default email/password login with a single account
+func WithAuth(auth Authenticator) ChatbotOption {
+	return func(c *Chatbot) {
+		c.pool = NewAccountPool()
+		c.pool.Add("default", auth)
+	}
+}
+
+// WithAccountPool answer with the accounts of the pool
+func WithAccountPool(pool *AccountPool) ChatbotOption {
+	return func(c *Chatbot) {
+		c.pool = pool
+	}
+}
+
+// WithTimeout deadline of every upstream request, the whole answer
+// must be received within it, zero means no deadline
+func WithTimeout(timeout time.Duration) ChatbotOption {
+	return func(c *Chatbot) {
+		c.timeout = timeout
+	}
+}
+
+// WithModel model slug sent to the web api
+func WithModel(model string) ChatbotOption {
+	return func(c *Chatbot) {
+		if len(model) > 0 {
+			c.model = model
+		}
+	}
+}
+
+// Chatbot backend talking to the chat.openai.com web api with a logged in session
 type Chatbot struct {
-	auth     *service.OpenAIAuth
+	pool     *AccountPool
 	ctx      context.Context
+	client   *http.Client
 	email    string
 	password string
 	proxy    string
+	model    string
+	baseURL  string
+	timeout  time.Duration
 }
 
-func NewChatbot(email, password, proxy string) *Chatbot {
+// NewChatbot create web backend, login is skipped for the accounts
+// already holding an access token
+//
+//	@param email
+//	@param password
+//	@param proxy
+//	@param opts
+//	@return *Chatbot
+//	@return error
+func NewChatbot(email, password, proxy string, opts ...ChatbotOption) (*Chatbot, error) {
 	out := &Chatbot{
-		auth:     service.NewOpenAIAuth(email, password, proxy),
+		ctx:      context.Background(),
+		client:   &http.Client{},
 		email:    email,
 		password: password,
 		proxy:    proxy,
+		model:    defaultWebModel,
+		baseURL:  defaultWebBaseURL,
 	}
-	err := out.auth.Login()
-	if err != nil {
-		panic("failed to login: " + err.Error())
+	for _, opt := range opts {
+		opt(out)
+	}
+	if out.pool == nil {
+		out.pool = NewAccountPool()
+		out.pool.Add(email, service.NewOpenAIAuth(email, password, proxy))
 	}
-	return out
+	if err := out.pool.Login(); err != nil {
+		return nil, errors.Wrap(err, "login")
+	}
+	return out, nil
+}
+
+// Pool accounts the chatbot answers with
+func (c *Chatbot) Pool() *AccountPool {
+	return c.pool
 }
 
-func (c *Chatbot) WithContext(ctx context.Context) *Chatbot {
+func (c *Chatbot) WithContext(ctx context.Context) Backend {
 	out := *c
 	out.ctx = ctx
 	return &out
 }
 
-func (c *Chatbot) doAsk(content, convId, preConvId string, retry int) (res *http.Response, err error) {
+// upstreamContext context of one upstream request, bounded by the timeout
+func (c *Chatbot) upstreamContext() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(c.ctx, c.timeout)
+	}
+	return context.WithCancel(c.ctx)
+}
+
+// doAsk send the prompt with an account of the pool, on success the
+// account is in use until the caller releases it
+func (c *Chatbot) doAsk(ctx context.Context, content, convId, preConvId string,
+	opts AskOptions, retry int) (res *http.Response, acc *account, err error) {
 	if retry > 3 {
-		return nil, errors.New("failed to ask")
+		return nil, nil, errors.New("failed to ask")
+	}
+	acc, err = c.pool.acquire(convId)
+	if err != nil {
+		return nil, nil, err
 	}
 	headers := map[string][]string{
 		"Content-Type":  {"application/json"},
-		"Authorization": {fmt.Sprintf("Bearer %s", c.auth.AccessToken())},
+		"Authorization": {fmt.Sprintf("Bearer %s", acc.auth.AccessToken())},
 		"Accept":        {"text/event-stream"},
 		"Connection":    {"close"},
 		"Referer":       {"https://chat.openai.com/chat"},
@@ -63,10 +159,10 @@ func (c *Chatbot) doAsk(content, convId, preConvId string, retry int) (res *http
 	}
 
 	data, _ := json.Marshal(askReq{
-		Action: "next",
+		Action: opts.Action,
 		Messages: []askMessage{
 			{
-				Id:   uuid.NewString(),
+				Id:   opts.MessageId,
 				Role: "user",
 				Content: struct {
 					ContentType string   "json:\"content_type\""
@@ -79,121 +175,130 @@ func (c *Chatbot) doAsk(content, convId, preConvId string, retry int) (res *http
 		},
 		ConversationId:  convId,
 		ParentMessageId: preConvId,
-		Model:           "text-davinci-002-render-sha",
+		Model:           c.model,
 	})
 
-	req, err := http.NewRequest(http.MethodPost,
-		"https://bypass.duti.tech/api/conversation", bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.baseURL+"/conversation", bytes.NewBuffer(data))
 	if err != nil {
-		return nil, errors.Wrap(err, "new request")
+		c.pool.release(acc)
+		return nil, nil, errors.Wrap(err, "new request")
 	}
 
 	req.Header = headers
-	httpClient := http.Client{}
-	res, err = httpClient.Do(req)
+	res, err = c.client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "do http request")
+		// the caller going away is not the fault of the account
+		if ctx.Err() != nil {
+			c.pool.release(acc)
+		} else {
+			c.pool.fail(acc, 0, err.Error())
+		}
+		return nil, nil, errors.Wrap(err, "do http request")
 	}
 	if res.StatusCode != 200 {
 		data, _ := ioutil.ReadAll(res.Body)
 		defer res.Body.Close()
-		log.WithContext(c.ctx).Errorf("res: %s", string(data))
-		err := c.auth.Login()
-		if err != nil {
-			return nil, errors.Wrap(err, "login")
-		}
-		return c.doAsk(content, convId, preConvId, retry+1)
+		log.WithContext(c.ctx).Errorf("account: %s, status: %d, res: %s", acc.name, res.StatusCode, string(data))
+		c.pool.fail(acc, res.StatusCode, fmt.Sprintf("status %d: %s", res.StatusCode, string(data)))
+		return c.doAsk(ctx, content, convId, preConvId, opts, retry+1)
 	}
-	return res, nil
+	return res, acc, nil
 }
 
-func (c *Chatbot) Ask(content, convId, preConvId string) (id, parent, response string, err error) {
-	res, err := c.doAsk(content, convId, preConvId, 0)
+func (c *Chatbot) Ask(content, convId, preConvId string, opts ...AskOption) (*ResponseMessage, error) {
+	ch, err := c.AskStream(content, convId, preConvId, opts...)
 	if err != nil {
-		return "", "", "", err
+		return nil, err
 	}
-	data, _ := ioutil.ReadAll(res.Body)
-	lines := strings.Split(string(data), "\n")
-	fmt.Println(string(data), res.StatusCode)
-
-	var message, conversationId, parentId string
-
-	for _, line := range lines {
-		line = strings.Trim(line, " ")
-		if !strings.HasPrefix(line, "data:") {
-			continue
-		}
-		line = strings.Trim(strings.TrimPrefix(line, "data:"), " ")
-		if line == "[DONE]" {
-			break
-		}
-		var resData ResponseMessage
-		err := json.Unmarshal([]byte(line), &resData)
-		if err != nil {
+	var last *ResponseMessage
+	for msg := range ch {
+		msg := msg
+		if msg.Error != nil {
+			err = errors.Errorf("upstream error: %v", msg.Error)
 			continue
 		}
-		message = resData.Message.Content.Parts[0]
-		parentId = resData.Message.ID
-		conversationId = resData.ConversationID
+		last = &msg
+	}
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, errors.New("empty answer")
 	}
-	return conversationId, parentId, message, nil
+	return last, nil
 }
 
-func (c *Chatbot) AskStream(content, convId, preConvId string) (<-chan ResponseMessage, error) {
-	res, err := c.doAsk(content, convId, preConvId, 0)
+func (c *Chatbot) AskStream(content, convId, preConvId string, opts ...AskOption) (<-chan ResponseMessage, error) {
+	ctx, cancel := c.upstreamContext()
+	res, acc, err := c.doAsk(ctx, content, convId, preConvId, newAskOptions(opts), 0)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	reader := bufio.NewReader(res.Body)
 	ch := make(chan ResponseMessage)
 	go func() {
 		defer close(ch)
-		i := 0
-		for {
-			data, _, err := reader.ReadLine()
-			i++
-			if i <= 3 {
-				continue
-			}
-			if err != nil {
-				break
-			}
-			line := string(data)
-			line = strings.Trim(line, " ")
-			if !strings.HasPrefix(line, "data:") {
-				continue
+		defer cancel()
+		defer res.Body.Close()
+		defer c.pool.release(acc)
+		bound := len(convId) > 0
+		err := readEvents(res.Body, func(data []byte) bool {
+			var resData ResponseMessage
+			if err := json.Unmarshal(data, &resData); err != nil {
+				return true
 			}
-			line = strings.Trim(strings.TrimPrefix(line, "data:"), " ")
-			if line == "[DONE]" {
-				break
+			if !bound && len(resData.ConversationID) > 0 {
+				c.pool.bind(resData.ConversationID, acc)
+				bound = true
 			}
-			var resData ResponseMessage
-			err = json.Unmarshal([]byte(line), &resData)
-			if err != nil {
-				continue
+			if resData.Error == nil && len(resData.Message.Content.Parts) == 0 {
+				return true
 			}
-			ch <- resData
-		}
+			return send(ctx, ch, resData)
+		})
+		streamError(c.ctx, ctx, ch, convId, err)
 	}()
 	return ch, nil
 }
 
-type Conversation struct {
-	conversations sync.Map
-}
-
-func (c *Conversation) Add(id, parent string) {
-	c.conversations.Store(id, parent)
-}
-
-func (c *Conversation) Del(id string) {
-	c.conversations.Delete(id)
-}
-
-func (c *Conversation) GetParentId(id string) string {
-	v, ok := c.conversations.Load(id)
-	if !ok {
-		return ""
+func (c *Chatbot) ListModels() ([]string, error) {
+	ctx, cancel := c.upstreamContext()
+	defer cancel()
+	acc, err := c.pool.acquire("")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/models", nil)
+	if err != nil {
+		c.pool.release(acc)
+		return nil, errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", acc.auth.AccessToken()))
+	res, err := c.client.Do(req)
+	if err != nil {
+		c.pool.fail(acc, 0, err.Error())
+		return nil, errors.Wrap(err, "do http request")
+	}
+	defer res.Body.Close()
+	data, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != 200 {
+		c.pool.fail(acc, res.StatusCode, fmt.Sprintf("status %d: %s", res.StatusCode, string(data)))
+		return nil, errors.Errorf("list models, status: %d, content: %s", res.StatusCode, string(data))
+	}
+	c.pool.release(acc)
+	var out struct {
+		Models []struct {
+			Slug string `json:"slug"`
+		} `json:"models"`
+	}
+	err = json.Unmarshal(data, &out)
+	if err != nil {
+		return nil, errors.Wrap(err, "json unmarshal")
+	}
+	var models []string
+	for _, m := range out.Models {
+		models = append(models, m.Slug)
 	}
-	return v.(string)
+	return models, nil
 }
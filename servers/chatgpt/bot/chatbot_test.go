@@ -0,0 +1,409 @@
+package bot_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/errorcode"
+	"github.com/LSDXXX/servers/chatgpt/bot"
+	"github.com/LSDXXX/servers/chatgpt/bot/bottest"
+	"github.com/LSDXXX/servers/chatgpt/config"
+)
+
+func newChatbot(t *testing.T, fake *bottest.Server) *bot.Chatbot {
+	t.Helper()
+	c, err := bot.NewChatbot("", "", "", bot.WithAuth(fake), bot.WithBaseURL(fake.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestChatbotAsk(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	c := newChatbot(t, fake)
+
+	fake.Reply(bottest.Reply{Parts: []string{"hello", " world"}})
+	res, err := c.Ask("hi", "", "p0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, parent := res.ConversationID, res.Message.ID
+	if res.Text() != "hello world" || len(id) == 0 || len(parent) == 0 {
+		t.Fatalf("unexpected answer: %+v", res)
+	}
+	if res.Message.Metadata.ModelSlug != bottest.DefaultModel || res.Message.Metadata.FinishDetails.Type != "stop" {
+		t.Fatalf("unexpected metadata: %+v", res.Message.Metadata)
+	}
+
+	_, err = c.Ask("again", id, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := fake.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("expect 2 requests, got %d", len(reqs))
+	}
+	if reqs[1].ConversationId != id || reqs[1].ParentMessageId != parent || reqs[1].Content != "again" {
+		t.Fatalf("unexpected request: %+v", reqs[1])
+	}
+}
+
+func TestChatbotAskStream(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	c := newChatbot(t, fake)
+
+	fake.Reply(bottest.Reply{Parts: []string{"a", "b", "c"}, Delay: time.Millisecond})
+	ch, err := c.AskStream("hi", "", "p0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for msg := range ch {
+		texts = append(texts, msg.Message.Content.Parts[0])
+	}
+	if len(texts) != 3 || texts[2] != "abc" {
+		t.Fatalf("unexpected stream: %v", texts)
+	}
+}
+
+func TestChatbotRelogin(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	c := newChatbot(t, fake)
+
+	fake.Expire()
+	fake.Reply(bottest.Reply{Status: http.StatusUnauthorized}, bottest.Reply{Parts: []string{"ok"}})
+	res, err := c.Ask("hi", "", "p0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Text() != "ok" {
+		t.Fatalf("unexpected answer: %s", res.Text())
+	}
+	if fake.Logins() != 2 {
+		t.Fatalf("expect 2 logins, got %d", fake.Logins())
+	}
+}
+
+func TestChatbotErrors(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	c := newChatbot(t, fake)
+
+	fake.Reply(bottest.Reply{Parts: []string{"partial"}, Error: "too many requests"})
+	if _, err := c.Ask("hi", "", "p0"); err == nil {
+		t.Fatal("expect upstream error")
+	}
+
+	for i := 0; i < 5; i++ {
+		fake.Reply(bottest.Reply{Status: http.StatusInternalServerError})
+	}
+	if _, err := c.Ask("hi", "", "p0"); err == nil {
+		t.Fatal("expect error after retries")
+	}
+}
+
+func TestNewBackendPool(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	conf := config.LogicConfig{Backend: bot.BackendWeb, BaseURL: fake.URL, TokenStore: "unknown"}
+	if _, err := bot.NewBackend(conf, nil); err == nil {
+		t.Fatal("expect the configured pool to fail")
+	}
+
+	pool := bot.NewAccountPool()
+	pool.Add("fake", fake)
+	backend, err := bot.NewBackend(conf, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.(*bot.Chatbot).Pool() != pool {
+		t.Fatal("expect the given pool")
+	}
+}
+
+func TestOpenAIBotHistory(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	o := bot.NewOpenAIBot(fake.AccessToken(), fake.URL, "gpt")
+
+	fake.Reply(bottest.Reply{Parts: []string{"first"}})
+	res, err := o.Ask("one", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Text() != "first" || res.Message.Metadata.FinishDetails.Type != "stop" {
+		t.Fatalf("unexpected answer: %+v", res)
+	}
+	id := res.ConversationID
+
+	fake.Reply(bottest.Reply{Parts: []string{"sec", "ond"}})
+	ch, err := o.AskStream("two", id, res.Message.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last bot.ResponseMessage
+	for msg := range ch {
+		last = msg
+	}
+	if last.Message.Content.Parts[0] != "second" || last.ConversationID != id {
+		t.Fatalf("unexpected message: %+v", last)
+	}
+
+	reqs := fake.Requests()
+	want := []string{"user: one", "assistant: first", "user: two"}
+	if len(reqs) != 2 || len(reqs[1].Messages) != len(want) {
+		t.Fatalf("unexpected requests: %+v", reqs)
+	}
+	for i := range want {
+		if reqs[1].Messages[i] != want[i] {
+			t.Fatalf("message %d: expect %s, got %s", i, want[i], reqs[1].Messages[i])
+		}
+	}
+
+	models, err := o.ListModels()
+	if err != nil || len(models) != 1 {
+		t.Fatalf("list models: %v, %v", models, err)
+	}
+}
+
+func TestOpenAIBotHistoryFailed(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	o := bot.NewOpenAIBot(fake.AccessToken(), fake.URL, "gpt")
+
+	fake.Reply(bottest.Reply{Parts: []string{"part"}, Error: "overloaded"})
+	ch, err := o.AskStream("one", "", "", bot.WithMessageId("u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answerId string
+	var failed bool
+	for msg := range ch {
+		if msg.Error != nil {
+			failed = true
+			continue
+		}
+		answerId = msg.Message.ID
+	}
+	if !failed || len(answerId) == 0 {
+		t.Fatalf("expect a partial answer and an error, failed: %v", failed)
+	}
+
+	fake.Reply(bottest.Reply{Parts: []string{"ok"}})
+	if _, err := o.Ask("two", "", answerId); err != nil {
+		t.Fatal(err)
+	}
+	reqs := fake.Requests()
+	if len(reqs) != 2 || len(reqs[1].Messages) != 1 || reqs[1].Messages[0] != "user: two" {
+		t.Fatalf("failed answer replayed: %+v", reqs)
+	}
+}
+
+func TestOpenAIBotHistorySize(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	o := bot.NewOpenAIBot(fake.AccessToken(), fake.URL, "gpt", bot.WithOpenAIHistory(time.Hour, 2))
+
+	fake.Reply(bottest.Reply{Parts: []string{"first"}})
+	first, err := o.Ask("one", "", "", bot.WithMessageId("u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Reply(bottest.Reply{Parts: []string{"second"}})
+	second, err := o.Ask("two", "", "", bot.WithMessageId("u2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Reply(bottest.Reply{Parts: []string{"x"}}, bottest.Reply{Parts: []string{"y"}})
+	if _, err := o.Ask("three", "", second.Message.ID, bot.WithMessageId("u3")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Ask("four", "", first.Message.ID, bot.WithMessageId("u4")); err != nil {
+		t.Fatal(err)
+	}
+	reqs := fake.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("unexpected requests: %+v", reqs)
+	}
+	want := []string{"user: two", "assistant: second", "user: three"}
+	if len(reqs[2].Messages) != len(want) {
+		t.Fatalf("unexpected messages: %+v", reqs[2].Messages)
+	}
+	for i := range want {
+		if reqs[2].Messages[i] != want[i] {
+			t.Fatalf("message %d: expect %s, got %s", i, want[i], reqs[2].Messages[i])
+		}
+	}
+	if len(reqs[3].Messages) != 1 {
+		t.Fatalf("evicted history replayed: %+v", reqs[3].Messages)
+	}
+}
+
+// slowReply reply streaming for seconds unless cancelled
+func slowReply() bottest.Reply {
+	return bottest.Reply{Parts: strings.Split(strings.Repeat("x", 200), ""), Delay: 20 * time.Millisecond}
+}
+
+// waitIdle wait until the fake stops streaming and the goroutines
+// started since base have exited
+func waitIdle(t *testing.T, fake *bottest.Server, base int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for fake.Active() > 0 || runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("leak, active: %d, goroutines: %d > %d\n%s", fake.Active(),
+				runtime.NumGoroutine(), base, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAskStreamCancel(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	backends := map[string]bot.Backend{
+		"web":    newChatbot(t, fake),
+		"openai": bot.NewOpenAIBot(fake.AccessToken(), fake.URL, "gpt"),
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			base := runtime.NumGoroutine()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fake.Reply(slowReply())
+			ch, err := backend.WithContext(ctx).AskStream("hi", "", "p0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-ch
+			cancel()
+			done := time.After(time.Second)
+			for open := true; open; {
+				select {
+				case _, open = <-ch:
+				case <-done:
+					t.Fatal("stream not closed after cancel")
+				}
+			}
+			waitIdle(t, fake, base)
+		})
+	}
+}
+
+func TestAskStreamTimeout(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	c, err := bot.NewChatbot("", "", "", bot.WithAuth(fake), bot.WithBaseURL(fake.URL),
+		bot.WithTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := runtime.NumGoroutine()
+
+	fake.Reply(slowReply())
+	ch, err := c.AskStream("hi", "", "p0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last bot.ResponseMessage
+	for msg := range ch {
+		last = msg
+	}
+	if last.Error != "upstream timeout" {
+		t.Fatalf("expect timeout error, got %+v", last.Error)
+	}
+
+	fake.Reply(slowReply())
+	if _, err = c.Ask("hi", "", "p0"); err == nil {
+		t.Fatal("expect timeout error")
+	}
+	waitIdle(t, fake, base)
+}
+
+// countingAuth shares the token of the fake and counts its uses, so
+// tests can tell which account sent a request
+type countingAuth struct {
+	*bottest.Server
+	used int32
+}
+
+func (a *countingAuth) AccessToken() string {
+	atomic.AddInt32(&a.used, 1)
+	return a.Server.AccessToken()
+}
+
+func TestAccountPool(t *testing.T) {
+	fake := bottest.NewServer()
+	defer fake.Close()
+	accounts := []*countingAuth{{Server: fake}, {Server: fake}}
+	pool := bot.NewAccountPool(bot.WithCooldown(time.Minute))
+	pool.Add("a", accounts[0])
+	pool.Add("b", accounts[1])
+	c, err := bot.NewChatbot("", "", "", bot.WithAccountPool(pool), bot.WithBaseURL(fake.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ask returns the index of the account that answered
+	ask := func(convId string) (*bot.ResponseMessage, int) {
+		t.Helper()
+		before := []int32{atomic.LoadInt32(&accounts[0].used), atomic.LoadInt32(&accounts[1].used)}
+		res, err := c.Ask("hi", convId, "p0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, acc := range accounts {
+			if atomic.LoadInt32(&acc.used) != before[i] {
+				return res, i
+			}
+		}
+		t.Fatal("no account used")
+		return nil, -1
+	}
+
+	first, a := ask("")
+	second, b := ask("")
+	if a == b {
+		t.Fatalf("new conversations should spread over the accounts")
+	}
+	for i := 0; i < 2; i++ {
+		if _, used := ask(first.ConversationID); used != a {
+			t.Fatalf("conversation moved from account %d to %d", a, used)
+		}
+	}
+
+	// a rate limited account cools down, new conversations go elsewhere
+	fake.Reply(bottest.Reply{Status: http.StatusTooManyRequests})
+	_, used := ask("")
+	limited := 1 - used
+	status := pool.Status()
+	if status[limited].Healthy || status[limited].CooldownUntil == nil || !status[used].Healthy {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if status[0].Conversations+status[1].Conversations != 3 || status[a].Requests < 3 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// conversations of the cooling account cannot move
+	convId := first.ConversationID
+	if limited == b {
+		convId = second.ConversationID
+	}
+	_, err = c.Ask("hi", convId, "p0")
+	var retry *errorcode.RetryError
+	if errorcode.Code(err) != errorcode.Code(errorcode.ErrServiceUnavailable) ||
+		!errors.As(err, &retry) || retry.RetryAfter <= 0 {
+		t.Fatalf("expect service unavailable with retry hint, got %v", err)
+	}
+}
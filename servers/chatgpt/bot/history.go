@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHistoryTTL how long an idle message is kept by default
+	defaultHistoryTTL = 24 * time.Hour
+	// defaultHistorySize most messages kept by default
+	defaultHistorySize = 10000
+)
+
+type historyNode struct {
+	id      string
+	parent  string
+	message chatMessage
+	expire  time.Time
+}
+
+// history messages of the stateless backends by id, a message is
+// dropped once it is idle for ttl or when the size is reached, the
+// least recently used first
+type history struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	size  int
+	nodes map[string]*list.Element
+	// order most recently used first, so the expired ones are at the back
+	order *list.List
+}
+
+func newHistory(ttl time.Duration, size int) *history {
+	if ttl <= 0 {
+		ttl = defaultHistoryTTL
+	}
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	return &history{
+		ttl:   ttl,
+		size:  size,
+		nodes: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// chain messages from the root down to id, the messages walked are
+// kept for another ttl
+//
+//	@param id
+//	@return []chatMessage
+func (h *history) chain(id string) []chatMessage {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.evict(now)
+	var out []chatMessage
+	for len(id) > 0 {
+		el, ok := h.nodes[id]
+		if !ok {
+			break
+		}
+		node := el.Value.(*historyNode)
+		node.expire = now.Add(h.ttl)
+		h.order.MoveToFront(el)
+		out = append(out, node.message)
+		id = node.parent
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// put keep message as a child of parent
+//
+//	@param id
+//	@param parent
+//	@param message
+func (h *history) put(id, parent string, message chatMessage) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	node := &historyNode{id: id, parent: parent, message: message, expire: now.Add(h.ttl)}
+	if el, ok := h.nodes[id]; ok {
+		el.Value = node
+		h.order.MoveToFront(el)
+	} else {
+		h.nodes[id] = h.order.PushFront(node)
+	}
+	h.evict(now)
+}
+
+// evict drop the expired messages and the least recently used ones over
+// the size
+func (h *history) evict(now time.Time) {
+	for el := h.order.Back(); el != nil; el = h.order.Back() {
+		node := el.Value.(*historyNode)
+		if h.order.Len() <= h.size && !now.After(node.expire) {
+			return
+		}
+		h.order.Remove(el)
+		delete(h.nodes, node.id)
+	}
+}
@@ -0,0 +1,266 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LSDXXX/libs/pkg/log"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var _ Backend = new(OpenAIBot)
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionReq struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type chatCompletionChoice struct {
+	Index        int         `json:"index"`
+	Message      chatMessage `json:"message"`
+	Delta        chatMessage `json:"delta"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+type chatCompletionRes struct {
+	Id      string                 `json:"id"`
+	Model   string                 `json:"model"`
+	Choices []chatCompletionChoice `json:"choices"`
+	Error   interface{}            `json:"error"`
+}
+
+// OpenAIBotOption opts
+type OpenAIBotOption func(*OpenAIBot)
+
+// WithOpenAITimeout deadline of every upstream request, zero means no deadline
+func WithOpenAITimeout(timeout time.Duration) OpenAIBotOption {
+	return func(o *OpenAIBot) {
+		o.timeout = timeout
+	}
+}
+
+// WithOpenAIHistory how long an idle message is kept for follow-up
+// questions and how many messages are kept at most, zero keeps the default
+func WithOpenAIHistory(ttl time.Duration, size int) OpenAIBotOption {
+	return func(o *OpenAIBot) {
+		o.history = newHistory(ttl, size)
+	}
+}
+
+// OpenAIBot backend talking to an openai compatible /v1/chat/completions api.
+// The api is stateless, so the message history is kept here and replayed
+// on every request, until it is idle for the history ttl or pushed out
+// by newer messages.
+type OpenAIBot struct {
+	ctx     context.Context
+	client  *http.Client
+	apiKey  string
+	baseURL string
+	model   string
+	timeout time.Duration
+	history *history
+}
+
+func NewOpenAIBot(apiKey, baseURL, model string, opts ...OpenAIBotOption) *OpenAIBot {
+	out := &OpenAIBot{
+		ctx:     context.Background(),
+		client:  &http.Client{},
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		history: newHistory(0, 0),
+	}
+	for _, opt := range opts {
+		opt(out)
+	}
+	return out
+}
+
+func (o *OpenAIBot) WithContext(ctx context.Context) Backend {
+	out := *o
+	out.ctx = ctx
+	return &out
+}
+
+func (o *OpenAIBot) messages(content, parentId string) []chatMessage {
+	return append(o.history.chain(parentId), chatMessage{Role: "user", Content: content})
+}
+
+func (o *OpenAIBot) remember(parentId, userId, answerId, content, answer string) {
+	o.history.put(userId, parentId, chatMessage{Role: "user", Content: content})
+	o.history.put(answerId, userId, chatMessage{Role: "assistant", Content: answer})
+}
+
+// upstreamContext context of one upstream request, bounded by the timeout
+func (o *OpenAIBot) upstreamContext() (context.Context, context.CancelFunc) {
+	if o.timeout > 0 {
+		return context.WithTimeout(o.ctx, o.timeout)
+	}
+	return context.WithCancel(o.ctx)
+}
+
+func (o *OpenAIBot) doRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var buf *bytes.Buffer
+	if body != nil {
+		data, _ := json.Marshal(body)
+		buf = bytes.NewBuffer(data)
+	} else {
+		buf = bytes.NewBuffer(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, o.baseURL+path, buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.apiKey))
+	res, err := o.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "do http request")
+	}
+	if res.StatusCode != 200 {
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		log.WithContext(o.ctx).Errorf("res: %s", string(data))
+		return nil, errors.Errorf("openai api status: %d", res.StatusCode)
+	}
+	return res, nil
+}
+
+func (o *OpenAIBot) Ask(content, convId, preConvId string, opts ...AskOption) (*ResponseMessage, error) {
+	options := newAskOptions(opts)
+	ctx, cancel := o.upstreamContext()
+	defer cancel()
+	res, err := o.doRequest(ctx, http.MethodPost, "/chat/completions", chatCompletionReq{
+		Model:    o.model,
+		Messages: o.messages(content, preConvId),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var out chatCompletionRes
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return nil, errors.Wrap(err, "json decode")
+	}
+	if len(out.Choices) == 0 {
+		return nil, errors.New("empty choices")
+	}
+	if len(convId) == 0 {
+		convId = uuid.NewString()
+	}
+	answer := out.Choices[0].Message.Content
+	var msg ResponseMessage
+	msg.ConversationID = convId
+	msg.Message.ID = uuid.NewString()
+	msg.Message.Role = "assistant"
+	msg.Message.Content = Content{
+		ContentType: "text",
+		Parts:       []string{answer},
+	}
+	msg.Message.Metadata.ModelSlug = out.Model
+	msg.Message.Metadata.FinishDetails.Type = out.Choices[0].FinishReason
+	o.remember(preConvId, options.MessageId, msg.Message.ID, content, answer)
+	return &msg, nil
+}
+
+func (o *OpenAIBot) AskStream(content, convId, preConvId string, opts ...AskOption) (<-chan ResponseMessage, error) {
+	options := newAskOptions(opts)
+	ctx, cancel := o.upstreamContext()
+	res, err := o.doRequest(ctx, http.MethodPost, "/chat/completions", chatCompletionReq{
+		Model:    o.model,
+		Messages: o.messages(content, preConvId),
+		Stream:   true,
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if len(convId) == 0 {
+		convId = uuid.NewString()
+	}
+	ch := make(chan ResponseMessage)
+	go func() {
+		defer close(ch)
+		defer cancel()
+		defer res.Body.Close()
+		var answer strings.Builder
+		var finish, model string
+		var failed bool
+		messageId := uuid.NewString()
+		err := readEvents(res.Body, func(data []byte) bool {
+			var resData chatCompletionRes
+			if err := json.Unmarshal(data, &resData); err != nil {
+				return true
+			}
+			if resData.Error != nil {
+				failed = true
+				return send(ctx, ch, ResponseMessage{ConversationID: convId, Error: resData.Error})
+			}
+			if len(resData.Choices) == 0 {
+				return true
+			}
+			answer.WriteString(resData.Choices[0].Delta.Content)
+			if len(resData.Choices[0].FinishReason) > 0 {
+				finish = resData.Choices[0].FinishReason
+			}
+			model = resData.Model
+
+			var msg ResponseMessage
+			msg.ConversationID = convId
+			msg.Message.ID = messageId
+			msg.Message.Role = "assistant"
+			msg.Message.Content = Content{
+				ContentType: "text",
+				Parts:       []string{answer.String()},
+			}
+			msg.Message.Metadata.ModelSlug = model
+			msg.Message.Metadata.FinishDetails.Type = finish
+			return send(ctx, ch, msg)
+		})
+		streamError(o.ctx, ctx, ch, convId, err)
+		if err != nil || failed || ctx.Err() != nil {
+			// a broken answer is not replayed to later questions
+			return
+		}
+		o.remember(preConvId, options.MessageId, messageId, content, answer.String())
+	}()
+	return ch, nil
+}
+
+func (o *OpenAIBot) ListModels() ([]string, error) {
+	ctx, cancel := o.upstreamContext()
+	defer cancel()
+	res, err := o.doRequest(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var out struct {
+		Data []struct {
+			Id string `json:"id"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return nil, errors.Wrap(err, "json decode")
+	}
+	var models []string
+	for _, m := range out.Data {
+		models = append(models, m.Id)
+	}
+	return models, nil
+}
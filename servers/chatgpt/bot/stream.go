@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// readEvents call handle with the payload of every sse data line until
+// [DONE], the end of body or handle returning false
+//
+//	@param body
+//	@param handle
+//	@return error read error, nil on a normal end
+func readEvents(body io.Reader, handle func(data []byte) bool) error {
+	reader := bufio.NewReader(body)
+	for {
+		data, _, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line := strings.Trim(string(data), " ")
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		line = strings.Trim(strings.TrimPrefix(line, "data:"), " ")
+		if line == "[DONE]" {
+			return nil
+		}
+		if !handle([]byte(line)) {
+			return nil
+		}
+	}
+}
+
+// send hand msg to the reader of ch, false if ctx ends first
+func send(ctx context.Context, ch chan<- ResponseMessage, msg ResponseMessage) bool {
+	select {
+	case ch <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// streamError report a stream broken by the upstream timeout or a read
+// error, nothing is sent when the caller has cancelled
+//
+//	@param parent context of the caller
+//	@param ctx context of the upstream request
+//	@param ch
+//	@param convId
+//	@param err error returned by readEvents
+func streamError(parent, ctx context.Context, ch chan<- ResponseMessage, convId string, err error) {
+	if parent.Err() != nil {
+		return
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = errors.New("upstream timeout")
+	}
+	if err == nil {
+		return
+	}
+	send(parent, ch, ResponseMessage{ConversationID: convId, Error: err.Error()})
+}
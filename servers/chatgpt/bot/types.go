@@ -23,6 +23,14 @@ type ResponseMessage struct {
 	Error          interface{} `json:"error"`
 }
 
+// Text answer text carried by the message
+func (r *ResponseMessage) Text() string {
+	if len(r.Message.Content.Parts) == 0 {
+		return ""
+	}
+	return r.Message.Content.Parts[0]
+}
+
 type Content struct {
 	ContentType string   `json:"content_type"`
 	Parts       []string `json:"parts"`
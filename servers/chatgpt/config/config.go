@@ -1,6 +1,10 @@
 package config
 
-import "github.com/LSDXXX/libs/config"
+import (
+	"time"
+
+	"github.com/LSDXXX/libs/config"
+)
 
 var (
 	conf *Config
@@ -11,13 +15,71 @@ type Config struct {
 	Common config.Config    `yaml:"common"`
 	GinLog config.LogConfig `yaml:"gin_log"`
 	Logic  LogicConfig      `yaml:"logic"`
+	JWT    JWTConfig        `yaml:"jwt"`
 }
 
+const (
+	// SignUpOpen anyone may register
+	SignUpOpen = "open"
+	// SignUpInvite registering needs an invite code
+	SignUpInvite = "invite"
+	// SignUpClosed users are created by hand
+	SignUpClosed = "closed"
+)
+
 // LogicConfig description
 type LogicConfig struct {
+	// Backend selects the llm provider, "web" or "openai"
+	Backend  string `yaml:"backend" default:"web"`
 	Email    string `yaml:"email"`
 	Password string `yaml:"password"`
 	Proxy    string `yaml:"proxy"`
+	Model    string `yaml:"model" default:"text-davinci-002-render-sha"`
+	BaseURL  string `yaml:"base_url" default:"https://bypass.duti.tech/api"`
+	// AccessToken skips the login on startup when set
+	AccessToken string `yaml:"access_token"`
+	// Accounts pool of web accounts, the account above is used when empty
+	Accounts []AccountConfig `yaml:"accounts"`
+	// AccountCooldown how long an account rests after it is rate limited
+	// or cannot login
+	AccountCooldown time.Duration `yaml:"account_cooldown" default:"5m"`
+	// TokenStore where the tokens of web accounts are cached across
+	// restarts: file, redis or db, empty disables the cache
+	TokenStore string `yaml:"token_store" default:"file"`
+	// TokenFile path of the file token store
+	TokenFile string `yaml:"token_file" default:"./tokens.json"`
+	// TokenRefreshBefore how long before expiry access tokens are renewed
+	TokenRefreshBefore time.Duration `yaml:"token_refresh_before" default:"10m"`
+	// Admins user names given the admin role whatever their stored role
+	Admins []string `yaml:"admins"`
+	// SignUp who may register: open, invite (with an invite code) or closed
+	SignUp string `yaml:"sign_up" default:"invite"`
+	// Timeout deadline of one upstream request including the whole answer
+	Timeout time.Duration `yaml:"timeout" default:"2m"`
+	OpenAI  OpenAIConfig  `yaml:"openai"`
+	// RateLimit limits of every user, counted in redis when it is enabled
+	RateLimit config.RateLimitConfig `yaml:"rate_limit"`
+}
+
+// AccountConfig one web account of the pool
+type AccountConfig struct {
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+	Proxy    string `yaml:"proxy"`
+	// AccessToken skips the login on startup when set
+	AccessToken string `yaml:"access_token"`
+}
+
+// OpenAIConfig official chat completions api config
+type OpenAIConfig struct {
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url" default:"https://api.openai.com/v1"`
+	Model   string `yaml:"model" default:"gpt-3.5-turbo"`
+	// HistoryTTL how long an idle message is kept to be replayed as
+	// the history of a follow-up question
+	HistoryTTL time.Duration `yaml:"history_ttl" default:"24h"`
+	// HistorySize most messages kept, the least recently used go first
+	HistorySize int `yaml:"history_size" default:"10000"`
 }
 
 // ServerConfig description
@@ -0,0 +1,50 @@
+package config
+
+import "time"
+
+const (
+	// JWTHS256 shared secret
+	JWTHS256 = "HS256"
+	// JWTRS256 rsa key pair
+	JWTRS256 = "RS256"
+	// JWTEdDSA ed25519 key pair
+	JWTEdDSA = "EdDSA"
+)
+
+// JWTConfig login tokens. The first key signs new tokens, all keys verify
+// tokens by their kid, so a new key is rotated in by putting it first and
+// the old one is dropped once its tokens have expired.
+type JWTConfig struct {
+	// Algorithm HS256, RS256 or EdDSA
+	Algorithm string         `yaml:"algorithm" default:"HS256"`
+	Keys      []JWTKeyConfig `yaml:"keys"`
+	// Timeout lifetime of access tokens
+	Timeout time.Duration `yaml:"timeout" default:"1h"`
+	// RefreshTimeout lifetime of refresh tokens, every refresh issues a new one
+	RefreshTimeout time.Duration   `yaml:"refresh_timeout" default:"168h"`
+	Cookie         JWTCookieConfig `yaml:"cookie"`
+}
+
+// JWTKeyConfig one signing key
+type JWTKeyConfig struct {
+	// Id kid header of the tokens signed with the key
+	Id string `yaml:"id"`
+	// Secret HS256 secret
+	Secret string `yaml:"secret"`
+	// PrivateKeyFile pem private key of RS256 and EdDSA, only the first key needs it
+	PrivateKeyFile string `yaml:"private_key_file"`
+	// PublicKeyFile pem public key of RS256 and EdDSA
+	PublicKeyFile string `yaml:"public_key_file"`
+}
+
+// JWTCookieConfig the tokens are also sent as cookies when enabled
+type JWTCookieConfig struct {
+	Enabled bool   `yaml:"enabled" default:"true"`
+	Name    string `yaml:"name" default:"jwt"`
+	Domain  string `yaml:"domain"`
+	Secure  bool   `yaml:"secure"`
+	// HTTPOnly hide the cookie from scripts
+	HTTPOnly bool `yaml:"http_only" default:"true"`
+	// SameSite lax, strict or none
+	SameSite string `yaml:"same_site" default:"lax"`
+}
@@ -0,0 +1,42 @@
+-- +goose Up
+
+--
+-- Table structure for table `conversation`
+--
+
+CREATE TABLE `conversation` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT '自增id，业务无关',
+  `conversation_id` varchar(64) NOT NULL COMMENT '会话id',
+  `user_id` bigint unsigned NOT NULL COMMENT '所属用户id',
+  `title` varchar(255) NOT NULL DEFAULT '' COMMENT '会话标题',
+  `current_node` varchar(64) NOT NULL DEFAULT '' COMMENT '最新消息id',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `update_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `conversation_id_UNIQUE` (`conversation_id`),
+  KEY `user_id_IDX` (`user_id`, `update_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='会话表' ;
+
+--
+-- Table structure for table `conversation_message`
+--
+
+CREATE TABLE `conversation_message` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT '自增id，业务无关',
+  `message_id` varchar(64) NOT NULL COMMENT '消息id',
+  `conversation_id` varchar(64) NOT NULL COMMENT '会话id',
+  `parent_id` varchar(64) NOT NULL DEFAULT '' COMMENT '父消息id',
+  `role` varchar(16) NOT NULL COMMENT '角色: user, assistant',
+  `content` mediumtext NOT NULL COMMENT '消息内容',
+  `model_slug` varchar(64) NOT NULL DEFAULT '' COMMENT '模型',
+  `finish_reason` varchar(32) NOT NULL DEFAULT '' COMMENT '结束原因',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `message_id_UNIQUE` (`message_id`),
+  KEY `conversation_id_IDX` (`conversation_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='会话消息表' ;
+
+-- +goose Down
+
+DROP TABLE `conversation_message`;
+DROP TABLE `conversation`;
@@ -0,0 +1,13 @@
+-- +goose Up
+
+ALTER TABLE `conversation`
+  ADD COLUMN `upstream_id` varchar(64) NOT NULL DEFAULT '' COMMENT '上游会话id' AFTER `title`,
+  ADD COLUMN `archived` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否归档' AFTER `current_node`;
+
+UPDATE `conversation` SET `upstream_id` = `conversation_id`;
+
+-- +goose Down
+
+ALTER TABLE `conversation`
+  DROP COLUMN `upstream_id`,
+  DROP COLUMN `archived`;
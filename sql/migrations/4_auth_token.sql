@@ -0,0 +1,21 @@
+-- +goose Up
+
+--
+-- Table structure for table `auth_token`
+--
+
+CREATE TABLE `auth_token` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT '自增id，业务无关',
+  `account` varchar(255) NOT NULL COMMENT '上游账号',
+  `session_token` text NOT NULL COMMENT '会话token',
+  `session_expire` bigint NOT NULL DEFAULT 0 COMMENT '会话token过期时间, unix秒, 0为未知',
+  `access_token` text NOT NULL COMMENT '访问token',
+  `access_expire` bigint NOT NULL DEFAULT 0 COMMENT '访问token过期时间, unix秒, 0为未知',
+  `update_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `account_UNIQUE` (`account`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='上游账号token缓存表' ;
+
+-- +goose Down
+
+DROP TABLE `auth_token`;
@@ -0,0 +1,14 @@
+-- +goose Up
+
+ALTER TABLE `user`
+  MODIFY COLUMN `password` varchar(255) NOT NULL COMMENT '密码哈希, argon2id或bcrypt',
+  ADD COLUMN `password_legacy` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否为明文密码, 下次登录时重新哈希' AFTER `password`;
+
+UPDATE `user` SET `password_legacy` = 1;
+
+-- +goose Down
+
+-- hashes do not fit the old column, the passwords have to be reset
+ALTER TABLE `user`
+  DROP COLUMN `password_legacy`,
+  MODIFY COLUMN `password` varchar(30) NOT NULL COMMENT '用户密码';
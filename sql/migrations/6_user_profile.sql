@@ -0,0 +1,38 @@
+-- +goose Up
+
+ALTER TABLE `user`
+  MODIFY COLUMN `name` varchar(64) NOT NULL COMMENT '用户名称',
+  ADD COLUMN `nickname` varchar(64) NOT NULL DEFAULT '' COMMENT '昵称' AFTER `password_legacy`,
+  ADD COLUMN `email` varchar(255) NOT NULL DEFAULT '' COMMENT '邮箱' AFTER `nickname`,
+  ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'user' COMMENT '角色: user, admin' AFTER `email`,
+  ADD COLUMN `disabled` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否禁用' AFTER `role`,
+  ADD COLUMN `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  ADD COLUMN `update_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间';
+
+--
+-- Table structure for table `invite_code`
+--
+
+CREATE TABLE `invite_code` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT '自增id，业务无关',
+  `code` varchar(64) NOT NULL COMMENT '邀请码',
+  `created_by` bigint unsigned NOT NULL COMMENT '创建者用户id',
+  `max_uses` int NOT NULL DEFAULT 1 COMMENT '最多使用次数',
+  `uses` int NOT NULL DEFAULT 0 COMMENT '已使用次数',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `code_UNIQUE` (`code`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='邀请码表' ;
+
+-- +goose Down
+
+DROP TABLE `invite_code`;
+
+ALTER TABLE `user`
+  DROP COLUMN `nickname`,
+  DROP COLUMN `email`,
+  DROP COLUMN `role`,
+  DROP COLUMN `disabled`,
+  DROP COLUMN `create_time`,
+  DROP COLUMN `update_time`,
+  MODIFY COLUMN `name` varchar(30) NOT NULL COMMENT '用户名称';
@@ -0,0 +1,23 @@
+-- +goose Up
+
+--
+-- Table structure for table `api_key`
+--
+
+CREATE TABLE `api_key` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT '自增id，业务无关',
+  `user_id` bigint unsigned NOT NULL COMMENT '所属用户id',
+  `name` varchar(64) NOT NULL DEFAULT '' COMMENT '名称',
+  `prefix` varchar(16) NOT NULL COMMENT '密钥前缀，用于区分密钥',
+  `key_hash` char(64) NOT NULL COMMENT '密钥的sha256',
+  `scopes` varchar(255) NOT NULL DEFAULT '[]' COMMENT '权限范围: ask, chat, admin',
+  `last_used_time` datetime DEFAULT NULL COMMENT '最后使用时间',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `key_hash_UNIQUE` (`key_hash`),
+  KEY `user_id_IDX` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='API密钥表' ;
+
+-- +goose Down
+
+DROP TABLE `api_key`;